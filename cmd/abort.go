@@ -0,0 +1,45 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/msarfaty/tuf/pkg/cli/abort"
+	"github.com/spf13/cobra"
+)
+
+var abortForce bool
+
+// abortCmd represents the abort command
+var abortCmd = &cobra.Command{
+	Use:   "abort",
+	Short: "Abort a tuf migration",
+	Long: `Aborts the tuf migration tracked in tuf.state.
+This will:
+	- restore every tracked file to the contents captured during tuf init
+	- delete any files that tuf created (ie *.tuf.tf files)
+	- delete the terraform state files pulled for finalize, or restore the ones that existed during tuf init
+	- remove tuf.state and every snapshot tuf has taken
+
+tuf refuses to abort if workspaces have changed outside of tuf or the migration was
+finalized, since either would lose work; pass --force to abort anyway.
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := tufState()
+		if err != nil {
+			return err
+		}
+		return abort.TufAbort(abort.Options{
+			Force: abortForce,
+			Out:   cmd.OutOrStdout(),
+			State: s,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(abortCmd)
+
+	abortCmd.Flags().BoolVar(&abortForce, "force", false, "abort even if workspaces drifted or the migration was finalized")
+}
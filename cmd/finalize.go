@@ -0,0 +1,55 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/msarfaty/tuf/pkg/cli/finalize"
+	"github.com/spf13/cobra"
+)
+
+var finalizeStrategy string
+
+// finalizeCmd represents the finalize command
+var finalizeCmd = &cobra.Command{
+	Use:   "finalize",
+	Short: "Finalize a tuf migration",
+	Long: `Finalizes the tuf migration tracked in tuf.state.
+This will:
+	- pull fresh terraform state for every workspace with the configured pull command
+	- apply every recorded move and rename, in the order they were made, to the pulled state files
+	- print a summary of everything that was remediated
+	- mark the migration as completed
+
+With --strategy=state (the default) the remediated state files are left in each workspace
+(named by --terraform-state-file during tuf init) so that they can be reviewed and pushed
+with terraform state push.
+
+With --strategy=declarative no state is written. Instead, removed blocks are written to
+removed.tuf.tf in source workspaces and import blocks to imports.tuf.tf in destination
+workspaces (moves within a workspace become moved blocks in moved.tuf.tf), so that the
+handover is reviewed and applied through terraform plan and apply. This needs terraform 1.7
+or later. Removed blocks cannot address instance keys, so instances moved one at a time are
+only finalized this way once every instance of their block has been moved.
+Import ids are built the way tuf knows each resource type to be imported (ie role/policy_arn
+for aws_iam_role_policy_attachment) or else read from the id attribute in state; blocks with
+an id read from state are marked with a comment and must be checked before they are applied.
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := tufState()
+		if err != nil {
+			return err
+		}
+		return finalize.TufFinalize(finalize.Options{
+			Strategy: finalizeStrategy,
+			Out:      cmd.OutOrStdout(),
+			State:    s,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(finalizeCmd)
+	finalizeCmd.Flags().StringVar(&finalizeStrategy, "strategy", finalize.STRATEGY_STATE, "how terraform state is remediated: state or declarative")
+}
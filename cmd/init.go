@@ -42,10 +42,15 @@ tuf init --workspaces .,../workspace-a,../workspace-b \
 This is still assuming that in each workspace, your state is still being pulled to state.tfstate
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := tufState()
+		if err != nil {
+			return err
+		}
 		return tufinit.TufInit(tufinit.Options{
 			Workspaces:                workspaces,
 			StateFileName:             terraformStateFile,
 			TerraformStatePullCommand: terraformStatePullCommand,
+			State:                     s,
 		})
 	},
 }
@@ -0,0 +1,139 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/msarfaty/tuf/pkg/cli/mv"
+	"github.com/spf13/cobra"
+)
+
+var mvDryRun bool
+var mvCopy bool
+var mvCopyProviders bool
+var mvFileNaming string
+var mvFile string
+
+// mvCmd represents the mv command
+var mvCmd = &cobra.Command{
+	Use:   "mv SOURCE DESTINATION",
+	Short: "Move a block between tracked workspaces, or rename it within one",
+	Long: `Moves a module, resource, data, variable or output block, or a single local value,
+from one tracked workspace to another.
+Both the source and destination are written as workspace:address, and both
+workspaces must have been tracked with tuf init. Addresses may start with a module
+path to move blocks into or out of local child modules, which are found by following
+the source of each module block. A moved module block with a local source is rewritten
+to call the same module from its destination; it cannot leave a workspace whose files
+include that module. A source address with wildcards (* or ?) in its
+labels is a selector that moves every matching block in the source module at once;
+the matched blocks are listed before anything is written. An address with instance
+keys (ie [0] or ["blue"]) moves the whole block the first time one of its instances is
+moved, and records the key so that tuf finalize moves the state of that instance alone;
+later instances of the same block only have their state moved.
+
+Aliased provider configurations used by a moved block (ie provider = aws.east, or
+providers = { aws = aws.east } on a module) must exist in the destination module. Missing
+configurations fail the move unless --copy-providers is set, which copies them from the
+source module into providers.tuf.tf. The copies are journaled with the move that needed them
+and are undone along with it.
+
+A resource or data block moved out of a child module keeps the configuration its module was
+passed by the providers argument of each module call along its path: it is given a provider
+attribute naming that configuration as its caller knows it, which is copied like any other.
+Module blocks passed a configuration under another name this way cannot be moved out.
+
+The required_providers entries of the source module for the providers a moved block needs are
+merged into the required_providers of the destination module (or a new versions.tuf.tf).
+Providers required from a different source or with a different version constraint in the
+destination are left as they are and reported as warnings.
+
+Moved blocks are written into the destination module in files named by --file-naming:
+	- description (the default): by the kind of block, ie resources.tuf.tf, data.tuf.tf or module_<name>.tuf.tf
+	- source: after the file the block is moved from, ie main.tf
+	- type: after the type of each resource or data source, ie aws_iam_role.tuf.tf or data_aws_iam_policy.tuf.tf
+--file moves every block into a single file of the destination module instead. Files are
+created if they do not exist.
+
+Moved blocks, and the blocks they are merged into, are written in canonical format as
+terraform fmt would write them; the rest of each changed file is left as it was.
+
+Blocks may be moved out of JSON syntax files (*.tf.json); they are rendered as native
+syntax in the destination and the JSON file is rewritten without them. Objects are
+rendered as map attributes unless they are meta-argument blocks (ie lifecycle), and each
+object of a resource, data source or provider rendered this way is reported as a warning,
+since it may be a block of the provider schema that must be rewritten by hand.
+
+A destination in the same workspace with a different name renames the block in place:
+every reference to it in its module is updated, and resources and modules get a moved
+block in moved.tuf.tf so that terraform renames their state. Only resources, data sources
+and modules can be renamed, and only their name can change.
+
+Examples:
+
+tuf mv /path/to/workspace/a:module.example /path/to/workspace/b:module.example
+
+* finds module.example in any terraform file of /path/to/workspace/a
+* moves the block into /path/to/workspace/b/module_example.tuf.tf
+
+tuf mv --dry-run /path/to/workspace/a:module.example /path/to/workspace/b:module.example
+
+* prints a unified diff of every file the move would change without writing anything
+
+tuf mv /path/to/workspace/a:module.eks.module.karpenter.aws_iam_role.this /path/to/workspace/b:aws_iam_role.this
+
+* finds the karpenter module by following the local sources of module.eks and module.karpenter
+* moves the resource into the root module of /path/to/workspace/b
+
+tuf mv /path/to/workspace/b:aws_security_group.foo /path/to/workspace/b:aws_security_group.bar
+
+* renames the security group and every reference to it within workspace b
+* adds moved { from = aws_security_group.foo, to = aws_security_group.bar } to /path/to/workspace/b/moved.tuf.tf
+
+tuf mv --copy /path/to/workspace/a:data.aws_caller_identity.current /path/to/workspace/b:data.aws_caller_identity.current
+
+* copies the data source into /path/to/workspace/b/data.tuf.tf, leaving workspace a untouched
+
+tuf mv /path/to/workspace/a:local.tags /path/to/workspace/b:local.tags
+
+* cuts only the tags attribute out of its locals block in workspace a
+* adds it to the last locals block of /path/to/workspace/b/locals.tuf.tf, creating one if needed
+
+tuf mv '/path/to/workspace/a:aws_iam_*.*' '/path/to/workspace/b:aws_iam_*.*'
+
+* moves every aws_iam_ resource of workspace a into /path/to/workspace/b/resources.tuf.tf
+* every matched block is moved in a single operation, so tuf undo reverses them in one step
+
+tuf mv --file-naming=source '/path/to/workspace/a:module.*' '/path/to/workspace/b:module.*'
+
+* moves every module block of workspace a into the file of workspace b named like the one it came from
+`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := tufState()
+		if err != nil {
+			return err
+		}
+		return mv.TufMv(mv.Options{
+			Source:        args[0],
+			Destination:   args[1],
+			DryRun:        mvDryRun,
+			Copy:          mvCopy,
+			CopyProviders: mvCopyProviders,
+			Naming:        mvFileNaming,
+			FileName:      mvFile,
+			Out:           cmd.OutOrStdout(),
+			State:         s,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mvCmd)
+
+	mvCmd.Flags().BoolVar(&mvCopy, "copy", false, "copy the block instead of moving it; only data sources, variables, outputs and locals can be copied")
+	mvCmd.Flags().BoolVar(&mvCopyProviders, "copy-providers", false, "copy aliased provider configurations the moved blocks use into the destination if they are missing")
+	mvCmd.Flags().StringVar(&mvFileNaming, "file-naming", "", "how destination files are named: description, source or type (default description)")
+	mvCmd.Flags().StringVar(&mvFile, "file", "", "move every block into this file of the destination module")
+	mvCmd.Flags().BoolVar(&mvDryRun, "dry-run", false, "print a diff of the move without changing any files or taking the migration lock")
+}
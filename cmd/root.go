@@ -24,9 +24,12 @@ package cmd
 import (
 	"os"
 
+	"github.com/msarfaty/tuf/pkg/state"
 	"github.com/spf13/cobra"
 )
 
+var stateFile string
+
 
 
 // rootCmd represents the base command when called without any subcommands
@@ -53,7 +56,18 @@ func Execute() {
 	}
 }
 
+// the tuf state chosen with --state-file; nil lets each command find the tuf state itself
+func tufState() (state.State, error) {
+	if stateFile == "" {
+		return nil, nil
+	}
+
+	return state.NewDiskState(stateFile)
+}
+
 func init() {
+	rootCmd.PersistentFlags().StringVar(&stateFile, "state-file", "", "the tuf state file to use (default is the tuf.state in the current directory or its nearest parent; tuf init creates it in the current directory)")
+
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
@@ -0,0 +1,45 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/msarfaty/tuf/pkg/cli/status"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of a tuf migration",
+	Long: `Shows the tuf migration tracked in tuf.state.
+For every tracked workspace this lists its path, uuid and number of tracked files, with
+the files grouped into unchanged, modified, added and removed compared to what tuf tracked.
+Every operation in the journal is listed after the workspaces, with the operations that
+were undone marked (undone).
+tuf status only reads the migration, so it runs while another tuf command holds the
+migration lock. An operation that was interrupted while writing its files is reported as
+pending rather than finished; the next tuf command that changes the migration finishes
+or discards it, and until then its files may show up as drift.
+
+tuf status exits non-zero if any workspace has changed outside of tuf, so that it can be
+used to gate CI on a clean migration.
+`,
+	Args: cobra.NoArgs,
+	// drift is reported by the status itself, so usage would only bury it
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := tufState()
+		if err != nil {
+			return err
+		}
+		return status.TufStatus(status.Options{
+			Out:   cmd.OutOrStdout(),
+			State: s,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
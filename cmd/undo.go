@@ -0,0 +1,50 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/msarfaty/tuf/pkg/cli/undo"
+	"github.com/spf13/cobra"
+)
+
+var undoSteps int
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Undo the most recent moves of a tuf migration",
+	Long: `Undoes the most recent moves recorded in tuf.state.
+The source and destination files of each move are restored byte-for-byte to the
+contents they had before the move. tuf refuses to undo anything if the files have
+changed since the move was made.
+
+Examples:
+
+tuf undo
+
+* undoes the most recent move
+
+tuf undo --steps 3
+
+* undoes the three most recent moves, most recent first
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := tufState()
+		if err != nil {
+			return err
+		}
+		return undo.TufUndo(undo.Options{
+			Steps: undoSteps,
+			Out:   cmd.OutOrStdout(),
+			State: s,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+
+	undoCmd.Flags().IntVar(&undoSteps, "steps", 1, "the number of moves, copies or renames to undo")
+}
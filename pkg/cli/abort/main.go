@@ -0,0 +1,157 @@
+package abort
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/msarfaty/tuf/pkg/state"
+)
+
+// options for aborting a tuf migration
+type Options struct {
+	// abort even if workspaces have changed outside of tuf or the migration was finalized
+	Force bool
+	// where the summary of the abort is written
+	Out io.Writer
+	// where the migration is persisted; defaults to the tuf.state found from the current directory
+	State state.State
+}
+
+func (o *Options) validate() error {
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+
+	if o.State == nil {
+		s, err := state.Discover()
+		if err != nil {
+			return err
+		}
+		o.State = s
+	}
+
+	return nil
+}
+
+// how a single workspace file is put back to its initial contents
+type reversion struct {
+	ws   *state.Workspace
+	name string
+	// md5 of the initial contents; empty if tuf created the file
+	md5 string
+}
+
+// plans every file that must be reverted to abort the migration, without touching disk
+func plan(wsmgr *state.WorkspaceMgr) ([]*reversion, error) {
+	ret := []*reversion{}
+	for _, ws := range wsmgr.Workspaces {
+		if ws.InitialFiles == nil {
+			return nil, fmt.Errorf("workspace %s has no record of its initial files", ws.Abspath)
+		}
+
+		initial := map[string]bool{}
+		for _, f := range ws.InitialFiles {
+			initial[f.Name] = true
+			current, err := ws.CurrentMd5(f.Name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to hash %s in workspace %s: %w", f.Name, ws.Abspath, err)
+			}
+			if current == f.Md5 {
+				continue
+			}
+			if _, err = wsmgr.ReadSnapshot(f.Md5); err != nil {
+				return nil, fmt.Errorf("cannot restore %s in workspace %s: tuf has no snapshot of its initial contents, "+
+					"which happens when a file changes before a migration started by an older tuf is first opened; restore it by hand: %w",
+					f.Name, ws.Abspath, err)
+			}
+			ret = append(ret, &reversion{ws: ws, name: f.Name, md5: f.Md5})
+		}
+
+		// files tracked since init were created by tuf operations
+		for _, f := range ws.Files {
+			if !initial[f.Name] {
+				ret = append(ret, &reversion{ws: ws, name: f.Name})
+			}
+		}
+
+		// terraform state pulled for finalize is removed, or put back if the workspace had a state file at init
+		if ws.InitialState != nil {
+			current, err := ws.CurrentMd5(ws.InitialState.Name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to hash %s in workspace %s: %w", ws.InitialState.Name, ws.Abspath, err)
+			}
+			if current != ws.InitialState.Md5 {
+				ret = append(ret, &reversion{ws: ws, name: ws.InitialState.Name, md5: ws.InitialState.Md5})
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// aborts a tuf migration, restoring every workspace to how it was when the migration was initialized
+func TufAbort(o Options) (err error) {
+	if err := o.validate(); err != nil {
+		return fmt.Errorf("failed to abort tuf migration: %v", err)
+	}
+
+	unlock, err := o.State.Lock()
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, unlock()) }()
+
+	if op, err := state.Recover(o.State); err != nil {
+		return err
+	} else if op != nil {
+		fmt.Fprintf(o.Out, "finished %v, which was interrupted\n", op)
+	}
+	wsmgr, err := state.Open(o.State)
+	if err != nil {
+		return err
+	}
+	if !o.Force {
+		if wsmgr.Completed {
+			return fmt.Errorf("the migration in %s has already been finalized; use --force to abort anyway", o.State)
+		}
+		if err = wsmgr.Validate(); err != nil {
+			return fmt.Errorf("tracked workspaces have changed outside of tuf; use --force to discard those changes: %w", err)
+		}
+	}
+
+	reversions, err := plan(wsmgr)
+	if err != nil {
+		return err
+	}
+
+	// every file is restored at once, so that a failure leaves the tuf state in place and the abort can be retried
+	tx := wsmgr.Begin()
+	errs := []error{}
+	for _, r := range reversions {
+		if err := wsmgr.RestoreFile(tx, r.ws, r.name, r.md5); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to restore every workspace: %w", errors.Join(errs...))
+	}
+	if err = tx.Commit(nil); err != nil {
+		return fmt.Errorf("failed to restore every workspace: %w", err)
+	}
+	for _, r := range reversions {
+		if r.md5 == "" {
+			fmt.Fprintf(o.Out, "removed %s/%s\n", r.ws.Abspath, r.name)
+		} else {
+			fmt.Fprintf(o.Out, "restored %s/%s\n", r.ws.Abspath, r.name)
+		}
+	}
+
+	if err = o.State.Remove(); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.Out, "aborted the migration in %s\n", o.State)
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package abort
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/msarfaty/tuf/internal/testutils"
+	"github.com/msarfaty/tuf/pkg/state"
+)
+
+func TestTufAbort(t *testing.T) {
+	tests := []struct {
+		name  string
+		force bool
+		drift bool
+		// the terraform state file of the workspace at init; empty if there was none
+		initialState string
+		wantErr      bool
+	}{
+		{
+			name:    "restores every workspace",
+			force:   false,
+			drift:   false,
+			wantErr: false,
+		},
+		{
+			name:         "restores a terraform state file that existed at init",
+			force:        false,
+			drift:        false,
+			initialState: "local",
+			wantErr:      false,
+		},
+		{
+			name:    "refuses to abort when workspaces drifted",
+			force:   false,
+			drift:   true,
+			wantErr: true,
+		},
+		{
+			name:    "discards drift when forced",
+			force:   true,
+			drift:   true,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents := map[string]string{"main.tf": "foo"}
+			if tt.initialState != "" {
+				contents[state.DEFAULT_STATE_FILE_NAME] = tt.initialState
+			}
+			ws := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: contents})
+			s, err := state.NewDiskState(filepath.Join(t.TempDir(), state.TUF_STATE_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wsmgr := state.NewWorkspaceMgr()
+			if err := wsmgr.AddWorkspace(ws); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Create(s); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Snapshot(wsmgr.Workspaces[0]); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.SnapshotStateFile(wsmgr.Workspaces[0]); err != nil {
+				t.Fatal(err)
+			}
+
+			// simulate a move that changed main.tf and created a tuf file
+			if err := os.WriteFile(filepath.Join(ws, "main.tf"), []byte("bar"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(ws, "resources.tuf.tf"), []byte("foo"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			// and a finalize that pulled terraform state before failing
+			if err := os.WriteFile(filepath.Join(ws, state.DEFAULT_STATE_FILE_NAME), []byte("pulled"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Workspaces[0].Refresh(); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Save(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.drift {
+				if err := os.WriteFile(filepath.Join(ws, "main.tf"), []byte("baz"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = TufAbort(Options{Force: tt.force, Out: io.Discard, State: s})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TufAbort() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				if _, err := os.Stat(s.Path()); err != nil {
+					t.Errorf("TufAbort() removed the tuf state after failing: %v", err)
+				}
+				return
+			}
+
+			got, err := os.ReadFile(filepath.Join(ws, "main.tf"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "foo" {
+				t.Errorf("TufAbort() main.tf = %s, want foo", string(got))
+			}
+			removed := []string{filepath.Join(ws, "resources.tuf.tf"), s.Path(), s.DataDir(), s.Path() + state.LOCK_FILE_SUFFIX}
+			if tt.initialState == "" {
+				removed = append(removed, filepath.Join(ws, state.DEFAULT_STATE_FILE_NAME))
+			} else if got, err := os.ReadFile(filepath.Join(ws, state.DEFAULT_STATE_FILE_NAME)); err != nil || string(got) != tt.initialState {
+				t.Errorf("TufAbort() %s = %s, want %s", state.DEFAULT_STATE_FILE_NAME, got, tt.initialState)
+			}
+			for _, removed := range removed {
+				if _, err := os.Stat(removed); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("TufAbort() did not remove %s", removed)
+				}
+			}
+		})
+	}
+}
+
+func TestTufAbort_Upgraded(t *testing.T) {
+	tests := []struct {
+		name string
+		// whether main.tf changes before the version 0 file is first opened, so its initial contents are lost
+		changedBeforeOpen bool
+		wantErr           bool
+	}{
+		{
+			name:              "restores the initial files of a version 0 migration",
+			changedBeforeOpen: false,
+			wantErr:           false,
+		},
+		{
+			name:              "reports initial files of a version 0 migration that have no snapshot",
+			changedBeforeOpen: true,
+			wantErr:           true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := testutils.MakeDirectory(t, &testutils.TempDirOpts{
+				Contents: map[string]string{"main.tf": "foo"},
+			})
+			s, err := state.NewDiskState(filepath.Join(t.TempDir(), state.TUF_STATE_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v0 := "workspaces:\n  - guid: a\n    absolutePath: " + ws + "\n    files:\n      - name: main.tf\n        md5: acbd18db4cc2f85cedef654fccc4a4d8\n" +
+				"terraform:\n  statePullCommand: \"true\"\n  stateFileName: terraform.tfstate\n"
+			if err := os.WriteFile(s.Path(), []byte(v0), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.changedBeforeOpen {
+				if err := os.WriteFile(filepath.Join(ws, "main.tf"), []byte("bar"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			wsmgr, err := state.Open(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// simulate a move that changed main.tf
+			if err := os.WriteFile(filepath.Join(ws, "main.tf"), []byte("bar"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Workspaces[0].Refresh(); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Save(); err != nil {
+				t.Fatal(err)
+			}
+
+			err = TufAbort(Options{Out: io.Discard, State: s})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TufAbort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			want := "foo"
+			if err != nil {
+				want = "bar"
+				if !strings.Contains(err.Error(), "no snapshot of its initial contents") {
+					t.Errorf("TufAbort() error = %v, want it to explain that no snapshot exists", err)
+				}
+			}
+			if got, err := os.ReadFile(filepath.Join(ws, "main.tf")); err != nil || string(got) != want {
+				t.Errorf("TufAbort() main.tf = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package finalize
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/msarfaty/tuf/pkg/file"
+	"github.com/msarfaty/tuf/pkg/parser"
+	"github.com/msarfaty/tuf/pkg/state"
+	"github.com/msarfaty/tuf/pkg/tfstate"
+)
+
+const (
+	// the file removed blocks are written to in source workspaces
+	REMOVED_FILE_NAME = "removed.tuf.tf"
+	// the file import blocks are written to in destination workspaces
+	IMPORTS_FILE_NAME = "imports.tuf.tf"
+	// the file moved blocks are written to for moves within a single workspace, alongside those of renames
+	MOVED_FILE_NAME = parser.MOVED_FILE_NAME
+	// marks an import block whose id was read from the id attribute in state rather than built the way its resource
+	// type is known to be imported
+	UNVERIFIED_IMPORT_COMMENT = "# tuf: this id is the id attribute from state; check that the resource type is imported by it"
+)
+
+// the blocks to write into a single workspace
+type declarations struct {
+	removed []string
+	imports []*tfstate.ImportTarget
+	moved   [][2]string
+	// the blocks whose instances were moved out one at a time; each is removed as a whole once all of them are
+	instanceMoves []string
+}
+
+// whether an address is, or contains, another address (ie module.foo covers module.foo["a"].aws_iam_role.bar)
+func covers(address string, other string) bool {
+	rest, ok := strings.CutPrefix(other, address)
+	return ok && (rest == "" || strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "["))
+}
+
+// quotes an import id as a native syntax string that terraform will not treat as a template
+func quoteId(id string) string {
+	quoted := strconv.Quote(id)
+	quoted = strings.ReplaceAll(quoted, "${", "$${")
+	return strings.ReplaceAll(quoted, "%{", "%%{")
+}
+
+// the number of import blocks whose id must be checked before they are applied
+func (d *declarations) unverified() int {
+	count := 0
+	for _, target := range d.imports {
+		if !target.Known {
+			count++
+		}
+	}
+	return count
+}
+
+// renders the blocks of a workspace as native syntax, in the order they were declared
+func (d *declarations) render() map[string][]string {
+	ret := map[string][]string{}
+	for _, from := range d.removed {
+		ret[REMOVED_FILE_NAME] = append(ret[REMOVED_FILE_NAME], fmt.Sprintf("removed {\n  from = %s\n\n  lifecycle {\n    destroy = false\n  }\n}\n", from))
+	}
+	for _, target := range d.imports {
+		block := fmt.Sprintf("import {\n  to = %s\n  id = %s\n}\n", target.Address, quoteId(target.Id))
+		if !target.Known {
+			block = UNVERIFIED_IMPORT_COMMENT + "\n" + block
+		}
+		ret[IMPORTS_FILE_NAME] = append(ret[IMPORTS_FILE_NAME], block)
+	}
+	for _, m := range d.moved {
+		ret[MOVED_FILE_NAME] = append(ret[MOVED_FILE_NAME], fmt.Sprintf("moved {\n  from = %s\n  to   = %s\n}\n", m[0], m[1]))
+	}
+	return ret
+}
+
+// adds the blocks that hand the resources of a move over from one workspace to the other.
+// returns the moved resources as they are addressed in the destination
+func (d *declarations) declare(src *declarations, move *state.Operation, moved []*tfstate.Resource) ([]string, error) {
+	if src == d {
+		// a move within a workspace keeps its state, so terraform only has to be told where it went
+		d.moved = append(d.moved, [2]string{move.SourceAddress, move.DestinationAddress})
+		return movedAddresses(moved, move.DestinationAddress), nil
+	}
+
+	// resources imported into the source by earlier moves were never in its real state, so they are
+	// imported straight into the destination instead of being removed from the source
+	pending := len(src.imports)
+	src.imports = slices.DeleteFunc(src.imports, func(target *tfstate.ImportTarget) bool {
+		return covers(move.SourceAddress, target.Address)
+	})
+	imported := pending - len(src.imports)
+
+	targets := []*tfstate.ImportTarget{}
+	for _, r := range moved {
+		if r.Mode != tfstate.MODE_MANAGED {
+			continue
+		}
+		t, err := r.ImportTargets()
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t...)
+	}
+	if len(targets) > imported {
+		if !strings.Contains(move.SourceAddress, "[") {
+			src.removed = append(src.removed, move.SourceAddress)
+		} else if config, err := parser.ConfigAddress(move.SourceAddress); err != nil {
+			return nil, err
+		} else if !slices.Contains(src.instanceMoves, config) {
+			src.instanceMoves = append(src.instanceMoves, config)
+		}
+	}
+	d.imports = append(d.imports, targets...)
+
+	ret := []string{}
+	for _, target := range targets {
+		ret = append(ret, target.Address)
+	}
+	return ret, nil
+}
+
+// readdresses the blocks already declared for a renamed block, or for the blocks within a renamed module
+func (d *declarations) rename(from string, to string) {
+	readdress := func(address string) string {
+		if !covers(from, address) {
+			return address
+		}
+		return to + strings.TrimPrefix(address, from)
+	}
+
+	for _, target := range d.imports {
+		target.Address = readdress(target.Address)
+	}
+	for i := range d.removed {
+		d.removed[i] = readdress(d.removed[i])
+	}
+	for i := range d.instanceMoves {
+		d.instanceMoves[i] = readdress(d.instanceMoves[i])
+	}
+}
+
+// removes the blocks whose instances were moved one at a time, now that every move has been replayed against the
+// state of the workspace. Removed blocks cannot address instance keys, so a block is only removed if none of its
+// instances are left in the state
+func (d *declarations) removeInstanceMoves(s *tfstate.State) error {
+	for _, config := range d.instanceMoves {
+		for _, r := range s.Resources {
+			if r.Mode != tfstate.MODE_MANAGED {
+				continue
+			}
+			if other, err := parser.ConfigAddress(r.Address()); err == nil && covers(config, other) {
+				return fmt.Errorf("removed blocks cannot address instance keys, and %s has instances that were not moved; finalize with the %s strategy instead, or move the rest of them", config, STRATEGY_STATE)
+			}
+		}
+		d.removed = append(d.removed, config)
+	}
+
+	return nil
+}
+
+// the addresses of moved resources as they exist in the destination
+func movedAddresses(moved []*tfstate.Resource, destination string) []string {
+	ret := []string{}
+	for _, r := range moved {
+		ret = append(ret, r.Address())
+	}
+	if len(moved) == 1 && covers(moved[0].Address(), destination) {
+		// a single instance was moved
+		ret[0] = destination
+	}
+	return ret
+}
+
+// the contents of a terraform file in a workspace with blocks appended to it; the file may not exist yet
+func appendBlocks(name string, blocks []string) ([]byte, error) {
+	contents, err := os.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(contents) > 0 && !strings.HasSuffix(string(contents), "\n") {
+		contents = append(contents, '\n')
+	}
+	text := strings.Join(blocks, "\n")
+	if len(contents) > 0 {
+		text = "\n" + text
+	}
+	return append(contents, text...), nil
+}
+
+// replays every move and rename against the pulled terraform states, then writes removed blocks into the source
+// workspaces and import blocks into the destination workspaces so that terraform (1.7 or later) remediates
+// state during its next plan and apply. Moves within a workspace are written as moved blocks; renames wrote
+// their own.
+// the files are staged in the transaction, so nothing is written unless every move succeeds
+func declare(out io.Writer, tx *file.Transaction, wsmgr *state.WorkspaceMgr, states map[string]*tfstate.State) ([]*remediation, error) {
+	moves, err := stateMoves(wsmgr, states)
+	if err != nil {
+		return nil, err
+	}
+
+	workspaces := map[string]*declarations{}
+	for _, ws := range wsmgr.Workspaces {
+		workspaces[ws.Uuid] = &declarations{}
+	}
+	remediations := []*remediation{}
+	for _, move := range moves {
+		moved, err := tfstate.MoveResources(states[move.SourceWorkspace], move.SourceAddress, states[move.DestinationWorkspace], move.DestinationAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remediate state for %v: %w", move, err)
+		}
+		if move.Type == state.OPERATION_RENAME {
+			// the rename already wrote its moved block; later moves only need to find the block under its new name,
+			// and blocks declared by earlier moves must address it by that name
+			workspaces[move.DestinationWorkspace].rename(move.SourceAddress, move.DestinationAddress)
+			remediations = append(remediations, &remediation{move: move, resources: movedAddresses(moved, move.DestinationAddress)})
+			continue
+		}
+		addresses, err := workspaces[move.DestinationWorkspace].declare(workspaces[move.SourceWorkspace], move, moved)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remediate state for %v: %w", move, err)
+		}
+		remediations = append(remediations, &remediation{move: move, resources: addresses})
+	}
+	for _, ws := range wsmgr.Workspaces {
+		if err := workspaces[ws.Uuid].removeInstanceMoves(states[ws.Uuid]); err != nil {
+			return nil, fmt.Errorf("failed to remediate state for workspace %s: %w", ws.Abspath, err)
+		}
+	}
+
+	for _, ws := range wsmgr.Workspaces {
+		files := workspaces[ws.Uuid].render()
+		if len(files) == 0 {
+			continue
+		}
+		for _, name := range []string{REMOVED_FILE_NAME, IMPORTS_FILE_NAME, MOVED_FILE_NAME} {
+			if len(files[name]) == 0 {
+				continue
+			}
+			path := filepath.Join(ws.Abspath, name)
+			contents, err := appendBlocks(path, files[name])
+			if err != nil {
+				return nil, fmt.Errorf("failed to write %s: %w", path, err)
+			}
+			tx.Write(path, contents)
+			fmt.Fprintf(out, "wrote %s\n", path)
+			if n := workspaces[ws.Uuid].unverified(); name == IMPORTS_FILE_NAME && n > 0 {
+				fmt.Fprintf(out, "warning: %d import id(s) in %s were read from the id attribute in state, which not every resource type is imported by; check the blocks marked in it before planning\n", n, path)
+			}
+		}
+	}
+
+	return remediations, nil
+}
@@ -0,0 +1,134 @@
+package finalize
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/msarfaty/tuf/internal/testutils"
+	"github.com/msarfaty/tuf/pkg/state"
+	"github.com/msarfaty/tuf/pkg/tfstate"
+)
+
+func TestDeclare(t *testing.T) {
+	type move struct {
+		from    int
+		address string
+		to      int
+		dest    string
+	}
+	tests := []struct {
+		name    string
+		moves   []move
+		want    [3]map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "removes from the source and imports into the destination",
+			moves: []move{{0, "aws_iam_role.each", 1, "aws_iam_role.each"}},
+			want: [3]map[string]string{
+				{REMOVED_FILE_NAME: "removed {\n  from = aws_iam_role.each\n\n  lifecycle {\n    destroy = false\n  }\n}\n"},
+				{IMPORTS_FILE_NAME: UNVERIFIED_IMPORT_COMMENT + "\nimport {\n  to = aws_iam_role.each[\"blue\"]\n  id = \"role-$${blue}\"\n}\n"},
+				{},
+			},
+		},
+		{
+			name: "imports chained moves straight into the last workspace",
+			moves: []move{
+				{0, "module.eks", 1, "module.eks"},
+				{1, "module.eks", 2, "module.cluster"},
+			},
+			want: [3]map[string]string{
+				{REMOVED_FILE_NAME: "removed {\n  from = module.eks\n\n  lifecycle {\n    destroy = false\n  }\n}\n"},
+				{},
+				{IMPORTS_FILE_NAME: UNVERIFIED_IMPORT_COMMENT + "\nimport {\n  to = module.cluster.aws_eks_cluster.this\n  id = \"eks\"\n}\n"},
+			},
+		},
+		{
+			name:  "writes moved blocks for moves within a workspace",
+			moves: []move{{0, "aws_iam_role.each", 0, "aws_iam_role.this"}},
+			want: [3]map[string]string{
+				{MOVED_FILE_NAME: "moved {\n  from = aws_iam_role.each\n  to   = aws_iam_role.this\n}\n"},
+				{},
+				{},
+			},
+		},
+		{
+			name:  "does not declare data sources",
+			moves: []move{{0, "data.aws_iam_role.foo", 1, "data.aws_iam_role.foo"}},
+			want:  [3]map[string]string{{}, {}, {}},
+		},
+		{
+			name: "removes a block once every instance of it was moved",
+			moves: []move{
+				{0, "aws_iam_role.counted[1]", 1, "aws_iam_role.counted[1]"},
+				{0, "aws_iam_role.counted[0]", 1, "aws_iam_role.counted[0]"},
+			},
+			want: [3]map[string]string{
+				{REMOVED_FILE_NAME: "removed {\n  from = aws_iam_role.counted\n\n  lifecycle {\n    destroy = false\n  }\n}\n"},
+				{IMPORTS_FILE_NAME: UNVERIFIED_IMPORT_COMMENT + "\nimport {\n  to = aws_iam_role.counted[1]\n  id = \"role-1\"\n}\n\n" +
+					UNVERIFIED_IMPORT_COMMENT + "\nimport {\n  to = aws_iam_role.counted[0]\n  id = \"role-0\"\n}\n"},
+				{},
+			},
+		},
+		{
+			name:    "refuses to remove a block with instances left in the source",
+			moves:   []move{{0, "aws_iam_role.counted[0]", 1, "aws_iam_role.counted[0]"}},
+			want:    [3]map[string]string{{}, {}, {}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wsmgr := state.NewWorkspaceMgr()
+			states := map[string]*tfstate.State{}
+			for range 3 {
+				dir := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": ""}})
+				if err := wsmgr.AddWorkspace(dir); err != nil {
+					t.Fatal(err)
+				}
+				states[wsmgr.Workspaces[len(wsmgr.Workspaces)-1].Uuid] = &tfstate.State{Version: 4, Resources: []*tfstate.Resource{}}
+			}
+			states[wsmgr.Workspaces[0].Uuid].Resources = []*tfstate.Resource{
+				{Mode: tfstate.MODE_MANAGED, Type: "aws_iam_role", Name: "each", Each: "map", Instances: json.RawMessage(`[{"index_key":"blue","attributes":{"id":"role-${blue}"}}]`)},
+				{Mode: tfstate.MODE_MANAGED, Type: "aws_iam_role", Name: "counted", Each: "list", Instances: json.RawMessage(`[{"index_key":0,"attributes":{"id":"role-0"}},{"index_key":1,"attributes":{"id":"role-1"}}]`)},
+				{Mode: tfstate.MODE_DATA, Type: "aws_iam_role", Name: "foo", Instances: json.RawMessage(`[{"attributes":{"id":"foo"}}]`)},
+				{Module: "module.eks", Mode: tfstate.MODE_MANAGED, Type: "aws_eks_cluster", Name: "this", Instances: json.RawMessage(`[{"attributes":{"id":"eks"}}]`)},
+			}
+			for _, m := range tt.moves {
+				wsmgr.Journal = append(wsmgr.Journal, &state.Operation{
+					Type:                 state.OPERATION_MOVE,
+					SourceWorkspace:      wsmgr.Workspaces[m.from].Uuid,
+					SourceAddress:        m.address,
+					DestinationWorkspace: wsmgr.Workspaces[m.to].Uuid,
+					DestinationAddress:   m.dest,
+				})
+			}
+
+			tx := wsmgr.Begin()
+			_, err := declare(io.Discard, tx, wsmgr, states)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("declare() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if err = tx.Commit(nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, ws := range wsmgr.Workspaces {
+				got := map[string]string{}
+				for _, name := range []string{REMOVED_FILE_NAME, IMPORTS_FILE_NAME, MOVED_FILE_NAME} {
+					if contents, err := os.ReadFile(filepath.Join(ws.Abspath, name)); err == nil {
+						got[name] = string(contents)
+					}
+				}
+				if !reflect.DeepEqual(got, tt.want[i]) {
+					t.Errorf("declare() wrote %v in workspace %d, want %v", got, i, tt.want[i])
+				}
+			}
+		})
+	}
+}
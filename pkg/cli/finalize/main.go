@@ -0,0 +1,217 @@
+package finalize
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/msarfaty/tuf/pkg/file"
+	"github.com/msarfaty/tuf/pkg/parser"
+	"github.com/msarfaty/tuf/pkg/state"
+	"github.com/msarfaty/tuf/pkg/tfstate"
+)
+
+const (
+	// edit the pulled terraform state files directly, leaving them to be pushed
+	STRATEGY_STATE = "state"
+	// write removed blocks in source workspaces and import blocks in destination workspaces (terraform 1.7 or later)
+	STRATEGY_DECLARATIVE = "declarative"
+)
+
+// options for finalizing a tuf migration
+type Options struct {
+	// how terraform state is remediated; defaults to STRATEGY_STATE
+	Strategy string
+	// where the summary of the finalized migration is written
+	Out io.Writer
+	// where the migration is persisted; defaults to the tuf.state found from the current directory
+	State state.State
+}
+
+func (o *Options) validate() error {
+	if o.Strategy == "" {
+		o.Strategy = STRATEGY_STATE
+	}
+	if o.Strategy != STRATEGY_STATE && o.Strategy != STRATEGY_DECLARATIVE {
+		return fmt.Errorf("unknown finalize strategy %s (expected %s or %s)", o.Strategy, STRATEGY_STATE, STRATEGY_DECLARATIVE)
+	}
+
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+
+	if o.State == nil {
+		s, err := state.Discover()
+		if err != nil {
+			return err
+		}
+		o.State = s
+	}
+
+	return nil
+}
+
+// the result of remediating a single recorded move
+type remediation struct {
+	move *state.Operation
+	// the addresses of the resources moved, as they now exist in the destination state
+	resources []string
+}
+
+// pulls the current terraform state for a workspace using the configured pull command
+func pullState(ws *state.Workspace, tm *state.TerraformMetadata) (*tfstate.State, error) {
+	if tm.StatePullCommand == "" {
+		return nil, errors.New("no terraform state pull command was configured during tuf init")
+	}
+
+	cmd := exec.Command("sh", "-c", tm.StatePullCommand)
+	cmd.Dir = ws.Abspath
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("state pull command failed in %s: %w\n%s", ws.Abspath, err, string(output))
+	}
+
+	return tfstate.Read(filepath.Join(ws.Abspath, tm.StateFileName))
+}
+
+// writes a summary of everything that was remediated
+func writeSummary(out io.Writer, wsmgr *state.WorkspaceMgr, remediations []*remediation) {
+	count := 0
+	for _, r := range remediations {
+		count += len(r.resources)
+	}
+	fmt.Fprintf(out, "remediated %d resource(s) from %d move(s)\n", count, len(remediations))
+
+	for _, r := range remediations {
+		src := wsmgr.GetWorkspaceByUuid(r.move.SourceWorkspace)
+		dst := wsmgr.GetWorkspaceByUuid(r.move.DestinationWorkspace)
+		fmt.Fprintf(out, "\n%s:%s -> %s:%s\n", src.Abspath, r.move.SourceAddress, dst.Abspath, r.move.DestinationAddress)
+		if len(r.resources) == 0 {
+			fmt.Fprintln(out, "  (no resources found in state)")
+		}
+		for _, resource := range r.resources {
+			fmt.Fprintf(out, "  %s\n", resource)
+		}
+	}
+}
+
+// finalizes a tuf migration by remediating terraform state for every recorded move
+func TufFinalize(o Options) (err error) {
+	if err := o.validate(); err != nil {
+		return fmt.Errorf("failed to finalize tuf migration: %v", err)
+	}
+
+	unlock, err := o.State.Lock()
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, unlock()) }()
+
+	if op, err := state.Recover(o.State); err != nil {
+		return err
+	} else if op != nil {
+		fmt.Fprintf(o.Out, "finished %v, which was interrupted\n", op)
+	}
+	wsmgr, err := state.Load(o.State)
+	if err != nil {
+		return err
+	}
+	if wsmgr.Completed {
+		return fmt.Errorf("the migration in %s has already been finalized", o.State)
+	}
+
+	states := map[string]*tfstate.State{}
+	for _, ws := range wsmgr.Workspaces {
+		s, err := pullState(ws, wsmgr.TerraformMetadata)
+		if err != nil {
+			return fmt.Errorf("failed to pull state for workspace %s: %w", ws.Abspath, err)
+		}
+		states[ws.Uuid] = s
+	}
+
+	// every remediated state or declaration file is written at once, along with the finalize in the journal
+	tx := wsmgr.Begin()
+	var remediations []*remediation
+	if o.Strategy == STRATEGY_DECLARATIVE {
+		remediations, err = declare(o.Out, tx, wsmgr, states)
+	} else {
+		remediations, err = remediateState(tx, wsmgr, states)
+	}
+	if err != nil {
+		return err
+	}
+	if err = wsmgr.Apply(tx, &state.Operation{Type: state.OPERATION_FINALIZE}); err != nil {
+		return err
+	}
+
+	writeSummary(o.Out, wsmgr, remediations)
+	return nil
+}
+
+// the moves and renames whose blocks have state, in the order they were journaled and checked against the pulled
+// states of their workspaces. A block renamed and then moved is moved under its new name, so renames are replayed
+// between the moves around them. An operation that moved several blocks is remediated block by block. Copies are
+// not remediated; only blocks without managed state can be copied
+func stateMoves(wsmgr *state.WorkspaceMgr, states map[string]*tfstate.State) ([]*state.Operation, error) {
+	ret := []*state.Operation{}
+	moves := []*state.Operation{}
+	for _, op := range wsmgr.Operations(state.OPERATION_MOVE, state.OPERATION_RENAME) {
+		moves = append(moves, op.Moves()...)
+	}
+	for _, move := range moves {
+		if bd, err := parser.New(move.SourceAddress); err == nil && parser.Stateless(bd) {
+			// variables, outputs and locals have nothing in state to remediate
+			continue
+		}
+		if _, ok := states[move.SourceWorkspace]; !ok {
+			return nil, fmt.Errorf("move %v references an untracked source workspace", move)
+		}
+		if _, ok := states[move.DestinationWorkspace]; !ok {
+			return nil, fmt.Errorf("move %v references an untracked destination workspace", move)
+		}
+		ret = append(ret, move)
+	}
+
+	return ret, nil
+}
+
+// applies every move to the pulled terraform states and stages writing the states that changed
+func remediateState(tx *file.Transaction, wsmgr *state.WorkspaceMgr, states map[string]*tfstate.State) ([]*remediation, error) {
+	moves, err := stateMoves(wsmgr, states)
+	if err != nil {
+		return nil, err
+	}
+
+	// apply every move in memory first so that no state is written unless all moves succeed
+	changed := map[string]bool{}
+	remediations := []*remediation{}
+	for _, move := range moves {
+		moved, err := tfstate.Move(states[move.SourceWorkspace], move.SourceAddress, states[move.DestinationWorkspace], move.DestinationAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remediate state for %v: %w", move, err)
+		}
+		if len(moved) > 0 {
+			changed[move.SourceWorkspace] = true
+			changed[move.DestinationWorkspace] = true
+		}
+		remediations = append(remediations, &remediation{move: move, resources: moved})
+	}
+
+	for _, ws := range wsmgr.Workspaces {
+		if !changed[ws.Uuid] {
+			continue
+		}
+		s := states[ws.Uuid]
+		s.Serial++
+		data, err := s.Bytes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to write remediated state for workspace %s: %w", ws.Abspath, err)
+		}
+		tx.Write(filepath.Join(ws.Abspath, wsmgr.TerraformMetadata.StateFileName), data)
+	}
+
+	return remediations, nil
+}
@@ -0,0 +1,196 @@
+package finalize
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/msarfaty/tuf/internal/testutils"
+	"github.com/msarfaty/tuf/pkg/cli/mv"
+	"github.com/msarfaty/tuf/pkg/state"
+	"github.com/msarfaty/tuf/pkg/tfstate"
+)
+
+const countedState = `{"version": 4, "resources": [
+  {"mode": "managed", "type": "aws_iam_role", "name": "this", "provider": "provider[\"registry.terraform.io/hashicorp/aws\"]", "instances": [
+    {"index_key": 0, "attributes": {"id": "role-0"}},
+    {"index_key": 1, "attributes": {"id": "role-1"}}
+  ]}
+]}
+`
+
+// tracks a migration between workspace a, holding the counted aws_iam_role.this in its code and state, and an empty
+// workspace b, returning both workspaces and the state of the migration
+func setupFinalize(t *testing.T) (string, string, state.State) {
+	a := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{
+		"main.tf":           "resource \"aws_iam_role\" \"this\" {\n  count = 2\n}\n",
+		"terraform.tfstate": countedState,
+	}})
+	b := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{
+		"main.tf":           "",
+		"terraform.tfstate": `{"version": 4, "resources": []}`,
+	}})
+	s, err := state.NewDiskState(filepath.Join(t.TempDir(), state.TUF_STATE_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsmgr := state.NewWorkspaceMgr()
+	for _, ws := range []string{a, b} {
+		if err := wsmgr.AddWorkspace(ws); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wsmgr.TerraformMetadata = &state.TerraformMetadata{StatePullCommand: "true", StateFileName: "terraform.tfstate"}
+	if err := wsmgr.Create(s); err != nil {
+		t.Fatal(err)
+	}
+
+	return a, b, s
+}
+
+func TestTufFinalize(t *testing.T) {
+	tests := []struct {
+		name string
+		// the addresses moved with tuf mv, in order
+		addresses []string
+		// the number of instances of aws_iam_role.this in the source and destination states once finalized
+		wantSrc   int
+		wantDst   int
+		wantMvErr bool
+	}{
+		{
+			name:      "moves every instance of a counted resource",
+			addresses: []string{"aws_iam_role.this"},
+			wantSrc:   0,
+			wantDst:   2,
+		},
+		{
+			name:      "moves every instance of the resources matched by a selector",
+			addresses: []string{"aws_iam_*.*"},
+			wantSrc:   0,
+			wantDst:   2,
+		},
+		{
+			name:      "moves the code and a single instance of a counted resource",
+			addresses: []string{"aws_iam_role.this[0]"},
+			wantSrc:   1,
+			wantDst:   1,
+		},
+		{
+			name:      "moves the instances of a counted resource one at a time",
+			addresses: []string{"aws_iam_role.this[1]", "aws_iam_role.this[0]"},
+			wantSrc:   0,
+			wantDst:   2,
+		},
+		{
+			name:      "refuses to move an instance of a resource that was moved whole",
+			addresses: []string{"aws_iam_role.this", "aws_iam_role.this[0]"},
+			wantSrc:   0,
+			wantDst:   2,
+			wantMvErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b, s := setupFinalize(t)
+
+			var err error
+			for _, address := range tt.addresses {
+				err = errors.Join(err, mv.TufMv(mv.Options{Source: a + ":" + address, Destination: b + ":" + address, Out: io.Discard, State: s}))
+			}
+			if (err != nil) != tt.wantMvErr {
+				t.Fatalf("TufMv() error = %v, wantErr %v", err, tt.wantMvErr)
+			}
+			// the code of the block is moved once, whichever instance is moved first
+			if contents, _ := os.ReadFile(filepath.Join(b, "resources.tuf.tf")); string(contents) != "resource \"aws_iam_role\" \"this\" {\n  count = 2\n}\n" {
+				t.Errorf("TufMv() moved %s, want the block moved once", contents)
+			}
+			if err = TufFinalize(Options{Out: io.Discard, State: s}); err != nil {
+				t.Fatalf("TufFinalize() error = %v", err)
+			}
+
+			for ws, want := range map[string]int{a: tt.wantSrc, b: tt.wantDst} {
+				tfs, err := tfstate.Read(filepath.Join(ws, "terraform.tfstate"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := 0
+				for _, r := range tfs.Resources {
+					if r.Address() != "aws_iam_role.this" {
+						continue
+					}
+					instances := []any{}
+					if err := json.Unmarshal(r.Instances, &instances); err != nil {
+						t.Fatal(err)
+					}
+					got += len(instances)
+				}
+				if got != want {
+					t.Errorf("TufFinalize() left %d instance(s) of aws_iam_role.this in %s, want %d", got, ws, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTufFinalize_Rename(t *testing.T) {
+	renameThenMove := [][2]string{{"a:aws_iam_role.this", "a:aws_iam_role.renamed"}, {"a:aws_iam_role.renamed", "b:aws_iam_role.renamed"}}
+	moveThenRename := [][2]string{{"a:aws_iam_role.this", "b:aws_iam_role.this"}, {"b:aws_iam_role.this", "b:aws_iam_role.renamed"}}
+	tests := []struct {
+		name     string
+		strategy string
+		// the moves made with tuf mv, in order, as targets in workspace a or b
+		moves [][2]string
+		// the file of the destination workspace that hands the instances of the renamed resource over
+		wantFile string
+	}{
+		{name: "moves the state of a resource renamed before it is moved", strategy: STRATEGY_STATE, moves: renameThenMove, wantFile: "terraform.tfstate"},
+		{name: "imports a resource renamed before it is moved", strategy: STRATEGY_DECLARATIVE, moves: renameThenMove, wantFile: IMPORTS_FILE_NAME},
+		{name: "moves the state of a resource renamed after it is moved", strategy: STRATEGY_STATE, moves: moveThenRename, wantFile: "terraform.tfstate"},
+		{name: "imports a resource renamed after it is moved", strategy: STRATEGY_DECLARATIVE, moves: moveThenRename, wantFile: IMPORTS_FILE_NAME},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b, s := setupFinalize(t)
+
+			workspaces := map[string]string{"a": a, "b": b}
+			for _, move := range tt.moves {
+				src, dst := strings.SplitN(move[0], ":", 2), strings.SplitN(move[1], ":", 2)
+				if err := mv.TufMv(mv.Options{Source: workspaces[src[0]] + ":" + src[1], Destination: workspaces[dst[0]] + ":" + dst[1], Out: io.Discard, State: s}); err != nil {
+					t.Fatalf("TufMv() error = %v", err)
+				}
+			}
+			if err := TufFinalize(Options{Strategy: tt.strategy, Out: io.Discard, State: s}); err != nil {
+				t.Fatalf("TufFinalize() error = %v", err)
+			}
+
+			contents, err := os.ReadFile(filepath.Join(b, tt.wantFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []string{"role-0", "role-1"} {
+				if !strings.Contains(string(contents), want) {
+					t.Errorf("TufFinalize() did not hand %s over to %s:\n%s", want, tt.wantFile, contents)
+				}
+			}
+			if tt.strategy == STRATEGY_DECLARATIVE {
+				if strings.Contains(string(contents), "aws_iam_role.this") || !strings.Contains(string(contents), "to = aws_iam_role.renamed[0]") {
+					t.Errorf("TufFinalize() imported into %s:\n%s, want aws_iam_role.renamed", tt.wantFile, contents)
+				}
+			}
+			if tt.strategy == STRATEGY_STATE {
+				tfs, err := tfstate.Read(filepath.Join(b, "terraform.tfstate"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(tfs.Resources) != 1 || tfs.Resources[0].Address() != "aws_iam_role.renamed" {
+					t.Errorf("TufFinalize() left %v in the destination state, want aws_iam_role.renamed", tfs.Resources)
+				}
+			}
+		})
+	}
+}
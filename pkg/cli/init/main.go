@@ -12,6 +12,8 @@ type Options struct {
 	TerraformStatePullCommand string
 	Workspaces                []string
 	StateFileName             string
+	// where the migration is persisted; defaults to tuf.state in the current directory
+	State state.State
 }
 
 func (o *Options) validate() error {
@@ -23,15 +25,31 @@ func (o *Options) validate() error {
 		return errors.New("must provide the statefile name that the pull command outputs to")
 	}
 
+	if o.State == nil {
+		s, err := state.NewDiskState(state.TUF_STATE_FILE)
+		if err != nil {
+			return err
+		}
+		o.State = s
+	}
+
 	return nil
 }
 
 // initializes a tuf migration using the given options
-func TufInit(o Options) error {
-	err := o.validate()
+func TufInit(o Options) (err error) {
+	err = o.validate()
 	if err != nil {
 		return fmt.Errorf("failed to initialize new tuf migration: %v", err)
 	}
+
+	// the state is written and snapshotted while locked, so no other tuf process can see it half created
+	unlock, err := o.State.Lock()
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, unlock()) }()
+
 	wsmgr := state.NewWorkspaceMgr()
 
 	for _, workspacePath := range o.Workspaces {
@@ -45,7 +63,21 @@ func TufInit(o Options) error {
 		StateFileName:    o.StateFileName,
 	}
 
-	if err = wsmgr.WriteToDisk(); err != nil {
+	if err = wsmgr.Create(o.State); err != nil {
+		return err
+	}
+
+	// keep the initial contents of every workspace so that the migration can be aborted
+	for _, ws := range wsmgr.Workspaces {
+		if err = wsmgr.Snapshot(ws); err != nil {
+			return errors.Join(fmt.Errorf("failed to snapshot workspace %s: %w", ws.Abspath, err), o.State.Remove())
+		}
+		if err = wsmgr.SnapshotStateFile(ws); err != nil {
+			return errors.Join(fmt.Errorf("failed to snapshot workspace %s: %w", ws.Abspath, err), o.State.Remove())
+		}
+	}
+
+	if err = wsmgr.Record(&state.Operation{Type: state.OPERATION_INIT}); err != nil {
 		return err
 	}
 
@@ -0,0 +1,186 @@
+package mv
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+
+	"github.com/msarfaty/tuf/pkg/parser"
+	"github.com/msarfaty/tuf/pkg/state"
+)
+
+// whether a move addresses instances rather than whole blocks, failing unless the instances keep their keys. The
+// addressed block keeps its own key, as does every module call the source and destination share, while module calls
+// that only one side passes through may be keyed freely. Code is always moved a whole block at a time, while the keys
+// are kept so that finalize moves the state of the addressed instances alone
+func checkInstanceKeys(src *target, dst *target) (bool, error) {
+	srcBd, err := parser.New(src.address)
+	if err != nil {
+		return false, fmt.Errorf("invalid source: %w", err)
+	}
+	dstBd, err := parser.New(dst.address)
+	if err != nil {
+		return false, fmt.Errorf("invalid destination: %w", err)
+	}
+	if srcBd.InstanceKey() != dstBd.InstanceKey() {
+		return false, fmt.Errorf("cannot move %s to %s; instances keep their instance keys when they are moved", src.address, dst.address)
+	}
+	// module calls in different workspaces are never the same call, however they are named
+	srcPath, dstPath := srcBd.ModulePath(), dstBd.ModulePath()
+	if !sameWorkspace(src.workspace, dst.workspace) {
+		srcPath, dstPath = nil, nil
+	}
+	for i := 0; i < len(srcPath) && i < len(dstPath) && srcPath[i].Name == dstPath[i].Name; i++ {
+		if srcPath[i].Key != dstPath[i].Key {
+			return false, fmt.Errorf("cannot move %s to %s; instances keep the instance keys of %s when they are moved", src.address, dst.address, &parser.ModuleCall{Name: srcPath[i].Name})
+		}
+	}
+
+	if srcBd.InstanceKey() != "" {
+		return true, nil
+	}
+	return slices.ContainsFunc(srcBd.ModulePath(), func(mc *parser.ModuleCall) bool { return mc.Key != "" }), nil
+}
+
+// whether two workspace paths refer to the same directory
+func sameWorkspace(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
+
+// finds the move that already moved the code of the block an instance address refers to between the same
+// workspaces, so that the instance only has its state left to move; nil if the block has not been moved
+func movedBlock(wsmgr *state.WorkspaceMgr, srcWs *state.Workspace, dstWs *state.Workspace, address string) (*state.Operation, error) {
+	config, err := parser.ConfigAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range wsmgr.BlockMoves() {
+		if op.SourceWorkspace != srcWs.Uuid || op.DestinationWorkspace != dstWs.Uuid || !op.ChangesSource() {
+			continue
+		}
+		moved, err := parser.ConfigAddress(op.SourceAddress)
+		if err != nil || moved != config {
+			continue
+		}
+		if op.SourceAddress == moved {
+			return nil, fmt.Errorf("%s was already moved along with every instance of it by %s", address, op.Id)
+		}
+		return op, nil
+	}
+
+	return nil, nil
+}
+
+// records moving an instance whose block was already moved by an earlier move. No file changes, so only the
+// state of the instance is moved when the migration is finalized
+func moveInstance(o Options, wsmgr *state.WorkspaceMgr, srcWs *state.Workspace, src *target, dstWs *state.Workspace, dst *target, earlier *state.Operation) error {
+	fmt.Fprintf(o.Out, "%s was moved by %s; recording a move of the state of %s alone\n", earlier.SourceAddress, earlier.Id, src.address)
+	if o.DryRun {
+		return nil
+	}
+
+	op := &state.Operation{
+		Type:                 state.OPERATION_MOVE,
+		SourceWorkspace:      srcWs.Uuid,
+		SourceAddress:        src.address,
+		DestinationWorkspace: dstWs.Uuid,
+		DestinationAddress:   dst.address,
+	}
+	if err := wsmgr.Apply(wsmgr.Begin(), op); err != nil {
+		return fmt.Errorf("failed to move %s: %w", src.address, err)
+	}
+
+	return nil
+}
+
+// whether instances of the block an instance address refers to are left in the source workspace once the address
+// and every instance moved out before it have been moved. The instances are evaluated from the count and for_each of
+// the block, found where it is now, and of the module calls along the way; ok is false if they cannot be
+func instancesLeft(wsmgr *state.WorkspaceMgr, srcWs *state.Workspace, src *target, dstWs *state.Workspace, earlier *state.Operation) (bool, bool, error) {
+	config, err := parser.ConfigAddress(src.address)
+	if err != nil {
+		return false, false, err
+	}
+	path, block, err := parser.SplitModulePath(config)
+	if err != nil {
+		return false, false, err
+	}
+
+	// every instance address of the block, built up one module call at a time
+	all := []string{""}
+	for i, mc := range path {
+		keys, ok, err := parser.InstanceKeys(srcWs.Abspath, parser.ModulePathString(path[:i+1]))
+		if err != nil || !ok {
+			return false, ok, err
+		}
+		all = expandInstances(all, mc.String(), keys)
+	}
+	dir, address := srcWs.Abspath, config
+	if earlier != nil {
+		dir, address = dstWs.Abspath, earlier.DestinationAddress
+	}
+	keys, ok, err := parser.InstanceKeys(dir, address)
+	if err != nil || !ok {
+		return false, ok, err
+	}
+	all = expandInstances(all, block, keys)
+
+	moved := map[string]bool{}
+	for _, op := range append(wsmgr.BlockMoves(), &state.Operation{SourceWorkspace: srcWs.Uuid, SourceAddress: src.address}) {
+		if other, err := parser.ConfigAddress(op.SourceAddress); err != nil || op.SourceWorkspace != srcWs.Uuid || other != config {
+			continue
+		}
+		if a, err := parser.ParseAddress(op.SourceAddress); err == nil {
+			moved[a.String()] = true
+		}
+	}
+	for _, instance := range all {
+		if a, err := parser.ParseAddress(instance); err != nil || !moved[a.String()] {
+			return true, true, nil
+		}
+	}
+
+	return false, true, nil
+}
+
+// appends a part of an address with each of the given instance keys to every address
+func expandInstances(addresses []string, part string, keys []string) []string {
+	ret := []string{}
+	for _, address := range addresses {
+		for _, key := range keys {
+			if address == "" {
+				ret = append(ret, part+key)
+			} else {
+				ret = append(ret, address+"."+part+key)
+			}
+		}
+	}
+	return ret
+}
+
+// warns that the other instances of a block are left in the state of the source workspace until they are moved. No
+// warning is written once every instance has been moved, and the warning is hedged when tuf cannot tell how many
+// instances the block has
+func writeInstanceWarning(out io.Writer, wsmgr *state.WorkspaceMgr, srcWs *state.Workspace, src *target, dstWs *state.Workspace, earlier *state.Operation) {
+	config, err := parser.ConfigAddress(src.address)
+	if err != nil {
+		config = src.address
+	}
+	left, ok, err := instancesLeft(wsmgr, srcWs, src, dstWs, earlier)
+	switch {
+	case err == nil && ok && !left:
+		return
+	case err == nil && ok:
+		fmt.Fprintf(out, "warning: finalize moves the state of %s alone; move every other instance of %s the same way, or terraform will plan to destroy them in %s\n",
+			src.address, config, srcWs.Abspath)
+	default:
+		fmt.Fprintf(out, "warning: finalize moves the state of %s alone; if %s has other instances, move them the same way, or terraform will plan to destroy them in %s\n",
+			src.address, config, srcWs.Abspath)
+	}
+}
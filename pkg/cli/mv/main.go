@@ -0,0 +1,527 @@
+package mv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/msarfaty/tuf/pkg/file"
+	"github.com/msarfaty/tuf/pkg/parser"
+	"github.com/msarfaty/tuf/pkg/state"
+)
+
+// separates the workspace path from the address in a move target (ie /path/to/a:module.example)
+const TARGET_SEPARATOR = ":"
+
+// options for moving blocks between workspaces
+type Options struct {
+	// the source of the move, formatted as workspace:address
+	Source string
+	// the destination of the move, formatted as workspace:address
+	Destination string
+	// print the diff of the move instead of writing it
+	DryRun bool
+	// copy the block, leaving the source intact; only data sources, variables, outputs and locals can be copied
+	Copy bool
+	// copy aliased provider configurations the moved blocks use into the destination if they are missing there
+	CopyProviders bool
+	// how the files blocks are moved into are named (see parser.NAMING_DESCRIPTION); defaults to naming them by the kind of block
+	Naming string
+	// a single file in the destination module that every block is moved into; cannot be used with Naming
+	FileName string
+	// where dry run diffs, matched blocks and warnings are written
+	Out io.Writer
+	// where the migration is persisted; defaults to the tuf.state found from the current directory
+	State state.State
+}
+
+// a parsed workspace:address pair
+type target struct {
+	workspace string
+	address   string
+}
+
+func (o *Options) validate() error {
+	if o.Source == "" {
+		return errors.New("must provide a source to move from")
+	}
+
+	if o.Destination == "" {
+		return errors.New("must provide a destination to move to")
+	}
+
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+
+	if o.State == nil {
+		s, err := state.Discover()
+		if err != nil {
+			return err
+		}
+		o.State = s
+	}
+
+	return nil
+}
+
+// parses an address or selector, as the address of a move target
+func parseTargetAddress(address string) error {
+	if parser.IsSelector(address) {
+		_, err := parser.NewSelector(address)
+		return err
+	}
+	_, err := parser.ParseAddress(address)
+	return err
+}
+
+// parses a workspace:address pair. Both workspace paths and the quoted instance keys of addresses may contain the
+// separator, so the address starts after the first separator that is followed by a complete address or selector.
+// if there is none, the address is taken to start after the last separator outside of brackets and its error reported
+func parseTarget(raw string) (*target, error) {
+	if !strings.Contains(raw, TARGET_SEPARATOR) {
+		return nil, fmt.Errorf("target %s is not formatted as workspace%saddress", raw, TARGET_SEPARATOR)
+	}
+
+	split := func(idx int) *target {
+		return &target{workspace: raw[:idx], address: raw[idx+len(TARGET_SEPARATOR):]}
+	}
+	fallback, depth := -1, 0
+	var t *target
+	for idx := 0; idx < len(raw) && t == nil; idx++ {
+		switch {
+		case raw[idx] == '[':
+			depth++
+		case raw[idx] == ']' && depth > 0:
+			depth--
+		case strings.HasPrefix(raw[idx:], TARGET_SEPARATOR):
+			if parseTargetAddress(split(idx).address) == nil {
+				t = split(idx)
+			} else if depth == 0 {
+				fallback = idx
+			}
+		}
+	}
+	if t == nil && fallback >= 0 {
+		t = split(fallback)
+	}
+	if t == nil {
+		return nil, fmt.Errorf("target %s is not formatted as workspace%saddress", raw, TARGET_SEPARATOR)
+	}
+
+	if t.workspace == "" {
+		return nil, fmt.Errorf("target %s is missing a workspace", raw)
+	}
+	if t.address == "" {
+		return nil, fmt.Errorf("target %s is missing an address", raw)
+	}
+	if err := parseTargetAddress(t.address); err != nil {
+		return nil, fmt.Errorf("target %s has an invalid address: %w", raw, err)
+	}
+
+	return t, nil
+}
+
+// finds the tracked workspace for a target, failing if the workspace is not a part of the migration
+func trackedWorkspace(wsmgr *state.WorkspaceMgr, t *target) (*state.Workspace, error) {
+	ws, err := wsmgr.GetWorkspaceByPath(t.workspace)
+	if err != nil {
+		return nil, err
+	}
+	if ws == nil {
+		return nil, fmt.Errorf("workspace %s is not tracked in %s; add it with tuf init", t.workspace, state.TUF_STATE_FILE)
+	}
+
+	return ws, nil
+}
+
+// resolves the directory of the module at the end of a module path, failing if tuf does not track its files
+func moduleDirectory(ws *state.Workspace, path []*parser.ModuleCall) (string, error) {
+	dir, err := parser.ResolveModuleDirectory(ws.Abspath, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to find module directory in workspace %s: %w", ws.Abspath, err)
+	}
+	if !ws.TracksDirectory(dir) {
+		return "", fmt.Errorf("module directory %s is not tracked with workspace %s; only local modules within a workspace can be changed", dir, ws.Abspath)
+	}
+
+	return dir, nil
+}
+
+// reads the migration for a dry run, which writes nothing and so takes no lock and leaves an interrupted operation to
+// be recovered by the next command that changes the migration. The dry run plans against the files as they are, so a
+// pending operation is reported since recovering it may change them
+func readMigration(o Options) (*state.WorkspaceMgr, error) {
+	pending, err := state.Pending(o.State)
+	if err != nil {
+		return nil, err
+	}
+	wsmgr, err := state.Read(o.State)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil && pending.Operation != nil && slices.ContainsFunc(wsmgr.Journal, func(recorded *state.Operation) bool { return recorded.Id == pending.Operation.Id }) {
+		// only the transaction journal was left behind
+		pending = nil
+	}
+	if pending == nil {
+		if err = wsmgr.Validate(); err != nil {
+			return nil, fmt.Errorf("tracked workspaces have changed outside of tuf: %w", err)
+		}
+		return wsmgr, nil
+	}
+
+	what := "an operation"
+	if pending.Operation != nil {
+		what = fmt.Sprintf("%v", pending.Operation)
+	}
+	if pending.Committed {
+		fmt.Fprintf(o.Out, "pending: %s wrote its files but was not recorded; tuf mv will finish it before moving, so the files planned against may change\n", what)
+	} else {
+		fmt.Fprintf(o.Out, "pending: %s was staging its files; tuf mv will discard them before moving\n", what)
+	}
+	return wsmgr, nil
+}
+
+// moves a block between tracked workspaces using the given options
+func TufMv(o Options) (err error) {
+	if err := o.validate(); err != nil {
+		return fmt.Errorf("failed to move block: %v", err)
+	}
+
+	src, err := parseTarget(o.Source)
+	if err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+	dst, err := parseTarget(o.Destination)
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+
+	// blocks may move between modules keeping their own address, or be renamed within their workspace
+	srcPath, srcBlock, err := parser.SplitModulePath(src.address)
+	if err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+	dstPath, dstBlock, err := parser.SplitModulePath(dst.address)
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+	isRename := srcBlock != dstBlock
+	selector := parser.IsSelector(src.address)
+	if isRename && selector {
+		return fmt.Errorf("cannot rename the blocks matched by a selector (%s != %s)", srcBlock, dstBlock)
+	}
+	// instance addresses (ie aws_iam_role.this[0]) move the code of their whole block and the state of the instance
+	keyed := false
+	if !selector {
+		if _, err = parser.New(src.address); err != nil {
+			return err
+		}
+		if keyed, err = checkInstanceKeys(src, dst); err != nil {
+			return err
+		}
+	} else if _, err = parser.NewSelector(src.address); err != nil {
+		return err
+	}
+	if keyed && isRename {
+		return fmt.Errorf("cannot rename %s; renaming covers every instance of a block, so address it without instance keys", src.address)
+	}
+
+	var wsmgr *state.WorkspaceMgr
+	if o.DryRun {
+		if wsmgr, err = readMigration(o); err != nil {
+			return err
+		}
+	} else {
+		var unlock func() error
+		if unlock, err = o.State.Lock(); err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, unlock()) }()
+
+		if op, err := state.Recover(o.State); err != nil {
+			return err
+		} else if op != nil {
+			fmt.Fprintf(o.Out, "finished %v, which was interrupted\n", op)
+		}
+		if wsmgr, err = state.Load(o.State); err != nil {
+			return err
+		}
+	}
+	srcWs, err := trackedWorkspace(wsmgr, src)
+	if err != nil {
+		return err
+	}
+	dstWs, err := trackedWorkspace(wsmgr, dst)
+	if err != nil {
+		return err
+	}
+
+	if wsmgr.Completed {
+		return fmt.Errorf("the migration in %s has already been finalized", o.State)
+	}
+	if isRename {
+		return rename(o, wsmgr, srcWs, src, dstWs, dst)
+	}
+	if keyed {
+		// the first instance of a block moves its code; the rest only have their state left to move
+		earlier, err := movedBlock(wsmgr, srcWs, dstWs, src.address)
+		if err != nil {
+			return err
+		}
+		if earlier != nil {
+			writeInstanceWarning(o.Out, wsmgr, srcWs, src, dstWs, earlier)
+			return moveInstance(o, wsmgr, srcWs, src, dstWs, dst, earlier)
+		}
+	}
+
+	// the source module directory is resolved again while moving; this only ensures it is tracked
+	if _, err = moduleDirectory(srcWs, srcPath); err != nil {
+		return err
+	}
+	dstDir, err := moduleDirectory(dstWs, dstPath)
+	if err != nil {
+		return err
+	}
+
+	// every move is planned before anything is written, so a selector either moves every block it matches or none
+	results, err := parser.MoveHclBlocks(&parser.MoveOptions{
+		Address:       src.address,
+		FromDirectory: srcWs.Abspath,
+		ToDirectory:   dstDir,
+		DryRun:        true,
+		Copy:          o.Copy,
+		CopyProviders: o.CopyProviders,
+		Naming:        o.Naming,
+		FileName:      o.FileName,
+	})
+	if errors.Is(err, parser.ErrMissingProvider) {
+		return fmt.Errorf("%w; pass --copy-providers to copy it", err)
+	}
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		if o.Copy && !result.IsDependency() {
+			if err = checkCopyable(result.Address); err != nil {
+				return err
+			}
+		}
+		if err = checkModuleDirectory(srcWs, dstWs, result); err != nil {
+			return err
+		}
+	}
+	if selector {
+		writeMatches(o.Out, srcWs, src.address, results)
+	}
+	writeNotes(o.Out, dstWs, results)
+	if keyed {
+		writeInstanceWarning(o.Out, wsmgr, srcWs, src, dstWs, nil)
+	}
+	if o.DryRun {
+		return writeDiffs(o.Out, mergeEdits(results))
+	}
+
+	// keep the pre-move contents of both workspaces so the move can be undone
+	for _, ws := range []*state.Workspace{srcWs, dstWs} {
+		if err = wsmgr.Snapshot(ws); err != nil {
+			return fmt.Errorf("failed to snapshot workspace %s: %w", ws.Abspath, err)
+		}
+	}
+	op, err := moveOperation(srcWs, src, dstWs, dst, dstPath, results, o.Copy, selector)
+	if err != nil {
+		return err
+	}
+	// every file is written at once, so a failure never leaves a block in both workspaces or a selector half done
+	tx := wsmgr.Begin()
+	parser.StageEdits(tx, mergeEdits(results))
+	if err = wsmgr.Apply(tx, op); err != nil {
+		return fmt.Errorf("failed to move %s: %w", src.address, err)
+	}
+
+	return nil
+}
+
+// fails unless the block at the address can safely exist in two workspaces at once
+func checkCopyable(address string) error {
+	bd, err := parser.New(address)
+	if err != nil {
+		return err
+	}
+	if _, ok := bd.(*parser.DataBlockDescription); !ok && !parser.Stateless(bd) {
+		// a copied resource or module would be managed by two workspaces at once
+		return fmt.Errorf("only data sources, variables, outputs and locals can be copied (%s is none of these)", address)
+	}
+
+	return nil
+}
+
+// fails if a module block is moved out of the workspace that tracks its local module. The moved block would call
+// the module in the source workspace, where its files would stay tracked and could still be changed by later moves
+func checkModuleDirectory(srcWs *state.Workspace, dstWs *state.Workspace, result *parser.MoveResult) error {
+	if result.ModuleDirectory == "" || srcWs == dstWs || !srcWs.TracksDirectory(result.ModuleDirectory) {
+		return nil
+	}
+	name, err := srcWs.RelativeName(result.ModuleDirectory)
+	if err != nil {
+		name = result.ModuleDirectory
+	}
+
+	return fmt.Errorf("cannot move %s out of workspace %s; it calls the local module %s, which stays tracked with that workspace", result.Address, srcWs.Abspath, name)
+}
+
+// lists every provider configuration and requirement that will be copied along with the moved blocks, and any warnings
+func writeNotes(out io.Writer, ws *state.Workspace, results []*parser.MoveResult) {
+	for _, result := range results {
+		if result.Provider != nil {
+			name, err := ws.RelativeName(result.To.Filename)
+			if err != nil {
+				name = result.To.Filename
+			}
+			fmt.Fprintf(out, "copying provider %s into %s\n", result.Provider, name)
+		}
+		if result.RequiredProvider != "" {
+			name, err := ws.RelativeName(result.To.Filename)
+			if err != nil {
+				name = result.To.Filename
+			}
+			fmt.Fprintf(out, "adding provider %s to the required providers in %s\n", result.RequiredProvider, name)
+		}
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(out, "warning: %s\n", warning)
+		}
+	}
+}
+
+// lists every block a selector matched, before anything is written
+func writeMatches(out io.Writer, ws *state.Workspace, pattern string, results []*parser.MoveResult) {
+	blocks := []*parser.MoveResult{}
+	for _, result := range results {
+		if !result.IsDependency() {
+			blocks = append(blocks, result)
+		}
+	}
+	fmt.Fprintf(out, "%s matched %d block(s):\n", pattern, len(blocks))
+	for _, result := range blocks {
+		name, err := ws.RelativeName(result.From.Filename)
+		if err != nil {
+			name = result.From.Filename
+		}
+		fmt.Fprintf(out, "  %s (%s)\n", result.Address, name)
+	}
+}
+
+// combines the edits of consecutive moves into a single edit per file, from its contents before
+// the first move to its contents after the last
+func mergeEdits(results []*parser.MoveResult) []*parser.FileEdit {
+	ret := []*parser.FileEdit{}
+	byName := map[string]*parser.FileEdit{}
+	for _, result := range results {
+		for _, edit := range result.Edits {
+			if merged, ok := byName[edit.Filename]; ok {
+				merged.After = edit.After
+				continue
+			}
+			merged := &parser.FileEdit{Filename: edit.Filename, Before: edit.Before, After: edit.After}
+			byName[edit.Filename] = merged
+			ret = append(ret, merged)
+		}
+	}
+
+	return ret
+}
+
+// writes a unified diff for every file a move would change, named relative to the current directory
+func writeDiffs(out io.Writer, edits []*parser.FileEdit) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	for _, edit := range edits {
+		name, err := filepath.Rel(cwd, edit.Filename)
+		if err != nil {
+			name = edit.Filename
+		}
+		name = filepath.ToSlash(name)
+		fmt.Fprint(out, file.UnifiedDiff("a/"+name, "b/"+name, edit.Before, edit.After))
+	}
+
+	return nil
+}
+
+// builds the journal entry for the blocks moved (or copied) between workspaces. A selector journals every block it
+// matched along with the files they changed; a single block keeps where it was cut from and pasted to. Provider
+// configurations and requirements copied for the blocks are journaled as other files of the destination
+func moveOperation(srcWs *state.Workspace, src *target, dstWs *state.Workspace, dst *target, dstPath []*parser.ModuleCall, results []*parser.MoveResult, copy bool, selector bool) (*state.Operation, error) {
+	op := &state.Operation{
+		Type:                 state.OPERATION_MOVE,
+		SourceWorkspace:      srcWs.Uuid,
+		SourceAddress:        src.address,
+		DestinationWorkspace: dstWs.Uuid,
+		DestinationAddress:   dst.address,
+	}
+	if copy {
+		op.Type = state.OPERATION_COPY
+	}
+
+	// the files blocks were cut from belong to the source; everything else was written to the destination
+	sourceFiles := map[string]bool{}
+	for _, result := range results {
+		if result.IsDependency() {
+			continue
+		}
+		if !copy {
+			sourceFiles[result.From.Filename] = true
+		}
+		if !selector {
+			srcName, err := srcWs.RelativeName(result.From.Filename)
+			if err != nil {
+				return nil, err
+			}
+			dstName, err := dstWs.RelativeName(result.To.Filename)
+			if err != nil {
+				return nil, err
+			}
+			op.DestinationFile = &state.FileChange{Name: dstName, Range: state.ByteRange{Start: result.To.Start, End: result.To.End}}
+			if !copy {
+				// a copy leaves the source file untouched, so there is nothing to restore there on undo
+				op.SourceFile = &state.FileChange{Name: srcName, Range: state.ByteRange{Start: result.From.Start, End: result.From.End}}
+			}
+			continue
+		}
+
+		_, block, _ := parser.SplitModulePath(result.Address)
+		if len(dstPath) > 0 {
+			block = parser.ModulePathString(dstPath) + "." + block
+		}
+		op.Blocks = append(op.Blocks, &state.MovedBlock{SourceAddress: result.Address, DestinationAddress: block})
+	}
+
+	for _, edit := range mergeEdits(results) {
+		if sourceFiles[edit.Filename] {
+			name, err := srcWs.RelativeName(edit.Filename)
+			if err != nil {
+				return nil, err
+			}
+			if op.SourceFile == nil || op.SourceFile.Name != name {
+				op.SourceOtherFiles = append(op.SourceOtherFiles, &state.FileChange{Name: name})
+			}
+			continue
+		}
+		name, err := dstWs.RelativeName(edit.Filename)
+		if err != nil {
+			return nil, err
+		}
+		if op.DestinationFile == nil || op.DestinationFile.Name != name {
+			op.OtherFiles = append(op.OtherFiles, &state.FileChange{Name: name})
+		}
+	}
+
+	return op, nil
+}
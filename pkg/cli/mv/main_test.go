@@ -0,0 +1,585 @@
+package mv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/msarfaty/tuf/internal/testutils"
+	"github.com/msarfaty/tuf/pkg/file"
+	"github.com/msarfaty/tuf/pkg/parser"
+	"github.com/msarfaty/tuf/pkg/state"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_parseTarget(t *testing.T) {
+	type args struct {
+		raw string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *target
+		wantErr bool
+	}{
+		{
+			name:    "parses a workspace and module address",
+			args:    args{raw: "/path/to/a:module.example"},
+			want:    &target{workspace: "/path/to/a", address: "module.example"},
+			wantErr: false,
+		},
+		{
+			name:    "ignores separators inside of instance keys",
+			args:    args{raw: "../b:module.example[\"a:b\"]"},
+			want:    &target{workspace: "../b", address: "module.example[\"a:b\"]"},
+			wantErr: false,
+		},
+		{
+			name:    "ignores separators inside of instance keys of resources",
+			args:    args{raw: "/path/to/a:aws_x.y[\"a:b\"]"},
+			want:    &target{workspace: "/path/to/a", address: "aws_x.y[\"a:b\"]"},
+			wantErr: false,
+		},
+		{
+			name:    "keeps separators inside of workspaces",
+			args:    args{raw: "/path/to:a:aws_x.y"},
+			want:    &target{workspace: "/path/to:a", address: "aws_x.y"},
+			wantErr: false,
+		},
+		{
+			name:    "parses a selector",
+			args:    args{raw: "/path/to/a:aws_iam_*.*"},
+			want:    &target{workspace: "/path/to/a", address: "aws_iam_*.*"},
+			wantErr: false,
+		},
+		{
+			name:    "fails with an invalid address",
+			args:    args{raw: "/path/to/a:aws_x.y[\"a:b"},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "fails without a separator",
+			args:    args{raw: "module.example"},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "fails without a workspace",
+			args:    args{raw: ":module.example"},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "fails without an address",
+			args:    args{raw: "/path/to/a:"},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTarget(tt.args.raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTarget() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTarget() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTufMv_Rename(t *testing.T) {
+	main := "resource \"aws_iam_role\" \"this\" {\n}\n"
+	tests := []struct {
+		name string
+		// whether the destination is in a second workspace
+		otherWorkspace bool
+		copy           bool
+	}{
+		{name: "refuses to rename into another workspace", otherWorkspace: true},
+		{name: "refuses to copy under a new name", copy: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": main}})
+			b := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": ""}})
+			s, err := state.NewDiskState(filepath.Join(t.TempDir(), state.TUF_STATE_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wsmgr := state.NewWorkspaceMgr()
+			for _, ws := range []string{a, b} {
+				if err := wsmgr.AddWorkspace(ws); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := wsmgr.Create(s); err != nil {
+				t.Fatal(err)
+			}
+
+			dst := a
+			if tt.otherWorkspace {
+				dst = b
+			}
+			err = TufMv(Options{Source: a + ":aws_iam_role.this", Destination: dst + ":aws_iam_role.renamed", Copy: tt.copy, Out: io.Discard, State: s})
+			if err == nil {
+				t.Fatal("TufMv() error = nil, want an error")
+			}
+			if got, _ := os.ReadFile(filepath.Join(a, "main.tf")); string(got) != main {
+				t.Errorf("TufMv() changed main.tf after failing: %s", got)
+			}
+			if _, err := os.Stat(filepath.Join(a, parser.MOVED_FILE_NAME)); !os.IsNotExist(err) {
+				t.Errorf("TufMv() wrote %s after failing", parser.MOVED_FILE_NAME)
+			}
+		})
+	}
+}
+
+func TestTufMv_Selector(t *testing.T) {
+	tests := []struct {
+		name string
+		copy bool
+		want *state.Operation
+	}{
+		{
+			name: "journals every matched block as a single move",
+			copy: false,
+			want: &state.Operation{
+				Type:               state.OPERATION_MOVE,
+				SourceAddress:      "data.aws_iam_*.*",
+				DestinationAddress: "data.aws_iam_*.*",
+				SourceOtherFiles:   []*state.FileChange{{Name: "iam.tf"}, {Name: "main.tf"}},
+				OtherFiles:         []*state.FileChange{{Name: "data.tuf.tf"}},
+				Blocks: []*state.MovedBlock{
+					{SourceAddress: "data.aws_iam_policy_document.a", DestinationAddress: "data.aws_iam_policy_document.a"},
+					{SourceAddress: "data.aws_iam_role.b", DestinationAddress: "data.aws_iam_role.b"},
+				},
+			},
+		},
+		{
+			name: "journals every matched block as a single copy",
+			copy: true,
+			want: &state.Operation{
+				Type:               state.OPERATION_COPY,
+				SourceAddress:      "data.aws_iam_*.*",
+				DestinationAddress: "data.aws_iam_*.*",
+				OtherFiles:         []*state.FileChange{{Name: "data.tuf.tf"}},
+				Blocks: []*state.MovedBlock{
+					{SourceAddress: "data.aws_iam_policy_document.a", DestinationAddress: "data.aws_iam_policy_document.a"},
+					{SourceAddress: "data.aws_iam_role.b", DestinationAddress: "data.aws_iam_role.b"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{
+				"iam.tf":  "data \"aws_iam_policy_document\" \"a\" {}\n",
+				"main.tf": "data \"aws_iam_role\" \"b\" {}\n\ndata \"aws_s3_bucket\" \"logs\" {}\n",
+			}})
+			b := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": ""}})
+			s, err := state.NewDiskState(filepath.Join(t.TempDir(), state.TUF_STATE_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wsmgr := state.NewWorkspaceMgr()
+			for _, ws := range []string{a, b} {
+				if err := wsmgr.AddWorkspace(ws); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := wsmgr.Create(s); err != nil {
+				t.Fatal(err)
+			}
+
+			err = TufMv(Options{Source: a + ":data.aws_iam_*.*", Destination: b + ":data.aws_iam_*.*", Copy: tt.copy, Out: io.Discard, State: s})
+			if err != nil {
+				t.Fatalf("TufMv() error = %v", err)
+			}
+
+			wsmgr, err = state.Load(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ops := wsmgr.Operations(state.OPERATION_MOVE, state.OPERATION_COPY)
+			if len(ops) != 1 {
+				t.Fatalf("TufMv() journaled %d operation(s), want 1", len(ops))
+			}
+			got := ops[0]
+			// only what the move decides is compared; ids, workspaces and hashes are filled in when it is recorded
+			for _, fc := range append(got.SourceOtherFiles, got.OtherFiles...) {
+				fc.Md5Before, fc.Md5After = "", ""
+			}
+			got = &state.Operation{
+				Type:               got.Type,
+				SourceAddress:      got.SourceAddress,
+				DestinationAddress: got.DestinationAddress,
+				SourceOtherFiles:   got.SourceOtherFiles,
+				OtherFiles:         got.OtherFiles,
+				Blocks:             got.Blocks,
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TufMv() journaled %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTufMv_ModulePaths(t *testing.T) {
+	tests := []struct {
+		name string
+		// the root module of workspace a; its child module in mod/ holds null_resource.n
+		root        string
+		source      string
+		destination string
+		// the directory of workspace b the block is moved into, relative to its root
+		wantDir string
+		wantErr bool
+	}{
+		{
+			name:        "moves a block out of a child module",
+			root:        "module \"x\" {\n  source = \"./mod\"\n}\n",
+			source:      "module.x.null_resource.n",
+			destination: "null_resource.n",
+			wantDir:     ".",
+		},
+		{
+			name:        "moves a block out of a child module with for_each",
+			root:        "module \"x\" {\n  source   = \"./mod\"\n  for_each = toset([\"a\", \"b\"])\n}\n",
+			source:      "module.x[\"a\"].null_resource.n",
+			destination: "null_resource.n",
+			wantDir:     ".",
+		},
+		{
+			name:        "moves a block into a child module",
+			root:        "module \"x\" {\n  source = \"./mod\"\n}\n",
+			source:      "module.x.null_resource.n",
+			destination: "module.y.null_resource.n",
+			wantDir:     "mod",
+		},
+		{
+			name:        "moves a block into a child module with count",
+			root:        "module \"x\" {\n  source = \"./mod\"\n}\n",
+			source:      "module.x.null_resource.n",
+			destination: "module.y[0].null_resource.n",
+			wantDir:     "mod",
+		},
+		{
+			name:        "refuses to change the instance key of the block",
+			root:        "module \"x\" {\n  source = \"./mod\"\n}\n",
+			source:      "module.x.null_resource.n[0]",
+			destination: "null_resource.n[1]",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			child := "resource \"null_resource\" \"n\" {\n}\n"
+			a := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": tt.root}})
+			b := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": "module \"y\" {\n  source = \"./mod\"\n}\n"}})
+			for _, ws := range []string{a, b} {
+				if err := os.Mkdir(filepath.Join(ws, "mod"), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(filepath.Join(a, "mod", "main.tf"), []byte(child), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(b, "mod", "main.tf"), []byte(""), 0644); err != nil {
+				t.Fatal(err)
+			}
+			s, err := state.NewDiskState(filepath.Join(t.TempDir(), state.TUF_STATE_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wsmgr := state.NewWorkspaceMgr()
+			for _, ws := range []string{a, b} {
+				if err := wsmgr.AddWorkspace(ws); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := wsmgr.Create(s); err != nil {
+				t.Fatal(err)
+			}
+
+			err = TufMv(Options{Source: a + ":" + tt.source, Destination: b + ":" + tt.destination, Out: io.Discard, State: s})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TufMv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if got, _ := os.ReadFile(filepath.Join(a, "mod", "main.tf")); string(got) != child {
+					t.Errorf("TufMv() changed mod/main.tf after failing: %s", got)
+				}
+				return
+			}
+			if got, _ := os.ReadFile(filepath.Join(a, "mod", "main.tf")); string(got) != "" {
+				t.Errorf("TufMv() left the block in the source module: %s", got)
+			}
+			if got, _ := os.ReadFile(filepath.Join(b, tt.wantDir, "resources.tuf.tf")); string(got) != child {
+				t.Errorf("TufMv() wrote %q into %s, want %q", got, tt.wantDir, child)
+			}
+		})
+	}
+}
+
+func TestTufMv_ModuleSource(t *testing.T) {
+	tests := []struct {
+		name string
+		// the directory of the module module.x calls, relative to the directory both workspaces live in, and its
+		// source in workspace a
+		moduleDir string
+		source    string
+		// module.x as it is written into workspace b, which is nested one directory deeper than a; empty if the
+		// move fails
+		want string
+	}{
+		{
+			name:      "rewrites the source of a shared module against the destination",
+			moduleDir: "modules/x",
+			source:    "../modules/x",
+			want:      "module \"x\" {\n  source = \"../../modules/x\"\n}\n",
+		},
+		{
+			name:      "refuses to move a block calling a module of the source workspace",
+			moduleDir: "a/modules/x",
+			source:    "./modules/x",
+			want:      "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			a, b := filepath.Join(root, "a"), filepath.Join(root, "b", "nested")
+			for _, dir := range []string{a, b, filepath.Join(root, tt.moduleDir)} {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			main := "module \"x\" {\n  source = \"" + tt.source + "\"\n}\n"
+			for name, contents := range map[string]string{
+				filepath.Join(a, "main.tf"):                  main,
+				filepath.Join(b, "main.tf"):                  "",
+				filepath.Join(root, tt.moduleDir, "main.tf"): "",
+			} {
+				if err := os.WriteFile(name, []byte(contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s, err := state.NewDiskState(filepath.Join(t.TempDir(), state.TUF_STATE_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wsmgr := state.NewWorkspaceMgr()
+			for _, ws := range []string{a, b} {
+				if err := wsmgr.AddWorkspace(ws); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := wsmgr.Create(s); err != nil {
+				t.Fatal(err)
+			}
+
+			err = TufMv(Options{Source: a + ":module.x", Destination: b + ":module.x", Out: io.Discard, State: s})
+			if (err != nil) != (tt.want == "") {
+				t.Fatalf("TufMv() error = %v, want an error %v", err, tt.want == "")
+			}
+			if tt.want == "" {
+				if got, _ := os.ReadFile(filepath.Join(a, "main.tf")); string(got) != main {
+					t.Errorf("TufMv() changed main.tf after failing: %s", got)
+				}
+				return
+			}
+			if got, _ := os.ReadFile(filepath.Join(b, "module_x.tuf.tf")); string(got) != tt.want {
+				t.Errorf("TufMv() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTufMv_InstanceWarning(t *testing.T) {
+	tests := []struct {
+		name string
+		// the root module of workspace a; its child module in mod/ holds null_resource.n
+		root  string
+		child string
+		// the instance addresses moved into workspace b, in order
+		moves [][2]string
+		// what the warning of each move says; empty for no warning
+		want []string
+	}{
+		{
+			name:  "warns until every counted instance is moved",
+			root:  "resource \"null_resource\" \"n\" {\n  count = 2\n}\n",
+			moves: [][2]string{{"null_resource.n[1]", "null_resource.n[1]"}, {"null_resource.n[0]", "null_resource.n[0]"}},
+			want:  []string{"move every other instance", ""},
+		},
+		{
+			name:  "warns until the block is moved out of every instance of its module",
+			root:  "module \"x\" {\n  source   = \"./mod\"\n  for_each = toset([\"a\", \"b\"])\n}\n",
+			child: "resource \"null_resource\" \"n\" {\n}\n",
+			moves: [][2]string{{"module.x[\"a\"].null_resource.n", "null_resource.n"}, {"module.x[\"b\"].null_resource.n", "null_resource.n"}},
+			want:  []string{"move every other instance", ""},
+		},
+		{
+			name:  "hedges the warning when the instances are not known",
+			root:  "resource \"null_resource\" \"n\" {\n  count = var.n\n}\n",
+			moves: [][2]string{{"null_resource.n[0]", "null_resource.n[0]"}, {"null_resource.n[1]", "null_resource.n[1]"}},
+			want:  []string{"if null_resource.n has other instances", "if null_resource.n has other instances"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": tt.root}})
+			b := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": ""}})
+			if err := os.Mkdir(filepath.Join(a, "mod"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(a, "mod", "main.tf"), []byte(tt.child), 0644); err != nil {
+				t.Fatal(err)
+			}
+			s, err := state.NewDiskState(filepath.Join(t.TempDir(), state.TUF_STATE_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wsmgr := state.NewWorkspaceMgr()
+			for _, ws := range []string{a, b} {
+				if err := wsmgr.AddWorkspace(ws); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := wsmgr.Create(s); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, move := range tt.moves {
+				out := &strings.Builder{}
+				if err := TufMv(Options{Source: a + ":" + move[0], Destination: b + ":" + move[1], Out: out, State: s}); err != nil {
+					t.Fatalf("TufMv() error = %v", err)
+				}
+				warned := strings.Contains(out.String(), "warning:")
+				if warned != (tt.want[i] != "") || !strings.Contains(out.String(), tt.want[i]) {
+					t.Errorf("TufMv() of %s wrote %q, want a warning with %q", move[0], out.String(), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTufMv_DryRun(t *testing.T) {
+	tests := []struct {
+		name string
+		// whether the interrupted transaction staged every change before it died
+		committed   bool
+		wantPending string
+	}{
+		{
+			name:        "reports a committed operation that was not recorded without finishing it",
+			committed:   true,
+			wantPending: "pending: %v wrote its files but was not recorded",
+		},
+		{
+			name:        "reports an operation that was staging its files without discarding them",
+			committed:   false,
+			wantPending: "pending: %v was staging its files",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": "resource \"aws_iam_role\" \"this\" {}\n"}})
+			b := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": ""}})
+			s, err := state.NewDiskState(filepath.Join(t.TempDir(), state.TUF_STATE_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wsmgr := state.NewWorkspaceMgr()
+			for _, ws := range []string{a, b} {
+				if err := wsmgr.AddWorkspace(ws); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := wsmgr.Create(s); err != nil {
+				t.Fatal(err)
+			}
+
+			op := &state.Operation{
+				Id:                   "interrupted",
+				Type:                 state.OPERATION_COPY,
+				SourceWorkspace:      wsmgr.Workspaces[0].Uuid,
+				SourceAddress:        "aws_iam_role.other",
+				DestinationWorkspace: wsmgr.Workspaces[1].Uuid,
+				DestinationAddress:   "aws_iam_role.other",
+			}
+			data, err := yaml.Marshal(op)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other := filepath.Join(b, "other.tf")
+			staged := other + file.STAGED_FILE_SUFFIX
+			if tt.committed {
+				// commit the files of the operation, dying before it is recorded
+				tx := wsmgr.Begin()
+				tx.Write(other, []byte("resource \"aws_iam_role\" \"other\" {}\n"))
+				if err := tx.Commit(data); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				// die while staging the files of the operation
+				manifest, err := json.Marshal(map[string]any{
+					"committed": false,
+					"changes":   []map[string]string{{"path": other, "staged": staged}},
+					"data":      string(data),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.MkdirAll(filepath.Dir(s.TransactionJournal()), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(s.TransactionJournal(), manifest, 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(staged, []byte("resource \"aws_iam_role\" \"other\" {}\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// a dry run writes nothing, so it runs while another command holds the lock
+			unlock, err := s.Lock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer unlock()
+
+			out := &bytes.Buffer{}
+			if err = TufMv(Options{Source: a + ":aws_iam_role.this", Destination: b + ":aws_iam_role.this", DryRun: true, Out: out, State: s}); err != nil {
+				t.Fatalf("TufMv() error = %v", err)
+			}
+			if want := fmt.Sprintf(tt.wantPending, op); !strings.Contains(out.String(), want) {
+				t.Errorf("TufMv() output = %s, want it to contain %q", out.String(), want)
+			}
+			if !strings.Contains(out.String(), "+resource \"aws_iam_role\" \"this\" {}") {
+				t.Errorf("TufMv() output = %s, want the diff of the move", out.String())
+			}
+			if _, err := os.Stat(s.TransactionJournal()); err != nil {
+				t.Errorf("TufMv() recovered the transaction, want it left for the next command: %v", err)
+			}
+			if _, err := os.Stat(other); tt.committed != (err == nil) {
+				t.Errorf("TufMv() changed the files of the transaction: %v", err)
+			}
+			if _, err := os.Stat(staged); tt.committed == (err == nil) {
+				t.Errorf("TufMv() changed the staged files of the transaction: %v", err)
+			}
+			if got, _ := os.ReadFile(filepath.Join(a, "main.tf")); string(got) != "resource \"aws_iam_role\" \"this\" {}\n" {
+				t.Errorf("TufMv() wrote main.tf during a dry run: %s", got)
+			}
+		})
+	}
+}
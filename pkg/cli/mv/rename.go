@@ -0,0 +1,98 @@
+package mv
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/msarfaty/tuf/pkg/parser"
+	"github.com/msarfaty/tuf/pkg/state"
+)
+
+// renames a block in place within its workspace, updating every reference to it and adding a moved block so that
+// terraform renames its state on the next apply
+func rename(o Options, wsmgr *state.WorkspaceMgr, srcWs *state.Workspace, src *target, dstWs *state.Workspace, dst *target) error {
+	if srcWs != dstWs {
+		return fmt.Errorf("cannot move %s to %s; blocks can only be renamed within a workspace, so move the block and rename it separately", o.Source, o.Destination)
+	}
+	if o.Copy {
+		return errors.New("cannot copy a block under a new name")
+	}
+	if o.Naming != "" || o.FileName != "" {
+		return errors.New("renamed blocks stay in the file they are in, so no file can be chosen for them")
+	}
+	path, _, err := parser.SplitModulePath(src.address)
+	if err != nil {
+		return err
+	}
+	if _, err = moduleDirectory(srcWs, path); err != nil {
+		return err
+	}
+
+	result, err := parser.RenameHclBlock(&parser.RenameOptions{
+		Address:    src.address,
+		NewAddress: dst.address,
+		Directory:  srcWs.Abspath,
+		DryRun:     true,
+	})
+	if err != nil {
+		return err
+	}
+	writeNotes(o.Out, srcWs, []*parser.MoveResult{result})
+	if o.DryRun {
+		return writeDiffs(o.Out, result.Edits)
+	}
+
+	if err = wsmgr.Snapshot(srcWs); err != nil {
+		return fmt.Errorf("failed to snapshot workspace %s: %w", srcWs.Abspath, err)
+	}
+	// the block, its references and its moved block are written at once
+	tx := wsmgr.Begin()
+	parser.StageEdits(tx, result.Edits)
+	op, err := renameOperation(srcWs, src, dst, result)
+	if err != nil {
+		return err
+	}
+	if err = wsmgr.Apply(tx, op); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", src.address, err)
+	}
+
+	return nil
+}
+
+// builds the journal entry for a block renamed within a workspace. The file of the block is both the source and
+// destination file, and every other file the rename changed is restored along with it on undo
+func renameOperation(ws *state.Workspace, src *target, dst *target, result *parser.MoveResult) (*state.Operation, error) {
+	name, err := ws.RelativeName(result.From.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	op := &state.Operation{
+		Type:            state.OPERATION_RENAME,
+		SourceWorkspace: ws.Uuid,
+		SourceAddress:   src.address,
+		SourceFile: &state.FileChange{
+			Name:  name,
+			Range: state.ByteRange{Start: result.From.Start, End: result.From.End},
+		},
+		DestinationWorkspace: ws.Uuid,
+		DestinationAddress:   dst.address,
+		DestinationFile: &state.FileChange{
+			Name:  name,
+			Range: state.ByteRange{Start: result.To.Start, End: result.To.End},
+		},
+	}
+	for _, edit := range result.Edits {
+		if filepath.Clean(edit.Filename) == filepath.Clean(result.From.Filename) {
+			continue
+		}
+		other, err := ws.RelativeName(edit.Filename)
+		if err != nil {
+			return nil, err
+		}
+		op.OtherFiles = append(op.OtherFiles, &state.FileChange{Name: other})
+	}
+
+	return op, nil
+}
@@ -0,0 +1,159 @@
+package status
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/msarfaty/tuf/pkg/state"
+)
+
+// returned when tracked workspaces have changed outside of tuf
+var ErrDrift = errors.New("tracked workspaces have changed outside of tuf")
+
+// options for showing the status of a tuf migration
+type Options struct {
+	// where the status is written
+	Out io.Writer
+	// where the migration is persisted; defaults to the tuf.state found from the current directory
+	State state.State
+}
+
+func (o *Options) validate() error {
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+
+	if o.State == nil {
+		s, err := state.Discover()
+		if err != nil {
+			return err
+		}
+		o.State = s
+	}
+
+	return nil
+}
+
+// writes one group of files, skipping empty groups
+func writeFiles(out io.Writer, group string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "  %s:\n", group)
+	for _, name := range names {
+		fmt.Fprintf(out, "    %s\n", name)
+	}
+}
+
+// describes an operation with workspace paths rather than uuids
+func describe(wsmgr *state.WorkspaceMgr, op *state.Operation) string {
+	path := func(uuid string) string {
+		if ws := wsmgr.GetWorkspaceByUuid(uuid); ws != nil {
+			return ws.Abspath
+		}
+		return uuid
+	}
+
+	switch op.Type {
+	case state.OPERATION_MOVE, state.OPERATION_COPY, state.OPERATION_RENAME:
+		ret := fmt.Sprintf("%s %s:%s -> %s:%s", op.Type, path(op.SourceWorkspace), op.SourceAddress, path(op.DestinationWorkspace), op.DestinationAddress)
+		if len(op.Blocks) > 0 {
+			ret += fmt.Sprintf(" (%d blocks)", len(op.Blocks))
+		}
+		return ret
+	case state.OPERATION_UNDO:
+		return fmt.Sprintf("%s %s", op.Type, op.Undoes)
+	default:
+		return string(op.Type)
+	}
+}
+
+// reports a transaction left in the journal, which is either still being committed by another tuf process or
+// was interrupted. Its files may show up as drift until it is recovered
+func writePending(out io.Writer, wsmgr *state.WorkspaceMgr, pending *state.PendingTransaction) {
+	if pending == nil {
+		return
+	}
+	what := "an operation"
+	if op := pending.Operation; op != nil {
+		if slices.ContainsFunc(wsmgr.Journal, func(recorded *state.Operation) bool { return recorded.Id == op.Id }) {
+			// only the transaction journal was left behind
+			return
+		}
+		what = describe(wsmgr, op)
+	}
+
+	if pending.Committed {
+		fmt.Fprintf(out, "\npending: %s wrote its files but was not recorded; unless another tuf command is still running it, "+
+			"the next tuf command that changes the migration will finish it\n", what)
+	} else {
+		fmt.Fprintf(out, "\npending: %s was staging its files; unless another tuf command is still running it, "+
+			"the next tuf command that changes the migration will discard them\n", what)
+	}
+}
+
+// shows every tracked workspace and how it has drifted, followed by the journal of the migration.
+// ErrDrift is returned if any workspace has changed outside of tuf.
+func TufStatus(o Options) error {
+	if err := o.validate(); err != nil {
+		return fmt.Errorf("failed to show tuf migration status: %v", err)
+	}
+
+	// status only reads the migration, so it takes no lock and leaves an interrupted operation to be recovered,
+	// and an older migration to be snapshotted, by the next command that changes the migration
+	pending, err := state.Pending(o.State)
+	if err != nil {
+		return err
+	}
+	wsmgr, err := state.Read(o.State)
+	if err != nil {
+		return err
+	}
+
+	progress := "in progress"
+	if wsmgr.Completed {
+		progress = "finalized"
+	}
+	fmt.Fprintf(o.Out, "migration %s (%s)\n", o.State, progress)
+	writePending(o.Out, wsmgr, pending)
+
+	drifted := []string{}
+	for _, ws := range wsmgr.Workspaces {
+		drift, err := ws.Drift()
+		if err != nil {
+			return err
+		}
+		if drift.HasDrift() {
+			drifted = append(drifted, ws.Abspath)
+		}
+
+		fmt.Fprintf(o.Out, "\nworkspace %s\n", ws.Abspath)
+		fmt.Fprintf(o.Out, "  uuid: %s\n", ws.Uuid)
+		fmt.Fprintf(o.Out, "  files: %d\n", len(ws.Files))
+		writeFiles(o.Out, "unchanged", drift.Unchanged)
+		writeFiles(o.Out, "modified", drift.Modified)
+		writeFiles(o.Out, "added", drift.Added)
+		writeFiles(o.Out, "removed", drift.Removed)
+	}
+
+	fmt.Fprintf(o.Out, "\noperations:\n")
+	undone := wsmgr.Undone()
+	for _, op := range wsmgr.Journal {
+		line := fmt.Sprintf("  %s %s %s", op.Timestamp.Format(time.RFC3339), op.Id, describe(wsmgr, op))
+		if undone[op.Id] {
+			line += " (undone)"
+		}
+		fmt.Fprintln(o.Out, line)
+	}
+
+	if len(drifted) > 0 {
+		return fmt.Errorf("%w: %s", ErrDrift, strings.Join(drifted, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package status
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/msarfaty/tuf/internal/testutils"
+	"github.com/msarfaty/tuf/pkg/file"
+	"github.com/msarfaty/tuf/pkg/state"
+	"gopkg.in/yaml.v3"
+)
+
+func TestTufStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		mutator   func(t *testing.T, ws string)
+		wantGroup string
+		wantErr   bool
+	}{
+		{
+			name:      "passes without drift",
+			mutator:   func(t *testing.T, ws string) {},
+			wantGroup: "unchanged:\n    main.tf\n    variables.tf\n",
+			wantErr:   false,
+		},
+		{
+			name: "fails when a file is modified",
+			mutator: func(t *testing.T, ws string) {
+				if err := os.WriteFile(filepath.Join(ws, "main.tf"), []byte("changed"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantGroup: "modified:\n    main.tf\n",
+			wantErr:   true,
+		},
+		{
+			name: "fails when a file is added",
+			mutator: func(t *testing.T, ws string) {
+				if err := os.WriteFile(filepath.Join(ws, "outputs.tf"), []byte("added"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantGroup: "added:\n    outputs.tf\n",
+			wantErr:   true,
+		},
+		{
+			name: "fails when a file is removed",
+			mutator: func(t *testing.T, ws string) {
+				if err := os.Remove(filepath.Join(ws, "variables.tf")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantGroup: "removed:\n    variables.tf\n",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := testutils.MakeDirectory(t, &testutils.TempDirOpts{
+				Contents: map[string]string{"main.tf": "foo", "variables.tf": "bar"},
+			})
+			s := state.NewMemoryState()
+			wsmgr := state.NewWorkspaceMgr()
+			if err := wsmgr.AddWorkspace(ws); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Create(s); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Record(&state.Operation{Type: state.OPERATION_INIT}); err != nil {
+				t.Fatal(err)
+			}
+			tt.mutator(t, ws)
+
+			out := &bytes.Buffer{}
+			err := TufStatus(Options{Out: out, State: s})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TufStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrDrift) {
+				t.Errorf("TufStatus() error = %v, want ErrDrift", err)
+			}
+
+			for _, want := range []string{"workspace " + ws, "uuid: " + wsmgr.Workspaces[0].Uuid, "files: 2", tt.wantGroup, "init"} {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("TufStatus() output = %s, want it to contain %q", out.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestTufStatus_Pending(t *testing.T) {
+	tests := []struct {
+		name string
+		// whether the interrupted transaction staged every change before it died
+		committed bool
+		// what the output says will happen to the transaction
+		wantPending string
+		// main.tf as the transaction left it, which status must not change
+		wantMain  string
+		wantDrift bool
+	}{
+		{
+			name:        "reports a committed operation that was not recorded without finishing it",
+			committed:   true,
+			wantPending: "pending: move %s:aws_iam_role.this -> %s:aws_iam_role.this wrote its files but was not recorded",
+			wantMain:    "bar",
+			wantDrift:   true,
+		},
+		{
+			name:        "reports an operation that was staging its files without discarding them",
+			committed:   false,
+			wantPending: "pending: move %s:aws_iam_role.this -> %s:aws_iam_role.this was staging its files",
+			wantMain:    "foo",
+			wantDrift:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": "foo"}})
+			s, err := state.NewDiskState(filepath.Join(t.TempDir(), state.TUF_STATE_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wsmgr := state.NewWorkspaceMgr()
+			if err := wsmgr.AddWorkspace(ws); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Create(s); err != nil {
+				t.Fatal(err)
+			}
+
+			op := &state.Operation{
+				Id:                   "interrupted",
+				Type:                 state.OPERATION_MOVE,
+				SourceWorkspace:      wsmgr.Workspaces[0].Uuid,
+				SourceAddress:        "aws_iam_role.this",
+				SourceFile:           &state.FileChange{Name: "main.tf"},
+				DestinationWorkspace: wsmgr.Workspaces[0].Uuid,
+				DestinationAddress:   "aws_iam_role.this",
+			}
+			data, err := yaml.Marshal(op)
+			if err != nil {
+				t.Fatal(err)
+			}
+			staged := filepath.Join(ws, "main.tf"+file.STAGED_FILE_SUFFIX)
+			if tt.committed {
+				// commit the files of the operation, dying before it is recorded
+				tx := wsmgr.Begin()
+				tx.Write(filepath.Join(ws, "main.tf"), []byte("bar"))
+				if err := tx.Commit(data); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				// die while staging the files of the operation
+				manifest, err := json.Marshal(map[string]any{
+					"committed": false,
+					"changes":   []map[string]string{{"path": filepath.Join(ws, "main.tf"), "staged": staged}},
+					"data":      string(data),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.MkdirAll(filepath.Dir(s.TransactionJournal()), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(s.TransactionJournal(), manifest, 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(staged, []byte("bar"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// status only reads the migration, so it runs while another command holds the lock
+			unlock, err := s.Lock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer unlock()
+
+			out := &bytes.Buffer{}
+			err = TufStatus(Options{Out: out, State: s})
+			if errors.Is(err, ErrDrift) != tt.wantDrift {
+				t.Fatalf("TufStatus() error = %v, wantDrift %v", err, tt.wantDrift)
+			}
+			if want := fmt.Sprintf(tt.wantPending, ws, ws); !strings.Contains(out.String(), want) {
+				t.Errorf("TufStatus() output = %s, want it to contain %q", out.String(), want)
+			}
+			if _, err := os.Stat(s.TransactionJournal()); err != nil {
+				t.Errorf("TufStatus() recovered the transaction, want it left for the next command: %v", err)
+			}
+			if got, _ := os.ReadFile(filepath.Join(ws, "main.tf")); string(got) != tt.wantMain {
+				t.Errorf("TufStatus() left main.tf as %s, want %s", got, tt.wantMain)
+			}
+			if _, err := os.Stat(staged); tt.committed == (err == nil) {
+				t.Errorf("TufStatus() changed the staged files of the transaction: %v", err)
+			}
+		})
+	}
+}
+
+func TestTufStatus_Undone(t *testing.T) {
+	ws := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": "foo"}})
+	s := state.NewMemoryState()
+	wsmgr := state.NewWorkspaceMgr()
+	if err := wsmgr.AddWorkspace(ws); err != nil {
+		t.Fatal(err)
+	}
+	if err := wsmgr.Create(s); err != nil {
+		t.Fatal(err)
+	}
+	uuid := wsmgr.Workspaces[0].Uuid
+	kept := &state.Operation{Type: state.OPERATION_MOVE, SourceWorkspace: uuid, SourceAddress: "aws_iam_role.kept", DestinationWorkspace: uuid, DestinationAddress: "aws_iam_role.kept"}
+	undone := &state.Operation{Type: state.OPERATION_MOVE, SourceWorkspace: uuid, SourceAddress: "aws_iam_role.undone", DestinationWorkspace: uuid, DestinationAddress: "aws_iam_role.undone"}
+	for _, op := range []*state.Operation{kept, undone} {
+		if err := wsmgr.Record(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wsmgr.Record(&state.Operation{Type: state.OPERATION_UNDO, Undoes: undone.Id}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	if err := TufStatus(Options{Out: out, State: s}); err != nil {
+		t.Fatalf("TufStatus() error = %v", err)
+	}
+	for _, want := range []string{ws + ":aws_iam_role.undone (undone)\n", ws + ":aws_iam_role.kept\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("TufStatus() output = %s, want it to contain %q", out.String(), want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package undo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/msarfaty/tuf/pkg/state"
+)
+
+// options for undoing tuf operations
+type Options struct {
+	// the number of most recent moves, copies and renames to undo
+	Steps int
+	// where the summary of undone operations is written
+	Out io.Writer
+	// where the migration is persisted; defaults to the tuf.state found from the current directory
+	State state.State
+}
+
+func (o *Options) validate() error {
+	if o.Steps < 1 {
+		return errors.New("must undo at least one step")
+	}
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+
+	if o.State == nil {
+		s, err := state.Discover()
+		if err != nil {
+			return err
+		}
+		o.State = s
+	}
+
+	return nil
+}
+
+// a file within a workspace
+type fileKey struct {
+	workspace string
+	name      string
+}
+
+// a single file that must be restored to undo an operation
+type restoration struct {
+	ws     *state.Workspace
+	change *state.FileChange
+}
+
+// the file changes of an operation, deduplicated for operations that change one file twice
+func restorations(wsmgr *state.WorkspaceMgr, op *state.Operation) []*restoration {
+	ret := []*restoration{}
+	seen := map[fileKey]bool{}
+	type workspaceChange struct {
+		workspace string
+		change    *state.FileChange
+	}
+	changes := []workspaceChange{{op.DestinationWorkspace, op.DestinationFile}, {op.SourceWorkspace, op.SourceFile}}
+	for _, fc := range op.OtherFiles {
+		changes = append(changes, workspaceChange{op.DestinationWorkspace, fc})
+	}
+	for _, fc := range op.SourceOtherFiles {
+		changes = append(changes, workspaceChange{op.SourceWorkspace, fc})
+	}
+	for _, fc := range changes {
+		if fc.change == nil || seen[fileKey{fc.workspace, fc.change.Name}] {
+			continue
+		}
+		seen[fileKey{fc.workspace, fc.change.Name}] = true
+		ret = append(ret, &restoration{ws: wsmgr.GetWorkspaceByUuid(fc.workspace), change: fc.change})
+	}
+
+	return ret
+}
+
+// checks that every operation can be undone, in order, before anything is written to disk.
+// files must still match the hashes recorded after each operation and a snapshot must exist
+// for the contents that will be restored.
+func checkDrift(wsmgr *state.WorkspaceMgr, ops []*state.Operation) error {
+	expected := map[fileKey]string{}
+	for _, op := range ops {
+		for _, r := range restorations(wsmgr, op) {
+			key := fileKey{r.ws.Uuid, r.change.Name}
+			current, ok := expected[key]
+			if !ok {
+				var err error
+				current, err = r.ws.CurrentMd5(r.change.Name)
+				if err != nil {
+					return fmt.Errorf("failed to hash %s in workspace %s: %w", r.change.Name, r.ws.Abspath, err)
+				}
+			}
+			if current != r.change.Md5After {
+				return fmt.Errorf("cannot undo %s:%s -> %s:%s: %s in workspace %s has drifted since the %s (expected md5 %q, found %q); revert the file or run tuf status",
+					wsmgr.GetWorkspaceByUuid(op.SourceWorkspace).Abspath, op.SourceAddress,
+					wsmgr.GetWorkspaceByUuid(op.DestinationWorkspace).Abspath, op.DestinationAddress,
+					r.change.Name, r.ws.Abspath, op.Type, r.change.Md5After, current)
+			}
+			if r.change.Md5Before != "" {
+				if _, err := wsmgr.ReadSnapshot(r.change.Md5Before); err != nil {
+					return fmt.Errorf("cannot undo %v: %w", op, err)
+				}
+			}
+			expected[key] = r.change.Md5Before
+		}
+	}
+
+	return nil
+}
+
+// undoes a single operation, restoring all of its files at once and recording the undo in the journal
+func undoOperation(wsmgr *state.WorkspaceMgr, op *state.Operation) error {
+	tx := wsmgr.Begin()
+	for _, r := range restorations(wsmgr, op) {
+		if err := wsmgr.RestoreFile(tx, r.ws, r.change.Name, r.change.Md5Before); err != nil {
+			return err
+		}
+	}
+
+	reverse := func(fc *state.FileChange) *state.FileChange {
+		if fc == nil {
+			return nil
+		}
+		return &state.FileChange{Name: fc.Name, Range: fc.Range}
+	}
+	reverseAll := func(fcs []*state.FileChange) []*state.FileChange {
+		ret := []*state.FileChange{}
+		for _, fc := range fcs {
+			ret = append(ret, reverse(fc))
+		}
+		return ret
+	}
+	// the workspaces swap places, so the other files of each side go with the workspace they belong to
+	return wsmgr.Apply(tx, &state.Operation{
+		Type:                 state.OPERATION_UNDO,
+		Undoes:               op.Id,
+		SourceWorkspace:      op.DestinationWorkspace,
+		SourceAddress:        op.DestinationAddress,
+		SourceFile:           reverse(op.DestinationFile),
+		SourceOtherFiles:     reverseAll(op.OtherFiles),
+		DestinationWorkspace: op.SourceWorkspace,
+		DestinationAddress:   op.SourceAddress,
+		DestinationFile:      reverse(op.SourceFile),
+		OtherFiles:           reverseAll(op.SourceOtherFiles),
+	})
+}
+
+// undoes the most recent moves of a tuf migration using the given options
+func TufUndo(o Options) (err error) {
+	if err := o.validate(); err != nil {
+		return fmt.Errorf("failed to undo: %v", err)
+	}
+
+	unlock, err := o.State.Lock()
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, unlock()) }()
+
+	if op, err := state.Recover(o.State); err != nil {
+		return err
+	} else if op != nil {
+		fmt.Fprintf(o.Out, "finished %v, which was interrupted\n", op)
+	}
+	// drift is checked per file below so that undo can explain exactly what changed
+	wsmgr, err := state.Open(o.State)
+	if err != nil {
+		return err
+	}
+	if wsmgr.Completed {
+		return fmt.Errorf("the migration in %s has already been finalized", o.State)
+	}
+
+	moves := wsmgr.Operations(state.OPERATION_MOVE, state.OPERATION_COPY, state.OPERATION_RENAME)
+	if o.Steps > len(moves) {
+		return fmt.Errorf("cannot undo %d step(s); only %d move(s), copies or renames can be undone", o.Steps, len(moves))
+	}
+
+	// most recent first
+	ops := []*state.Operation{}
+	for i := len(moves) - 1; i >= len(moves)-o.Steps; i-- {
+		ops = append(ops, moves[i])
+	}
+	if err = checkDrift(wsmgr, ops); err != nil {
+		return err
+	}
+	if err = wsmgr.Validate(); err != nil {
+		return fmt.Errorf("tracked workspaces have changed outside of tuf: %w", err)
+	}
+
+	for _, op := range ops {
+		// every undo is journaled as it happens, so a failure leaves the journal matching disk
+		if err = undoOperation(wsmgr, op); err != nil {
+			return fmt.Errorf("failed to undo %v: %w", op, err)
+		}
+		fmt.Fprintf(o.Out, "undid %s %s:%s -> %s:%s\n", op.Type,
+			wsmgr.GetWorkspaceByUuid(op.SourceWorkspace).Abspath, op.SourceAddress,
+			wsmgr.GetWorkspaceByUuid(op.DestinationWorkspace).Abspath, op.DestinationAddress)
+	}
+
+	return nil
+}
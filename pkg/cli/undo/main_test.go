@@ -0,0 +1,137 @@
+package undo
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msarfaty/tuf/internal/testutils"
+	"github.com/msarfaty/tuf/pkg/cli/mv"
+	"github.com/msarfaty/tuf/pkg/parser"
+	"github.com/msarfaty/tuf/pkg/state"
+)
+
+func TestTufUndo(t *testing.T) {
+	contents := map[string]string{
+		"main.tf":    "resource \"aws_iam_role\" \"this\" {\n  name = \"role\"\n}\n",
+		"outputs.tf": "output \"role\" {\n  value = aws_iam_role.this.arn\n}\n",
+	}
+	tests := []struct {
+		name string
+		// the moves run before undoing, as source and destination addresses within the workspace
+		moves [][2]string
+		steps int
+	}{
+		{
+			name:  "restores every file touched by a rename",
+			moves: [][2]string{{"aws_iam_role.this", "aws_iam_role.renamed"}},
+			steps: 1,
+		},
+		{
+			name:  "restores every file touched by consecutive renames",
+			moves: [][2]string{{"aws_iam_role.this", "aws_iam_role.renamed"}, {"aws_iam_role.renamed", "aws_iam_role.again"}},
+			steps: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: contents})
+			s, err := state.NewDiskState(filepath.Join(t.TempDir(), state.TUF_STATE_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wsmgr := state.NewWorkspaceMgr()
+			if err := wsmgr.AddWorkspace(ws); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Create(s); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, move := range tt.moves {
+				if err := mv.TufMv(mv.Options{Source: ws + ":" + move[0], Destination: ws + ":" + move[1], Out: io.Discard, State: s}); err != nil {
+					t.Fatalf("TufMv() error = %v", err)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(ws, parser.MOVED_FILE_NAME)); err != nil {
+				t.Fatalf("TufMv() did not write %s: %v", parser.MOVED_FILE_NAME, err)
+			}
+
+			if err := TufUndo(Options{Steps: tt.steps, Out: io.Discard, State: s}); err != nil {
+				t.Fatalf("TufUndo() error = %v", err)
+			}
+
+			for name, want := range contents {
+				got, err := os.ReadFile(filepath.Join(ws, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("TufUndo() left %s as\nSTART\n%s\nEOF\nwant\nSTART\n%s\nEOF", name, got, want)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(ws, parser.MOVED_FILE_NAME)); !os.IsNotExist(err) {
+				t.Errorf("TufUndo() left %s behind, want it removed", parser.MOVED_FILE_NAME)
+			}
+		})
+	}
+}
+
+func TestTufUndo_Selector(t *testing.T) {
+	srcContents := map[string]string{
+		"iam.tf":  "data \"aws_iam_policy_document\" \"a\" {}\n",
+		"main.tf": "data \"aws_iam_role\" \"b\" {}\n\ndata \"aws_s3_bucket\" \"logs\" {}\n",
+	}
+	dstContents := map[string]string{"main.tf": ""}
+	tests := []struct {
+		name string
+		copy bool
+	}{
+		{name: "restores every file a selector moved blocks out of and into", copy: false},
+		{name: "restores every file a selector copied blocks into", copy: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: srcContents})
+			b := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: dstContents})
+			s, err := state.NewDiskState(filepath.Join(t.TempDir(), state.TUF_STATE_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wsmgr := state.NewWorkspaceMgr()
+			for _, ws := range []string{a, b} {
+				if err := wsmgr.AddWorkspace(ws); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := wsmgr.Create(s); err != nil {
+				t.Fatal(err)
+			}
+
+			err = mv.TufMv(mv.Options{Source: a + ":data.aws_iam_*.*", Destination: b + ":data.aws_iam_*.*", Copy: tt.copy, Out: io.Discard, State: s})
+			if err != nil {
+				t.Fatalf("TufMv() error = %v", err)
+			}
+			// every matched block is a single step
+			if err := TufUndo(Options{Steps: 1, Out: io.Discard, State: s}); err != nil {
+				t.Fatalf("TufUndo() error = %v", err)
+			}
+
+			for ws, contents := range map[string]map[string]string{a: srcContents, b: dstContents} {
+				for name, want := range contents {
+					got, err := os.ReadFile(filepath.Join(ws, name))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if string(got) != want {
+						t.Errorf("TufUndo() left %s as\nSTART\n%s\nEOF\nwant\nSTART\n%s\nEOF", name, got, want)
+					}
+				}
+			}
+			if _, err := os.Stat(filepath.Join(b, "data.tuf.tf")); !os.IsNotExist(err) {
+				t.Errorf("TufUndo() left data.tuf.tf behind, want it removed")
+			}
+		})
+	}
+}
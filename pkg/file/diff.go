@@ -0,0 +1,189 @@
+package file
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// lines of unchanged context around each hunk of a unified diff
+	DIFF_CONTEXT_LINES = 3
+	// the name used for a side of a diff where the file does not exist
+	DIFF_NULL_FILE = "/dev/null"
+)
+
+type editKind int
+
+const (
+	editEqual editKind = iota
+	editDelete
+	editInsert
+)
+
+// a single line of an edit script
+type edit struct {
+	kind editKind
+	line string
+}
+
+// splits contents into lines, keeping line endings so that a missing final newline is preserved
+func splitLines(contents string) []string {
+	if contents == "" {
+		return []string{}
+	}
+	lines := strings.SplitAfter(contents, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// computes the shortest edit script between two sets of lines (Myers' algorithm)
+func shortestEdit(a []string, b []string) []edit {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	trace := [][]int{}
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// walk the trace backwards to recover the edits
+	edits := []edit{}
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, edit{kind: editEqual, line: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, edit{kind: editInsert, line: b[y-1]})
+			} else {
+				edits = append(edits, edit{kind: editDelete, line: a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// the line number printed in a hunk header; empty ranges refer to the line before them
+func hunkStart(start int, length int) int {
+	if length == 0 {
+		return start
+	}
+	return start + 1
+}
+
+// Generates a unified diff between two versions of a file. Nil contents mean the file does not
+// exist on that side of the diff. An empty string is returned if nothing changed.
+func UnifiedDiff(fromName string, toName string, before []byte, after []byte) string {
+	if before == nil {
+		fromName = DIFF_NULL_FILE
+	}
+	if after == nil {
+		toName = DIFF_NULL_FILE
+	}
+
+	edits := shortestEdit(splitLines(string(before)), splitLines(string(after)))
+
+	// the number of lines of each side consumed before each edit
+	aPos := make([]int, len(edits)+1)
+	bPos := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if e.kind != editInsert {
+			aPos[i+1]++
+		}
+		if e.kind != editDelete {
+			bPos[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(edits); {
+		if edits[i].kind == editEqual {
+			i++
+			continue
+		}
+
+		// extend the hunk until there is enough unchanged context to separate it from the next change
+		lo := max(0, i-DIFF_CONTEXT_LINES)
+		hi := i
+		for hi < len(edits) {
+			if edits[hi].kind != editEqual {
+				hi++
+				continue
+			}
+			run := hi
+			for run < len(edits) && edits[run].kind == editEqual {
+				run++
+			}
+			if run == len(edits) || run-hi > 2*DIFF_CONTEXT_LINES {
+				hi = min(run, hi+DIFF_CONTEXT_LINES)
+				break
+			}
+			hi = run
+		}
+
+		if sb.Len() == 0 {
+			sb.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", fromName, toName))
+		}
+		aLen, bLen := aPos[hi]-aPos[lo], bPos[hi]-bPos[lo]
+		sb.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", hunkStart(aPos[lo], aLen), aLen, hunkStart(bPos[lo], bLen), bLen))
+		for _, e := range edits[lo:hi] {
+			switch e.kind {
+			case editEqual:
+				sb.WriteString(" ")
+			case editDelete:
+				sb.WriteString("-")
+			case editInsert:
+				sb.WriteString("+")
+			}
+			sb.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = hi
+	}
+
+	return sb.String()
+}
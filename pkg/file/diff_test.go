@@ -0,0 +1,50 @@
+package file
+
+import (
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	type args struct {
+		before []byte
+		after  []byte
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "returns nothing when nothing changed",
+			args: args{before: []byte("a\nb\n"), after: []byte("a\nb\n")},
+			want: "",
+		},
+		{
+			name: "diffs a new file",
+			args: args{before: nil, after: []byte("a\nb\n")},
+			want: "--- /dev/null\n+++ b/main.tf\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "diffs a removed line with context",
+			args: args{before: []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n"), after: []byte("1\n2\n3\n4\n6\n7\n8\n9\n")},
+			want: "--- a/main.tf\n+++ b/main.tf\n@@ -2,7 +2,6 @@\n 2\n 3\n 4\n-5\n 6\n 7\n 8\n",
+		},
+		{
+			name: "splits distant changes into separate hunks",
+			args: args{before: []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"), after: []byte("0\n2\n3\n4\n5\n6\n7\n8\n9\n11\n")},
+			want: "--- a/main.tf\n+++ b/main.tf\n@@ -1,4 +1,4 @@\n-1\n+0\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+11\n",
+		},
+		{
+			name: "marks a missing newline at the end of the file",
+			args: args{before: []byte("a\nb"), after: []byte("a\nb\nc\n")},
+			want: "--- a/main.tf\n+++ b/main.tf\n@@ -1,2 +1,3 @@\n a\n-b\n\\ No newline at end of file\n+b\n+c\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnifiedDiff("a/main.tf", "b/main.tf", tt.args.before, tt.args.after); got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,11 +6,20 @@ import (
 	"path"
 	"path/filepath"
 	"slices"
+	"strings"
 )
 
-const EXT_TERRAFORM = ".tf"
+const (
+	EXT_TERRAFORM      = ".tf"
+	EXT_TERRAFORM_JSON = ".tf.json"
+)
+
+// determines if a file holds terraform configuration in JSON syntax (marked by ".tf.json" extension)
+func IsTerraformJsonFile(name string) bool {
+	return strings.HasSuffix(name, EXT_TERRAFORM_JSON)
+}
 
-// retrieves the full path all terraform files in directory (marked by ".tf" extension)
+// retrieves the full path all terraform files in directory (marked by ".tf" or ".tf.json" extension)
 func GetAllTerraformFilesInDirectory(dir string) ([]string, error) {
 	stats, err := os.Stat(dir)
 	if err != nil {
@@ -26,7 +35,7 @@ func GetAllTerraformFilesInDirectory(dir string) ([]string, error) {
 	}
 	ret := []string{}
 	for _, entry := range entries {
-		if entry.Type().IsRegular() && filepath.Ext(entry.Name()) == EXT_TERRAFORM {
+		if entry.Type().IsRegular() && (filepath.Ext(entry.Name()) == EXT_TERRAFORM || IsTerraformJsonFile(entry.Name())) {
 			ret = append(ret, path.Join(dir, entry.Name()))
 		}
 	}
@@ -38,6 +38,15 @@ func TestGetAllTerraformFilesInDirectory(t *testing.T) {
 			want:    []string{"main.tf", "data.tf", "backend.tf"},
 			wantErr: false,
 		},
+		{
+			name: "works with json syntax files",
+			args: args{
+				contents: map[string]string{"main.tf": "abc", "generated.tf.json": "{}", "notes.json": "{}"},
+				mutator:  func(dir string) string { return dir },
+			},
+			want:    []string{"main.tf", "generated.tf.json"},
+			wantErr: false,
+		},
 		{
 			name: "errors when providing a non-existent directory",
 			args: args{
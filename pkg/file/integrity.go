@@ -39,3 +39,9 @@ func GenerateMd5ForFiles(paths []string) (map[string]string, error) {
 
 	return ret, nil
 }
+
+// generates the md5 checksum of some contents
+func Md5(contents []byte) string {
+	sum := md5.Sum(contents)
+	return hex.EncodeToString(sum[:])
+}
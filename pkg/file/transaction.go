@@ -0,0 +1,265 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// the suffix of the temporary file a change is staged in, next to the file it replaces
+const STAGED_FILE_SUFFIX = ".tuf-staged"
+
+// a file written or removed by a transaction
+type stagedChange struct {
+	// the file that is changed
+	Path string `json:"path"`
+	// the temporary file the new contents are staged in; empty if the file is removed
+	Staged string `json:"staged,omitempty"`
+
+	contents []byte
+}
+
+// A Transaction writes and removes a set of files all at once. Every change is staged in a temporary file next
+// to the file it replaces and synced to disk; once every change is staged, the transaction is committed by
+// marking its manifest in the journal, and the staged files are renamed into place. A process that dies while
+// staging leaves a manifest that is rolled back by RecoverTransaction, and one that dies after committing leaves
+// a manifest that RecoverTransaction finishes, so the files are never left with only some of the changes.
+type Transaction struct {
+	// the file the manifest is kept in while the transaction commits; empty to commit without recovery
+	journal string
+	// whether every change has been staged, after which the transaction is finished rather than rolled back
+	Committed bool            `json:"committed"`
+	Changes   []*stagedChange `json:"changes"`
+	// data the caller needs to finish its own work if the process dies after committing
+	Data string `json:"data,omitempty"`
+}
+
+// Starts a transaction whose manifest is kept in the given journal file while it commits
+func NewTransaction(journal string) *Transaction {
+	return &Transaction{journal: journal, Changes: []*stagedChange{}}
+}
+
+func (t *Transaction) change(path string) *stagedChange {
+	path = filepath.Clean(path)
+	idx := slices.IndexFunc(t.Changes, func(c *stagedChange) bool { return c.Path == path })
+	if idx >= 0 {
+		return t.Changes[idx]
+	}
+	c := &stagedChange{Path: path}
+	t.Changes = append(t.Changes, c)
+	return c
+}
+
+// Write stages new contents for a file, replacing any change already staged for it
+func (t *Transaction) Write(path string, contents []byte) {
+	c := t.change(path)
+	c.Staged, c.contents = c.Path+STAGED_FILE_SUFFIX, contents
+}
+
+// Remove stages the removal of a file, replacing any change already staged for it
+func (t *Transaction) Remove(path string) {
+	c := t.change(path)
+	c.Staged, c.contents = "", nil
+}
+
+// Commit stages every change, then commits the transaction and moves the changes into place. The data is kept
+// in the manifest until Close, so that a caller that dies after committing can finish its work on recovery.
+// An error before the commit leaves every file untouched; an error after it leaves the manifest in the journal
+// for RecoverTransaction to finish
+func (t *Transaction) Commit(data []byte) error {
+	t.Data = string(data)
+	// the manifest is written first so that files staged before a crash can be found and removed
+	if err := t.writeManifest(); err != nil {
+		return err
+	}
+	for _, c := range t.Changes {
+		if c.Staged == "" {
+			continue
+		}
+		if err := writeSynced(c.Staged, c.contents, fileMode(c.Path)); err != nil {
+			return errors.Join(fmt.Errorf("failed to stage %s: %w", c.Path, err), t.rollback())
+		}
+	}
+	syncDirectories(t.Changes)
+
+	t.Committed = true
+	if err := t.writeManifest(); err != nil {
+		return errors.Join(err, t.rollback())
+	}
+	if err := t.finish(); err != nil {
+		return fmt.Errorf("%w; the changes will be finished by the next tuf command", err)
+	}
+
+	return nil
+}
+
+// Close removes the manifest of a committed transaction, once everything that depends on it has been done
+func (t *Transaction) Close() error {
+	if t.journal == "" {
+		return nil
+	}
+	if err := os.Remove(t.journal); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove transaction journal %s: %w", t.journal, err)
+	}
+
+	return nil
+}
+
+// Finishes a transaction left in the journal by a process that died while committing it. A transaction that was
+// not committed is rolled back, removing what was staged, and nil is returned. A committed transaction has the
+// rest of its changes moved into place and is returned, so that the caller can finish its own work with the data
+// of the transaction and then Close it
+func RecoverTransaction(journal string) (*Transaction, error) {
+	t, err := ReadTransaction(journal)
+	if err != nil || t == nil {
+		return nil, err
+	}
+	if !t.Committed {
+		return nil, t.rollback()
+	}
+	if err = t.finish(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Reads the manifest of a transaction left in the journal without finishing or rolling it back, so that it can
+// be reported without the lock that recovering it needs. Returns nil if the journal holds no transaction
+func ReadTransaction(journal string) (*Transaction, error) {
+	if journal == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(journal)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transaction journal %s: %w", journal, err)
+	}
+
+	t := &Transaction{journal: journal}
+	if err = json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("failed to read transaction journal %s: %w", journal, err)
+	}
+
+	return t, nil
+}
+
+// moves every staged change into place; changes already moved before a crash are skipped
+func (t *Transaction) finish() error {
+	for _, c := range t.Changes {
+		if c.Staged == "" {
+			if err := os.Remove(c.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to remove %s: %w", c.Path, err)
+			}
+			continue
+		}
+		if err := os.Rename(c.Staged, c.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to move %s into place: %w", c.Path, err)
+		}
+	}
+	syncDirectories(t.Changes)
+
+	return nil
+}
+
+// removes every staged file and the manifest, leaving the files the transaction would have changed untouched
+func (t *Transaction) rollback() error {
+	errs := []error{}
+	for _, c := range t.Changes {
+		if c.Staged == "" {
+			continue
+		}
+		if err := os.Remove(c.Staged); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("failed to remove staged file %s: %w", c.Staged, err))
+		}
+	}
+	errs = append(errs, t.Close())
+
+	return errors.Join(errs...)
+}
+
+// replaces the manifest in the journal, syncing it to disk
+func (t *Transaction) writeManifest() error {
+	if t.journal == "" {
+		return nil
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transaction: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(t.journal), 0755); err != nil {
+		return fmt.Errorf("failed to create transaction journal directory: %w", err)
+	}
+
+	if err = ReplaceFile(t.journal, data, 0644); err != nil {
+		return fmt.Errorf("failed to write transaction journal %s: %w", t.journal, err)
+	}
+
+	return nil
+}
+
+// replaces a single file by writing a synced temporary file next to it and renaming it into place, so that the
+// file is never read half written and the replacement has reached the disk once it returns
+func ReplaceFile(path string, contents []byte, perm fs.FileMode) error {
+	tmp := path + ".tmp"
+	if err := writeSynced(tmp, contents, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	syncDirectory(filepath.Dir(path))
+
+	return nil
+}
+
+// the permissions of an existing file, so that replacing it keeps them
+func fileMode(path string) fs.FileMode {
+	if stat, err := os.Stat(path); err == nil {
+		return stat.Mode().Perm()
+	}
+	return 0644
+}
+
+// writes a file and syncs its contents to disk before closing it
+func writeSynced(path string, contents []byte, perm fs.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(contents); err != nil {
+		return errors.Join(err, f.Close())
+	}
+	if err = f.Sync(); err != nil {
+		return errors.Join(err, f.Close())
+	}
+
+	return f.Close()
+}
+
+// syncs the directories of every change so that renames and removals within them reach the disk
+func syncDirectories(changes []*stagedChange) {
+	synced := map[string]bool{}
+	for _, c := range changes {
+		if dir := filepath.Dir(c.Path); !synced[dir] {
+			syncDirectory(dir)
+			synced[dir] = true
+		}
+	}
+}
+
+// syncs a directory to disk. Not every platform can sync a directory, so failing to is not an error
+func syncDirectory(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	d.Sync()
+}
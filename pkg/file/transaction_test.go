@@ -0,0 +1,183 @@
+package file
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/msarfaty/tuf/internal/testutils"
+)
+
+// the contents of every file in a directory
+func readDirectory(t *testing.T, dir string) map[string]string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		contents, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret[entry.Name()] = string(contents)
+	}
+	return ret
+}
+
+func TestTransaction_Commit(t *testing.T) {
+	dir := testutils.MakeDirectory(t, &testutils.TempDirOpts{
+		Contents: map[string]string{"main.tf": "old", "gone.tf": "old"},
+	})
+	if err := os.Chmod(filepath.Join(dir, "main.tf"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	journal := filepath.Join(dir, ".tuf", "transaction.json")
+
+	tx := NewTransaction(journal)
+	tx.Write(filepath.Join(dir, "main.tf"), []byte("first"))
+	tx.Write(filepath.Join(dir, "new.tf"), []byte("new"))
+	tx.Remove(filepath.Join(dir, "gone.tf"))
+	tx.Write(filepath.Join(dir, "main.tf"), []byte("last"))
+	if err := tx.Commit([]byte("data")); err != nil {
+		t.Fatalf("Transaction.Commit() error = %v", err)
+	}
+
+	want := map[string]string{"main.tf": "last", "new.tf": "new"}
+	if got := readDirectory(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("Transaction.Commit() files = %v, want %v", got, want)
+	}
+	if stat, err := os.Stat(filepath.Join(dir, "main.tf")); err != nil || stat.Mode().Perm() != 0600 {
+		t.Errorf("Transaction.Commit() did not keep the permissions of main.tf: %v", stat)
+	}
+	if _, err := os.Stat(journal); err != nil {
+		t.Errorf("Transaction.Commit() removed the journal before Close: %v", err)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatalf("Transaction.Close() error = %v", err)
+	}
+	if _, err := os.Stat(journal); !os.IsNotExist(err) {
+		t.Errorf("Transaction.Close() did not remove the journal")
+	}
+}
+
+func TestRecoverTransaction(t *testing.T) {
+	tests := []struct {
+		name string
+		// files in the directory when tuf died
+		contents  map[string]string
+		committed bool
+		changes   []*stagedChange
+		// files in the directory once recovered
+		want     map[string]string
+		wantData string
+		wantTx   bool
+	}{
+		{
+			name:      "discards changes that were not all staged",
+			contents:  map[string]string{"a.tf": "old a", "b.tf": "old b", "a.tf" + STAGED_FILE_SUFFIX: "new a"},
+			committed: false,
+			changes: []*stagedChange{
+				{Path: "a.tf", Staged: "a.tf" + STAGED_FILE_SUFFIX},
+				{Path: "b.tf", Staged: "b.tf" + STAGED_FILE_SUFFIX},
+			},
+			want:   map[string]string{"a.tf": "old a", "b.tf": "old b"},
+			wantTx: false,
+		},
+		{
+			name:      "finishes moving committed changes into place",
+			contents:  map[string]string{"a.tf": "new a", "b.tf": "old b", "b.tf" + STAGED_FILE_SUFFIX: "new b", "c.tf": "old c"},
+			committed: true,
+			changes: []*stagedChange{
+				{Path: "a.tf", Staged: "a.tf" + STAGED_FILE_SUFFIX},
+				{Path: "b.tf", Staged: "b.tf" + STAGED_FILE_SUFFIX},
+				{Path: "c.tf"},
+			},
+			want:     map[string]string{"a.tf": "new a", "b.tf": "new b"},
+			wantData: "op",
+			wantTx:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: tt.contents})
+			journal := filepath.Join(t.TempDir(), "transaction.json")
+			for _, c := range tt.changes {
+				c.Path = filepath.Join(dir, c.Path)
+				if c.Staged != "" {
+					c.Staged = filepath.Join(dir, c.Staged)
+				}
+			}
+			manifest, err := json.Marshal(&Transaction{Committed: tt.committed, Changes: tt.changes, Data: "op"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = os.WriteFile(journal, manifest, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			tx, err := RecoverTransaction(journal)
+			if err != nil {
+				t.Fatalf("RecoverTransaction() error = %v", err)
+			}
+			if (tx != nil) != tt.wantTx {
+				t.Fatalf("RecoverTransaction() = %v, wantTx %v", tx, tt.wantTx)
+			}
+			if got := readDirectory(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RecoverTransaction() files = %v, want %v", got, tt.want)
+			}
+			if tx == nil {
+				if _, err = os.Stat(journal); !os.IsNotExist(err) {
+					t.Errorf("RecoverTransaction() did not remove the journal of a rolled back transaction")
+				}
+				return
+			}
+			if tx.Data != tt.wantData {
+				t.Errorf("RecoverTransaction() data = %q, want %q", tx.Data, tt.wantData)
+			}
+			if err = tx.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// a recovered transaction has nothing left to recover
+			if tx, err = RecoverTransaction(journal); tx != nil || err != nil {
+				t.Errorf("RecoverTransaction() after Close = %v, %v, want nothing", tx, err)
+			}
+		})
+	}
+}
+
+func TestReplaceFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents map[string]string
+		want     map[string]string
+	}{
+		{
+			name:     "creates a file that does not exist",
+			contents: map[string]string{},
+			want:     map[string]string{"tuf.state": "new"},
+		},
+		{
+			name:     "replaces a file without leaving the temporary file",
+			contents: map[string]string{"tuf.state": "old"},
+			want:     map[string]string{"tuf.state": "new"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: tt.contents})
+			if err := ReplaceFile(filepath.Join(dir, "tuf.state"), []byte("new"), 0644); err != nil {
+				t.Fatalf("ReplaceFile() error = %v", err)
+			}
+			if got := readDirectory(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReplaceFile() left %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// the kinds of block an address can refer to, as they are written at the start of the address
+const (
+	ADDRESS_MODULE   = "module"
+	ADDRESS_RESOURCE = "resource"
+	ADDRESS_DATA     = "data"
+	ADDRESS_VARIABLE = "var"
+	ADDRESS_OUTPUT   = "output"
+	ADDRESS_LOCAL    = "local"
+)
+
+// a parsed terraform address (ie module.eks.module.node["blue"].aws_iam_role.this[0])
+type Address struct {
+	// the module calls leading to the module the block lives in; nil for blocks in the root module
+	ModulePath []*ModuleCall
+	// the kind of block addressed; one of the ADDRESS_ constants
+	Kind string
+	// the resource or data source type (ie aws_iam_role); empty for other kinds of block
+	Type string
+	// the name of the block
+	Name string
+	// the instance key as it is written (ie [0] or ["blue"]); empty if the address has none
+	Key string
+}
+
+func (a *Address) String() string {
+	var block string
+	switch a.Kind {
+	case ADDRESS_RESOURCE:
+		block = fmt.Sprintf("%s.%s%s", a.Type, a.Name, a.Key)
+	case ADDRESS_DATA:
+		block = fmt.Sprintf("%s.%s.%s%s", ADDRESS_DATA, a.Type, a.Name, a.Key)
+	default:
+		block = fmt.Sprintf("%s.%s%s", a.Kind, a.Name, a.Key)
+	}
+	return withModulePath(a.ModulePath, block)
+}
+
+// an address that could not be parsed, pointing at the character the problem was found at
+type AddressError struct {
+	Address string
+	// the byte offset of the offending character; the length of the address if it ended too early
+	Offset  int
+	Message string
+}
+
+func (e *AddressError) Error() string {
+	column := utf8.RuneCountInString(e.Address[:e.Offset]) + 1
+	return fmt.Sprintf("%s at column %d\n  %s\n  %s^", e.Message, column, e.Address, strings.Repeat(" ", column-1))
+}
+
+// reads an address from left to right
+type addressScanner struct {
+	address string
+	pos     int
+}
+
+func (s *addressScanner) fail(offset int, format string, args ...any) *AddressError {
+	return &AddressError{Address: s.address, Offset: offset, Message: fmt.Sprintf(format, args...)}
+}
+
+func (s *addressScanner) done() bool {
+	return s.pos >= len(s.address)
+}
+
+// the next character, or a description of the end of the address if there is none
+func (s *addressScanner) next() string {
+	if s.done() {
+		return "end of address"
+	}
+	r, _ := utf8.DecodeRuneInString(s.address[s.pos:])
+	return strconv.QuoteRune(r)
+}
+
+// reads an identifier, which may contain letters, digits, underscores and dashes but must start with a letter or underscore
+func (s *addressScanner) identifier(what string) (string, error) {
+	start := s.pos
+	for !s.done() {
+		r, size := utf8.DecodeRuneInString(s.address[s.pos:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+			break
+		}
+		s.pos += size
+	}
+	if start == s.pos {
+		return "", s.fail(s.pos, "unexpected %s, expected %s", s.next(), what)
+	}
+	if r, _ := utf8.DecodeRuneInString(s.address[start:]); unicode.IsDigit(r) || r == '-' {
+		return "", s.fail(start, "%s cannot start with %s", what, strconv.QuoteRune(r))
+	}
+
+	return s.address[start:s.pos], nil
+}
+
+// reads the dot that separates the parts of an address
+func (s *addressScanner) dot(what string) error {
+	if s.done() || s.address[s.pos] != '.' {
+		return s.fail(s.pos, "unexpected %s, expected . followed by %s", s.next(), what)
+	}
+	s.pos++
+	return nil
+}
+
+// reads an instance key if there is one: a count index (ie [0]) or a quoted for_each key (ie ["blue"])
+func (s *addressScanner) instanceKey() (string, error) {
+	if s.done() || s.address[s.pos] != '[' {
+		return "", nil
+	}
+	start := s.pos
+	s.pos++
+
+	switch {
+	case !s.done() && s.address[s.pos] == '"':
+		quote := s.pos
+		for s.pos++; ; s.pos++ {
+			if s.done() {
+				return "", s.fail(quote, "unterminated string in instance key")
+			}
+			if c := s.address[s.pos]; c == '\\' {
+				s.pos++
+			} else if c == '"' {
+				s.pos++
+				break
+			}
+		}
+		if _, err := strconv.Unquote(s.address[quote:s.pos]); err != nil {
+			return "", s.fail(quote, "invalid string in instance key")
+		}
+	case !s.done() && s.address[s.pos] >= '0' && s.address[s.pos] <= '9':
+		for !s.done() && s.address[s.pos] >= '0' && s.address[s.pos] <= '9' {
+			s.pos++
+		}
+	default:
+		return "", s.fail(s.pos, "unexpected %s, instance keys must be a count index or a quoted for_each key", s.next())
+	}
+
+	if s.done() || s.address[s.pos] != ']' {
+		return "", s.fail(s.pos, "unexpected %s, expected ] to close the instance key", s.next())
+	}
+	s.pos++
+	return s.address[start:s.pos], nil
+}
+
+// reads a module call (ie module.node["blue"]) after its module prefix
+func (s *addressScanner) moduleCall() (*ModuleCall, error) {
+	if err := s.dot("a module name"); err != nil {
+		return nil, err
+	}
+	name, err := s.identifier("a module name")
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.instanceKey()
+	if err != nil {
+		return nil, err
+	}
+	return &ModuleCall{Name: name, Key: key}, nil
+}
+
+// reads the module calls at the start of an address, leaving the scanner at the addressed block. Each call is
+// read up to the token after it: a dot makes the call an element of the path, while anything else makes it the
+// addressed block (ie the last call of module.eks.module.karpenter), which is left for the caller to read
+func (s *addressScanner) modulePath() ([]*ModuleCall, error) {
+	var path []*ModuleCall
+	for strings.HasPrefix(s.address[s.pos:], MODULE_PREFIX+".") {
+		start := s.pos
+		s.pos += len(MODULE_PREFIX) + 1
+		name := s.pos
+		for !s.done() && s.address[s.pos] != '.' && s.address[s.pos] != '[' {
+			s.pos++
+		}
+		if _, err := s.instanceKey(); err != nil {
+			return nil, err
+		}
+		if s.done() || s.address[s.pos] != '.' {
+			s.pos = start
+			break
+		}
+
+		if strings.ContainsAny(s.address[name:s.pos], SELECTOR_WILDCARDS) {
+			return nil, s.fail(name, "module paths cannot contain wildcards")
+		}
+		s.pos = start + len(MODULE_PREFIX)
+		mc, err := s.moduleCall()
+		if err != nil {
+			return nil, err
+		}
+		if err = s.dot("the rest of the address"); err != nil {
+			return nil, err
+		}
+		path = append(path, mc)
+	}
+
+	return path, nil
+}
+
+// reads the addressed block, after any module path
+func (s *addressScanner) block(a *Address) error {
+	kind, err := s.identifier("a block type or resource type")
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case ADDRESS_MODULE:
+		mc, err := s.moduleCall()
+		if err != nil {
+			return err
+		}
+		a.Kind, a.Name, a.Key = ADDRESS_MODULE, mc.Name, mc.Key
+	case ADDRESS_DATA:
+		if err = s.dot("a data source type"); err != nil {
+			return err
+		}
+		if a.Type, err = s.identifier("a data source type"); err != nil {
+			return err
+		}
+		if err = s.dot("a data source name"); err != nil {
+			return err
+		}
+		if a.Name, err = s.identifier("a data source name"); err != nil {
+			return err
+		}
+		a.Kind = ADDRESS_DATA
+		a.Key, err = s.instanceKey()
+	case ADDRESS_VARIABLE, ADDRESS_OUTPUT, ADDRESS_LOCAL:
+		if err = s.dot("a name"); err != nil {
+			return err
+		}
+		if a.Name, err = s.identifier("a name"); err != nil {
+			return err
+		}
+		a.Kind = kind
+		if !s.done() && s.address[s.pos] == '[' {
+			return s.fail(s.pos, "%s addresses cannot have instance keys", kind)
+		}
+	default:
+		// resources are addressed by their type, without a prefix
+		if err = s.dot("a resource name"); err != nil {
+			return err
+		}
+		if a.Name, err = s.identifier("a resource name"); err != nil {
+			return err
+		}
+		a.Kind, a.Type = ADDRESS_RESOURCE, kind
+		a.Key, err = s.instanceKey()
+	}
+
+	return err
+}
+
+// Parses a terraform address: any number of module calls followed by a module call, resource, data source,
+// variable, output or local value. Errors are *AddressError values pointing at the offending character
+func ParseAddress(address string) (*Address, error) {
+	s := &addressScanner{address: address}
+	path, err := s.modulePath()
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Address{ModulePath: path}
+	if err = s.block(a); err != nil {
+		return nil, err
+	}
+	if !s.done() {
+		return nil, s.fail(s.pos, "unexpected %s after the end of the address", s.next())
+	}
+
+	return a, nil
+}
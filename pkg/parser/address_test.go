@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		name       string
+		address    string
+		want       *Address
+		wantOffset int
+		wantErr    bool
+	}{
+		{
+			name:    "parses a resource",
+			address: "aws_iam_role.this",
+			want:    &Address{Kind: ADDRESS_RESOURCE, Type: "aws_iam_role", Name: "this"},
+			wantErr: false,
+		},
+		{
+			name:    "parses a data source with a count index",
+			address: "data.aws_iam_policy_document.this[0]",
+			want:    &Address{Kind: ADDRESS_DATA, Type: "aws_iam_policy_document", Name: "this", Key: "[0]"},
+			wantErr: false,
+		},
+		{
+			name:    "keeps dots and brackets within for_each keys",
+			address: "module.node[\"a.b]\"].aws_iam_role.this[\"c.d\"]",
+			want: &Address{
+				ModulePath: []*ModuleCall{{Name: "node", Key: "[\"a.b]\"]"}},
+				Kind:       ADDRESS_RESOURCE,
+				Type:       "aws_iam_role",
+				Name:       "this",
+				Key:        "[\"c.d\"]",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "parses a nested module call",
+			address: "module.eks.module.karpenter[\"x\"]",
+			want:    &Address{ModulePath: []*ModuleCall{{Name: "eks"}}, Kind: ADDRESS_MODULE, Name: "karpenter", Key: "[\"x\"]"},
+			wantErr: false,
+		},
+		{
+			name:    "parses a local value",
+			address: "local.tags",
+			want:    &Address{Kind: ADDRESS_LOCAL, Name: "tags"},
+			wantErr: false,
+		},
+		{
+			name:       "points at a missing data source name",
+			address:    "data.aws_caller_identity",
+			wantOffset: 24,
+			wantErr:    true,
+		},
+		{
+			name:       "points at an unquoted for_each key",
+			address:    "aws_iam_role.this[blue]",
+			wantOffset: 18,
+			wantErr:    true,
+		},
+		{
+			name:       "points at an unterminated for_each key",
+			address:    "module.node[\"blue].aws_iam_role.this",
+			wantOffset: 12,
+			wantErr:    true,
+		},
+		{
+			name:       "points at an instance key before the end of a block",
+			address:    "aws_iam_role[0].this",
+			wantOffset: 12,
+			wantErr:    true,
+		},
+		{
+			name:       "points at an instance key on a variable",
+			address:    "var.region[0]",
+			wantOffset: 10,
+			wantErr:    true,
+		},
+		{
+			name:       "points at a name starting with a digit",
+			address:    "module.eks.aws_iam_role.0this",
+			wantOffset: 24,
+			wantErr:    true,
+		},
+		{
+			name:       "points at a wildcard in a module path",
+			address:    "module.*.aws_iam_role.this",
+			wantOffset: 7,
+			wantErr:    true,
+		},
+		{
+			name:       "points at an invalid module name in a module path",
+			address:    "module.eks cluster.aws_iam_role.this",
+			wantOffset: 10,
+			wantErr:    true,
+		},
+		{
+			name:       "points at trailing characters",
+			address:    "module.toomany.parts.here.too",
+			wantOffset: 25,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAddress(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var addressErr *AddressError
+				if !errors.As(err, &addressErr) || addressErr.Offset != tt.wantOffset {
+					t.Errorf("ParseAddress() error = %v, want offset %d", err, tt.wantOffset)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAddress() = %v, want %v", got, tt.want)
+			}
+			if got.String() != tt.address {
+				t.Errorf("ParseAddress().String() = %s, want %s", got.String(), tt.address)
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package parser
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/hashicorp/hcl/v2"
 )
@@ -13,6 +12,11 @@ type BlockDescription interface {
 	Matches(block hcl.Block) bool
 	// Determines a useful destination file name for the block
 	DestinationFileName() string
+	// the instance key of the address (ie [0] or ["blue"]); empty if the address has none.
+	// blocks are matched regardless of the key, since every instance shares the same block
+	InstanceKey() string
+	// the module calls leading to the module the block lives in; empty for blocks in the root module
+	ModulePath() []*ModuleCall
 	// reverse the address name
 	address() string
 }
@@ -22,6 +26,10 @@ type ModuleBlockDescription struct {
 	BlockDescription
 	// The name of the module
 	name string
+	// the instance key of the module call, if any
+	key string
+	// the module calls leading to the module this module is called from
+	modulePath []*ModuleCall
 }
 
 type ResourceBlockDescription struct {
@@ -30,6 +38,23 @@ type ResourceBlockDescription struct {
 	rType string
 	// resource name
 	name string
+	// the instance key of the resource, if any
+	key string
+	// the module calls leading to the module this resource lives in
+	modulePath []*ModuleCall
+}
+
+// descriptive characteristics of a data block
+type DataBlockDescription struct {
+	BlockDescription
+	// data source type (ie aws_caller_identity)
+	dType string
+	// data source name
+	name string
+	// the instance key of the data source, if any
+	key string
+	// the module calls leading to the module this data source lives in
+	modulePath []*ModuleCall
 }
 
 // determines if the given hcl block matches the description of this ModuleBlockDescription
@@ -50,8 +75,16 @@ func (m *ModuleBlockDescription) DestinationFileName() string {
 	return fmt.Sprintf("module_%s.tuf.tf", m.name)
 }
 
+func (m *ModuleBlockDescription) InstanceKey() string {
+	return m.key
+}
+
+func (m *ModuleBlockDescription) ModulePath() []*ModuleCall {
+	return m.modulePath
+}
+
 func (m *ModuleBlockDescription) address() string {
-	return fmt.Sprintf("module.%s", m.name)
+	return withModulePath(m.modulePath, fmt.Sprintf("module.%s%s", m.name, m.key))
 }
 
 // determines if the given hcl block matches the description of this ResourceBlockDescription
@@ -72,55 +105,227 @@ func (m *ResourceBlockDescription) DestinationFileName() string {
 	return "resources.tuf.tf"
 }
 
+func (m *ResourceBlockDescription) InstanceKey() string {
+	return m.key
+}
+
+func (m *ResourceBlockDescription) ModulePath() []*ModuleCall {
+	return m.modulePath
+}
+
 func (m *ResourceBlockDescription) address() string {
-	return fmt.Sprintf("%s.%s", m.rType, m.name)
+	return withModulePath(m.modulePath, fmt.Sprintf("%s.%s%s", m.rType, m.name, m.key))
 }
 
-// Creates a BlockDescription for module address calls
-func newModuleBlockDescription(address string) (*ModuleBlockDescription, error) {
-	parts := strings.Split(address, ".")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("wrong number of parts to describe address for module %s", address)
+// determines if the given hcl block matches the description of this DataBlockDescription
+func (m *DataBlockDescription) Matches(block hcl.Block) bool {
+	if block.Type != "data" {
+		return false
 	}
 
-	if parts[0] != "module" {
-		return nil, fmt.Errorf("cannot make module block description from invalid module address %s", address)
+	if len(block.Labels) != 2 {
+		// expect a data source type label and name label, but do not throw error
+		return false
 	}
 
-	return &ModuleBlockDescription{name: parts[1]}, nil
+	return block.Labels[0] == m.dType && block.Labels[1] == m.name
+}
+
+func (m *DataBlockDescription) DestinationFileName() string {
+	return "data.tuf.tf"
+}
+
+func (m *DataBlockDescription) InstanceKey() string {
+	return m.key
+}
+
+func (m *DataBlockDescription) ModulePath() []*ModuleCall {
+	return m.modulePath
+}
+
+func (m *DataBlockDescription) address() string {
+	return withModulePath(m.modulePath, fmt.Sprintf("data.%s.%s%s", m.dType, m.name, m.key))
+}
+
+// descriptive characteristics of a variable block
+type VariableBlockDescription struct {
+	BlockDescription
+	// the name of the variable
+	name string
+	// the module calls leading to the module this variable belongs to
+	modulePath []*ModuleCall
+}
+
+// descriptive characteristics of an output block
+type OutputBlockDescription struct {
+	BlockDescription
+	// the name of the output
+	name string
+	// the module calls leading to the module this output belongs to
+	modulePath []*ModuleCall
+}
+
+// descriptive characteristics of a single local value. locals share a locals block, so
+// a LocalDescription matches the locals block that defines it but only describes the one attribute
+type LocalDescription struct {
+	BlockDescription
+	// the name of the local value
+	name string
+	// the module calls leading to the module this local belongs to
+	modulePath []*ModuleCall
+}
+
+// a description of a single attribute within a matched block, rather than the whole block
+type AttributeDescription interface {
+	BlockDescription
+	// the name of the attribute within the matched block
+	AttributeName() string
+}
+
+// determines if the given hcl block matches the description of this VariableBlockDescription
+func (m *VariableBlockDescription) Matches(block hcl.Block) bool {
+	return block.Type == "variable" && len(block.Labels) == 1 && block.Labels[0] == m.name
+}
+
+func (m *VariableBlockDescription) DestinationFileName() string {
+	return "variables.tuf.tf"
+}
+
+func (m *VariableBlockDescription) InstanceKey() string {
+	return ""
 }
 
-func newResourceBlockDescription(address string) (*ResourceBlockDescription, error) {
-	parts := strings.Split(address, ".")
+func (m *VariableBlockDescription) ModulePath() []*ModuleCall {
+	return m.modulePath
+}
+
+func (m *VariableBlockDescription) address() string {
+	return withModulePath(m.modulePath, fmt.Sprintf("var.%s", m.name))
+}
+
+// determines if the given hcl block matches the description of this OutputBlockDescription
+func (m *OutputBlockDescription) Matches(block hcl.Block) bool {
+	return block.Type == "output" && len(block.Labels) == 1 && block.Labels[0] == m.name
+}
+
+func (m *OutputBlockDescription) DestinationFileName() string {
+	return "outputs.tuf.tf"
+}
+
+func (m *OutputBlockDescription) InstanceKey() string {
+	return ""
+}
 
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("wrong number of parts to describe address of resource (%s)", address)
+func (m *OutputBlockDescription) ModulePath() []*ModuleCall {
+	return m.modulePath
+}
+
+func (m *OutputBlockDescription) address() string {
+	return withModulePath(m.modulePath, fmt.Sprintf("output.%s", m.name))
+}
+
+// determines if the given hcl block is a locals block that defines this local
+func (m *LocalDescription) Matches(block hcl.Block) bool {
+	if block.Type != "locals" || len(block.Labels) != 0 {
+		return false
 	}
 
-	return &ResourceBlockDescription{rType: parts[0], name: parts[1]}, nil
+	// locals blocks only hold attributes, in both native and JSON syntax
+	attrs, diags := block.Body.JustAttributes()
+	if diags.HasErrors() {
+		return false
+	}
+	_, ok := attrs[m.name]
+	return ok
 }
 
-// creates a new BlockDescription to aid in finding terraform blocks
-func New(address string) (BlockDescription, error) {
-	parts := strings.Split(address, ".")
+func (m *LocalDescription) DestinationFileName() string {
+	return "locals.tuf.tf"
+}
 
-	if len(parts) <= 1 {
-		return nil, fmt.Errorf("not enough parts for resource %s", address)
+func (m *LocalDescription) InstanceKey() string {
+	return ""
+}
+
+func (m *LocalDescription) ModulePath() []*ModuleCall {
+	return m.modulePath
+}
+
+func (m *LocalDescription) AttributeName() string {
+	return m.name
+}
+
+func (m *LocalDescription) address() string {
+	return withModulePath(m.modulePath, fmt.Sprintf("local.%s", m.name))
+}
+
+// whether the described block has no terraform state of its own; variables, outputs and locals
+// only exist in configuration, so moving them never needs state remediation
+func Stateless(bd BlockDescription) bool {
+	switch bd.(type) {
+	case *VariableBlockDescription, *OutputBlockDescription, *LocalDescription:
+		return true
 	}
+	return false
+}
 
-	var bd BlockDescription
-	var err error
-	switch parts[0] {
-	case "module":
-		bd, err = newModuleBlockDescription(address)
-	default:
-		// resource address do not have a static starting path
-		bd, err = newResourceBlockDescription(address)
+// prefixes the address of a block with the module path it lives in
+func withModulePath(path []*ModuleCall, address string) string {
+	if len(path) == 0 {
+		return address
 	}
+	return ModulePathString(path) + "." + address
+}
+
+// Creates a BlockDescription for module address calls
+func newModuleBlockDescription(a *Address) *ModuleBlockDescription {
+	return &ModuleBlockDescription{name: a.Name, key: a.Key, modulePath: a.ModulePath}
+}
+
+func newResourceBlockDescription(a *Address) *ResourceBlockDescription {
+	return &ResourceBlockDescription{rType: a.Type, name: a.Name, key: a.Key, modulePath: a.ModulePath}
+}
 
+// Creates a BlockDescription for data source addresses
+func newDataBlockDescription(a *Address) *DataBlockDescription {
+	return &DataBlockDescription{dType: a.Type, name: a.Name, key: a.Key, modulePath: a.ModulePath}
+}
+
+// Creates a BlockDescription for variable addresses (ie var.region)
+func newVariableBlockDescription(a *Address) *VariableBlockDescription {
+	return &VariableBlockDescription{name: a.Name, modulePath: a.ModulePath}
+}
+
+// Creates a BlockDescription for output addresses (ie output.cluster_name)
+func newOutputBlockDescription(a *Address) *OutputBlockDescription {
+	return &OutputBlockDescription{name: a.Name, modulePath: a.ModulePath}
+}
+
+// Creates a BlockDescription for local value addresses (ie local.tags)
+func newLocalDescription(a *Address) *LocalDescription {
+	return &LocalDescription{name: a.Name, modulePath: a.ModulePath}
+}
+
+// creates a new BlockDescription to aid in finding terraform blocks.
+// Addresses may start with a module path (ie module.eks.module.karpenter.aws_iam_role.this).
+func New(address string) (BlockDescription, error) {
+	a, err := ParseAddress(address)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find a valid description for %s: %w", address, err)
 	}
 
-	return bd, nil
+	switch a.Kind {
+	case ADDRESS_MODULE:
+		return newModuleBlockDescription(a), nil
+	case ADDRESS_DATA:
+		return newDataBlockDescription(a), nil
+	case ADDRESS_VARIABLE:
+		return newVariableBlockDescription(a), nil
+	case ADDRESS_OUTPUT:
+		return newOutputBlockDescription(a), nil
+	case ADDRESS_LOCAL:
+		return newLocalDescription(a), nil
+	default:
+		return newResourceBlockDescription(a), nil
+	}
 }
@@ -37,8 +37,99 @@ func TestNew(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name:    "factory does not create anything with data block",
-			args:    args{address: "data.aws_security_group.foo"},
+			name: "factory creates data block description",
+			args: args{address: "data.aws_caller_identity.current"},
+			want: &DataBlockDescription{
+				dType: "aws_caller_identity",
+				name:  "current",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "factory fails creating data block desc with too few parts",
+			args:    args{address: "data.aws_caller_identity"},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "factory keeps the count index of a resource",
+			args: args{address: "aws_iam_role.this[0]"},
+			want: &ResourceBlockDescription{
+				rType: "aws_iam_role",
+				name:  "this",
+				key:   "[0]",
+			},
+			wantErr: false,
+		},
+		{
+			name: "factory keeps the for_each key of a module",
+			args: args{address: "module.node[\"blue.green\"]"},
+			want: &ModuleBlockDescription{
+				name: "node",
+				key:  "[\"blue.green\"]",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "factory fails with a malformed instance key",
+			args:    args{address: "aws_iam_role.this[blue]"},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "factory keeps the module path of a resource in a nested module",
+			args: args{address: "module.eks.module.node[\"blue\"].aws_iam_role.this[0]"},
+			want: &ResourceBlockDescription{
+				rType:      "aws_iam_role",
+				name:       "this",
+				key:        "[0]",
+				modulePath: []*ModuleCall{{Name: "eks"}, {Name: "node", Key: "[\"blue\"]"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "factory keeps the module path of a nested module call",
+			args: args{address: "module.eks.module.karpenter"},
+			want: &ModuleBlockDescription{
+				name:       "karpenter",
+				modulePath: []*ModuleCall{{Name: "eks"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "factory creates variable block description",
+			args: args{address: "var.region"},
+			want: &VariableBlockDescription{
+				name: "region",
+			},
+			wantErr: false,
+		},
+		{
+			name: "factory creates output block description",
+			args: args{address: "module.eks.output.cluster_name"},
+			want: &OutputBlockDescription{
+				name:       "cluster_name",
+				modulePath: []*ModuleCall{{Name: "eks"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "factory creates local description",
+			args: args{address: "local.tags"},
+			want: &LocalDescription{
+				name: "tags",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "factory fails with an instance key on a local",
+			args:    args{address: "local.tags[0]"},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "factory fails with an instance key before the end of a block address",
+			args:    args{address: "aws_iam_role[0].this"},
 			want:    nil,
 			wantErr: true,
 		},
@@ -134,3 +225,123 @@ func TestModuleBlockDescription_Matches(t *testing.T) {
 		})
 	}
 }
+
+func TestDataBlockDescription_Matches(t *testing.T) {
+	type fields struct {
+		dType string
+		name  string
+	}
+	type args struct {
+		filename string
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   bool
+	}{
+		{
+			name: "block matches (given data block)",
+			fields: fields{
+				dType: "aws_caller_identity",
+				name:  "current",
+			},
+			args: args{
+				filename: "example3.tf",
+			},
+			want: true,
+		},
+		{
+			name: "block doesn't match (given data block)",
+			fields: fields{
+				dType: "aws_caller_identity",
+				name:  "other",
+			},
+			args: args{
+				filename: "example3.tf",
+			},
+			want: false,
+		},
+		{
+			name: "block doesn't match (given resource block)",
+			fields: fields{
+				dType: "aws_security_group",
+				name:  "foobar",
+			},
+			args: args{
+				filename: "example2.tf",
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &DataBlockDescription{
+				dType: tt.fields.dType,
+				name:  tt.fields.name,
+			}
+			hclp := hclparse.NewParser()
+			f, diags := hclp.ParseHCLFile(fmt.Sprintf("testdata/%s", tt.args.filename))
+			if diags.HasErrors() {
+				panic(diags.Error())
+			}
+			blocks := f.BlocksAtPos(hcl.InitialPos)
+			if got := m.Matches(*blocks[0]); got != tt.want {
+				t.Errorf("DataBlockDescription.Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalDescription_Matches(t *testing.T) {
+	type args struct {
+		filename string
+	}
+	tests := []struct {
+		name  string
+		local string
+		args  args
+		want  bool
+	}{
+		{
+			name:  "block matches (given locals block defining the local)",
+			local: "tags",
+			args: args{
+				filename: "example4.tf",
+			},
+			want: true,
+		},
+		{
+			name:  "block doesn't match (given locals block without the local)",
+			local: "other",
+			args: args{
+				filename: "example4.tf",
+			},
+			want: false,
+		},
+		{
+			name:  "block doesn't match (given resource block)",
+			local: "foobar",
+			args: args{
+				filename: "example2.tf",
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &LocalDescription{
+				name: tt.local,
+			}
+			hclp := hclparse.NewParser()
+			f, diags := hclp.ParseHCLFile(fmt.Sprintf("testdata/%s", tt.args.filename))
+			if diags.HasErrors() {
+				panic(diags.Error())
+			}
+			blocks := f.BlocksAtPos(hcl.InitialPos)
+			if got := m.Matches(*blocks[0]); got != tt.want {
+				t.Errorf("LocalDescription.Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package parser
+
+import (
+	"bytes"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// whether a token is a line comment, which includes the newline that ends it
+func isLineComment(tok *hclwrite.Token) bool {
+	return tok.Type == hclsyntax.TokenComment && bytes.HasSuffix(tok.Bytes, []byte("\n"))
+}
+
+// whether the token at the given index is the first thing on its line
+func startsLine(tokens hclwrite.Tokens, i int) bool {
+	return i == 0 || tokens[i-1].Type == hclsyntax.TokenNewline || isLineComment(tokens[i-1])
+}
+
+// the tokens of a top level block along with the comments attached to it, as a range [start, end) of the tokens
+// of its file. Comments are attached when they sit on their own lines directly above the block, with no blank
+// line between them and the block (or each other), or when they follow the closing brace of the block on the
+// same line. A comment separated from the block by a blank line (ie a section banner) is left where it is.
+// hclwrite already attaches line comments this way; block comments (/* */) above a block are attached here
+func attachedTokens(tokens hclwrite.Tokens, block *hclwrite.Block) (int, int) {
+	own := withoutEOF(block.BuildTokens(nil))
+	start := indexOfToken(tokens, own[0])
+	end := start + len(own)
+
+	for start > 0 {
+		switch {
+		case isLineComment(tokens[start-1]) && startsLine(tokens, start-1):
+			start--
+		case start > 1 && tokens[start-1].Type == hclsyntax.TokenNewline && tokens[start-2].Type == hclsyntax.TokenComment && !isLineComment(tokens[start-2]) && startsLine(tokens, start-2):
+			start -= 2
+		default:
+			return start, end
+		}
+	}
+
+	return start, end
+}
@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestAttachedTokens(t *testing.T) {
+	block := "resource \"aws_iam_role\" \"this\" {\n}"
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{
+			name:     "takes line comments directly above the block",
+			contents: "locals {}\n\n# one\n// two\n" + block + "\n",
+			want:     "# one\n// two\n" + block,
+		},
+		{
+			name:     "takes block comments directly above the block",
+			contents: "locals {}\n# one\n/* two\n   three */\n" + block + "\n",
+			want:     "# one\n/* two\n   three */\n" + block,
+		},
+		{
+			name:     "leaves comments separated by a blank line",
+			contents: "####\n# Section\n####\n\n# attached\n" + block + "\n",
+			want:     "# attached\n" + block,
+		},
+		{
+			name:     "leaves trailing comments of other statements",
+			contents: "locals {} # about locals\n" + block + "\n",
+			want:     block,
+		},
+		{
+			name:     "takes a trailing comment after the closing brace",
+			contents: block + " /* done */\n# about the next block\nlocals {}\n",
+			want:     block + " /* done */",
+		},
+		{
+			name:     "takes a trailing line comment without its newline",
+			contents: block + " # done\n",
+			want:     block + " # done",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parseNativeFile("main.tf", []byte(tt.contents))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens := f.tokens()
+			for _, b := range f.file.Body().Blocks() {
+				if b.Type() != "resource" {
+					continue
+				}
+				start, end := attachedTokens(tokens, b)
+				got := f.byteRange(tokens, start, end)
+				if s := tt.contents[got.Start:got.End]; s != tt.want {
+					t.Errorf("attachedTokens() = %q, want %q", s, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+	filestats "github.com/msarfaty/tuf/pkg/file"
+)
+
+// the top level blocks tuf knows how to find in JSON syntax files, which cannot be read without a schema
+var topLevelSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "module", LabelNames: []string{"name"}},
+		{Type: "resource", LabelNames: []string{"type", "name"}},
+		{Type: "data", LabelNames: []string{"type", "name"}},
+		{Type: "variable", LabelNames: []string{"name"}},
+		{Type: "output", LabelNames: []string{"name"}},
+		{Type: "locals"},
+		{Type: "provider", LabelNames: []string{"name"}},
+		{Type: "terraform"},
+	},
+}
+
+// a terraform configuration file in either native or JSON syntax
+type configFile struct {
+	// the top level blocks of the file, in the order they are written
+	blocks []*hcl.Block
+	// the native syntax blocks, in the same order as blocks; empty for JSON files
+	native []*hclsyntax.Block
+	// whether the file is written in JSON syntax
+	isJson bool
+}
+
+// parses the contents of a terraform file, choosing the syntax by its extension
+func parseConfig(name string, contents []byte) (*configFile, error) {
+	if filestats.IsTerraformJsonFile(name) {
+		f, diags := hcljson.Parse(contents, name)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse file %s: %s", name, diags.Error())
+		}
+		content, _, diags := f.Body.PartialContent(topLevelSchema)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse file %s: %s", name, diags.Error())
+		}
+		return &configFile{blocks: content.Blocks, isJson: true}, nil
+	}
+
+	f, diags := hclsyntax.ParseConfig(contents, name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse file %s: %s", name, diags.Error())
+	}
+	body, ok := f.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, fmt.Errorf("error casting hcl in file=(%s) to hclsyntax", name)
+	}
+	cf := &configFile{}
+	for _, block := range body.Blocks {
+		cf.blocks = append(cf.blocks, block.AsHCLBlock())
+		cf.native = append(cf.native, block)
+	}
+
+	return cf, nil
+}
@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/hashicorp/hcl/v2"
+	filestats "github.com/msarfaty/tuf/pkg/file"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+const (
+	// the meta-argument that gives a block a number of instances
+	COUNT_ATTRIBUTE = "count"
+	// the meta-argument that gives a block an instance for each key of a map or set
+	FOR_EACH_ATTRIBUTE = "for_each"
+)
+
+// the functions literal count and for_each values are commonly written with
+var instanceFunctions = map[string]function.Function{
+	"toset": stdlib.MakeToFunc(cty.Set(cty.DynamicPseudoType)),
+	"tomap": stdlib.MakeToFunc(cty.Map(cty.DynamicPseudoType)),
+}
+
+// the instance keys of a block as they are written in an address (ie [0] or ["blue"]), evaluated from its count or
+// for_each. A block with neither has a single instance without a key. ok is false if the count or for_each is not a
+// literal value, since only terraform can evaluate those
+func blockInstanceKeys(block *hcl.Block) ([]string, bool, error) {
+	content, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: COUNT_ATTRIBUTE}, {Name: FOR_EACH_ATTRIBUTE}},
+	})
+	if diags.HasErrors() {
+		return nil, false, fmt.Errorf("failed to read %s: %s", block.DefRange, diags.Error())
+	}
+
+	attr, isCount := content.Attributes[COUNT_ATTRIBUTE]
+	if !isCount {
+		if attr = content.Attributes[FOR_EACH_ATTRIBUTE]; attr == nil {
+			return []string{""}, true, nil
+		}
+	}
+	value, diags := attr.Expr.Value(&hcl.EvalContext{Functions: instanceFunctions})
+	if diags.HasErrors() || !value.IsWhollyKnown() || value.IsNull() {
+		return nil, false, nil
+	}
+
+	keys := []string{}
+	switch {
+	case isCount && value.Type().Equals(cty.Number):
+		count, _ := value.AsBigFloat().Int64()
+		for i := int64(0); i < count; i++ {
+			keys = append(keys, fmt.Sprintf("[%d]", i))
+		}
+	case !isCount && (value.Type().IsMapType() || value.Type().IsObjectType()):
+		for _, key := range slices.Sorted(maps.Keys(value.AsValueMap())) {
+			keys = append(keys, fmt.Sprintf("[%s]", strconv.Quote(key)))
+		}
+	case !isCount && value.Type().IsSetType():
+		for _, element := range value.AsValueSlice() {
+			if !element.Type().Equals(cty.String) {
+				return nil, false, nil
+			}
+			keys = append(keys, fmt.Sprintf("[%s]", strconv.Quote(element.AsString())))
+		}
+	default:
+		return nil, false, nil
+	}
+
+	return keys, true, nil
+}
+
+// the instance keys of the block an address refers to, found by following the module path of the address from a
+// directory; the instance keys of the address itself are ignored. ok is false if the count or for_each of the block
+// is not a literal value
+func InstanceKeys(dir string, address string) ([]string, bool, error) {
+	bd, err := New(address)
+	if err != nil {
+		return nil, false, err
+	}
+	moduleDir, err := ResolveModuleDirectory(dir, bd.ModulePath())
+	if err != nil {
+		return nil, false, err
+	}
+	files, err := filestats.GetAllTerraformFilesInDirectory(moduleDir)
+	if err != nil {
+		return nil, false, err
+	}
+
+	parsed := fileSet{}
+	for _, fname := range files {
+		cf, err := parsed.parse(fname)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, block := range cf.blocks {
+			if bd.Matches(*block) {
+				return blockInstanceKeys(block)
+			}
+		}
+	}
+
+	return nil, false, fmt.Errorf("no block was found in any file matching the address %s", address)
+}
@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInstanceKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     []string
+		wantOk   bool
+	}{
+		{
+			name:     "has a single instance without count or for_each",
+			contents: "resource \"aws_iam_role\" \"this\" {\n}\n",
+			want:     []string{""},
+			wantOk:   true,
+		},
+		{
+			name:     "counts instances",
+			contents: "resource \"aws_iam_role\" \"this\" {\n  count = 2\n}\n",
+			want:     []string{"[0]", "[1]"},
+			wantOk:   true,
+		},
+		{
+			name:     "keys instances by a set",
+			contents: "resource \"aws_iam_role\" \"this\" {\n  for_each = toset([\"blue\", \"green\"])\n}\n",
+			want:     []string{"[\"blue\"]", "[\"green\"]"},
+			wantOk:   true,
+		},
+		{
+			name:     "keys instances by a map",
+			contents: "resource \"aws_iam_role\" \"this\" {\n  for_each = { green = 1, blue = 2 }\n}\n",
+			want:     []string{"[\"blue\"]", "[\"green\"]"},
+			wantOk:   true,
+		},
+		{
+			name:     "cannot evaluate references",
+			contents: "resource \"aws_iam_role\" \"this\" {\n  count = var.roles\n}\n",
+			want:     nil,
+			wantOk:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(tt.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok, err := InstanceKeys(dir, "aws_iam_role.this[0]")
+			if err != nil {
+				t.Fatalf("InstanceKeys() error = %v", err)
+			}
+			if ok != tt.wantOk || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("InstanceKeys() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
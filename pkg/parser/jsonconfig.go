@@ -0,0 +1,423 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// the key terraform treats as a comment in JSON syntax
+const JSON_COMMENT_KEY = "//"
+
+// nested blocks that are always rendered as blocks when converting JSON syntax to native syntax.
+// other objects cannot be told apart from map attributes without provider schemas, so they are
+// rendered as attributes unless they are written as an array of objects
+var jsonNestedBlocks = []string{"lifecycle", "connection", "validation", "precondition", "postcondition", "content"}
+
+// blocks whose bodies are defined by provider schemas, so that an object in them may be a nested block
+// that is rendered as a map attribute
+var jsonSchemaBlocks = []string{"resource", "data", "provider"}
+
+// nested blocks whose first level of keys are labels (ie dynamic "ingress" or provisioner "local-exec")
+var jsonLabeledBlocks = []string{"dynamic", "provisioner"}
+
+// attributes whose strings are references rather than string values
+var jsonReferenceAttributes = []string{"depends_on", "provider", "providers", "ignore_changes", "replace_triggered_by"}
+
+// identifiers that can be written as bare object keys in native syntax
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// a member of a JSON object
+type jsonMember struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// a JSON object that keeps its members in the order they were written
+type jsonObject []*jsonMember
+
+// parses a JSON object, keeping the order of its members; false if the value is not an object
+func parseJsonObject(raw []byte) (jsonObject, bool, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, false, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, false, nil
+	}
+
+	ret := jsonObject{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, false, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, false, fmt.Errorf("unexpected object key %v", tok)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, false, err
+		}
+		ret = append(ret, &jsonMember{Key: key, Value: value})
+	}
+
+	return ret, true, nil
+}
+
+// parses a JSON array; false if the value is not an array
+func parseJsonArray(raw []byte) ([]json.RawMessage, bool) {
+	var ret []json.RawMessage
+	if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		return nil, false
+	}
+	if err := json.Unmarshal(raw, &ret); err != nil {
+		return nil, false
+	}
+	return ret, true
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, err := json.Marshal(m.Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(m.Value)
+	}
+	buf.WriteString("}")
+
+	return buf.Bytes(), nil
+}
+
+// removes the value at a path of object keys. Arrays of objects (as terraform allows for repeated
+// blocks) are searched element by element. Objects and arrays left empty by the removal are removed too.
+// returns the new value, the removed value (nil if nothing was found) and whether the new value is empty
+func removeJsonPath(raw json.RawMessage, keys []string) (json.RawMessage, json.RawMessage, bool, error) {
+	if elements, ok := parseJsonArray(raw); ok {
+		kept := []json.RawMessage{}
+		var removed json.RawMessage
+		for _, element := range elements {
+			if removed == nil {
+				next, r, empty, err := removeJsonPath(element, keys)
+				if err != nil {
+					return nil, nil, false, err
+				}
+				if removed = r; empty {
+					continue
+				}
+				element = next
+			}
+			kept = append(kept, element)
+		}
+		ret, err := json.Marshal(kept)
+		return ret, removed, len(kept) == 0, err
+	}
+
+	obj, ok, err := parseJsonObject(raw)
+	if err != nil || !ok {
+		return raw, nil, false, err
+	}
+	var removed json.RawMessage
+	for i, m := range obj {
+		if m.Key != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			removed = m.Value
+			obj = slices.Delete(obj, i, i+1)
+			break
+		}
+		next, r, empty, err := removeJsonPath(m.Value, keys[1:])
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if r == nil {
+			continue
+		}
+		removed = r
+		if empty {
+			obj = slices.Delete(obj, i, i+1)
+		} else {
+			m.Value = next
+		}
+		break
+	}
+
+	ret, err := json.Marshal(obj)
+	return ret, removed, len(obj) == 0, err
+}
+
+// the path of object keys that leads to a block (or local value) in a JSON syntax file
+func jsonPath(block *hcl.Block, bd BlockDescription) []string {
+	if ad, ok := bd.(AttributeDescription); ok {
+		return []string{block.Type, ad.AttributeName()}
+	}
+	return slices.Concat([]string{block.Type}, block.Labels)
+}
+
+// removes a block from the contents of a JSON syntax file, returning the new contents and the removed block body
+func removeJsonBlock(contents []byte, path []string) ([]byte, json.RawMessage, error) {
+	next, removed, empty, err := removeJsonPath(contents, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if removed == nil {
+		return nil, nil, fmt.Errorf("no value found at %s", strings.Join(path, "."))
+	}
+	if empty {
+		next = []byte("{}")
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, next, "", "  "); err != nil {
+		return nil, nil, err
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes(), removed, nil
+}
+
+// escapes a string for a quoted native syntax template; template sequences are kept as they are,
+// since JSON strings are templates in terraform as well
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteString(`"`)
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				sb.WriteString(fmt.Sprintf(`\u%04x`, r))
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteString(`"`)
+	return sb.String()
+}
+
+// renders a JSON string as a native syntax expression. a string that is a single interpolation
+// (ie "${var.name}") is unwrapped to the expression itself
+func renderJsonString(s string, reference bool) string {
+	expr, diags := hclsyntax.ParseTemplate([]byte(s), "", hcl.InitialPos)
+	if wrap, ok := expr.(*hclsyntax.TemplateWrapExpr); ok && !diags.HasErrors() {
+		r := wrap.Wrapped.Range()
+		return s[r.Start.Byte:r.End.Byte]
+	}
+	if reference {
+		return s
+	}
+	return quoteString(s)
+}
+
+// renders a JSON value as a native syntax expression
+func renderJsonValue(raw json.RawMessage, indent string, reference bool) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if obj, ok, err := parseJsonObject(raw); err != nil {
+		return "", err
+	} else if ok {
+		if len(obj) == 0 {
+			return "{}", nil
+		}
+		var sb strings.Builder
+		sb.WriteString("{\n")
+		for _, m := range obj {
+			key := m.Key
+			if !identifier.MatchString(key) {
+				key = quoteString(key)
+			}
+			value, err := renderJsonValue(m.Value, indent+"  ", reference)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(fmt.Sprintf("%s  %s = %s\n", indent, key, value))
+		}
+		sb.WriteString(indent + "}")
+		return sb.String(), nil
+	}
+
+	if elements, ok := parseJsonArray(raw); ok {
+		values := []string{}
+		for _, element := range elements {
+			value, err := renderJsonValue(element, indent, reference)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, value)
+		}
+		return "[" + strings.Join(values, ", ") + "]", nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil && bytes.HasPrefix(raw, []byte(`"`)) {
+		return renderJsonString(s, reference), nil
+	}
+	// numbers, bools and null are written the same way in both syntaxes
+	return string(raw), nil
+}
+
+// the objects of a value that is written as a block: either a single object or an array of objects
+func jsonBlockBodies(raw json.RawMessage, always bool) ([]jsonObject, bool, error) {
+	if obj, ok, err := parseJsonObject(raw); err != nil {
+		return nil, false, err
+	} else if ok {
+		return []jsonObject{obj}, always, nil
+	}
+
+	elements, ok := parseJsonArray(raw)
+	if !ok || len(elements) == 0 {
+		return nil, false, nil
+	}
+	ret := []jsonObject{}
+	for _, element := range elements {
+		obj, ok, err := parseJsonObject(element)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		ret = append(ret, obj)
+	}
+
+	return ret, true, nil
+}
+
+// renders the members of a JSON block body as native syntax, indented by the given prefix.
+// the strings of the given attributes are rendered as references. The path of every object rendered
+// as a map attribute is added to maps, prefixed by the path of the body, unless maps is nil
+func renderJsonBody(sb *strings.Builder, body jsonObject, indent string, references []string, maps *[]string, path string) error {
+	for _, m := range body {
+		if m.Key == JSON_COMMENT_KEY {
+			var comment string
+			if err := json.Unmarshal(m.Value, &comment); err == nil {
+				for _, line := range strings.Split(comment, "\n") {
+					sb.WriteString(fmt.Sprintf("%s# %s\n", indent, line))
+				}
+				continue
+			}
+		}
+
+		bodies, isBlock, err := jsonBlockBodies(m.Value, slices.Contains(jsonNestedBlocks, m.Key) || slices.Contains(jsonLabeledBlocks, m.Key))
+		if err != nil {
+			return err
+		}
+		if !isBlock {
+			value, err := renderJsonValue(m.Value, indent, slices.Contains(references, m.Key))
+			if err != nil {
+				return err
+			}
+			if _, isObject, _ := parseJsonObject(m.Value); isObject && maps != nil {
+				*maps = append(*maps, path+m.Key)
+			}
+			sb.WriteString(fmt.Sprintf("%s%s = %s\n", indent, m.Key, value))
+			continue
+		}
+
+		for _, nested := range bodies {
+			if !slices.Contains(jsonLabeledBlocks, m.Key) {
+				sb.WriteString(fmt.Sprintf("%s%s {\n", indent, m.Key))
+				if err := renderJsonBody(sb, nested, indent+"  ", jsonReferenceAttributes, maps, path+m.Key+"."); err != nil {
+					return err
+				}
+				sb.WriteString(indent + "}\n")
+				continue
+			}
+			for _, labeled := range nested {
+				labeledBodies, _, err := jsonBlockBodies(labeled.Value, true)
+				if err != nil {
+					return err
+				}
+				for _, lb := range labeledBodies {
+					sb.WriteString(fmt.Sprintf("%s%s %s {\n", indent, m.Key, quoteString(labeled.Key)))
+					if err := renderJsonBody(sb, lb, indent+"  ", jsonReferenceAttributes, maps, path+m.Key+"."+labeled.Key+"."); err != nil {
+						return err
+					}
+					sb.WriteString(indent + "}\n")
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// renders a block taken from a JSON syntax file as a native syntax block, along with the paths of the objects
+// in it that were rendered as map attributes but may be nested blocks of a provider schema (ie versioning)
+func renderJsonBlock(blockType string, labels []string, raw json.RawMessage) ([]byte, []string, error) {
+	bodies, _, err := jsonBlockBodies(raw, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(bodies) != 1 {
+		return nil, nil, errors.New("blocks defined more than once cannot be converted to native syntax")
+	}
+
+	var sb strings.Builder
+	sb.WriteString(blockType)
+	for _, label := range labels {
+		sb.WriteString(" " + quoteString(label))
+	}
+	sb.WriteString(" {\n")
+	references := jsonReferenceAttributes
+	if blockType == "variable" {
+		// the type of a variable is a type expression (ie list(string)), written as a string in JSON
+		references = append(slices.Clone(references), "type")
+	}
+	var maps *[]string
+	if slices.Contains(jsonSchemaBlocks, blockType) {
+		maps = &[]string{}
+	}
+	if err := renderJsonBody(&sb, bodies[0], "  ", references, maps, ""); err != nil {
+		return nil, nil, err
+	}
+	sb.WriteString("}")
+
+	if maps == nil {
+		return []byte(sb.String()), nil, nil
+	}
+	return []byte(sb.String()), *maps, nil
+}
+
+// the warnings for the objects of a block converted from JSON syntax that were rendered as map attributes
+func mapAttributeWarnings(address string, maps []string) []string {
+	var ret []string
+	for _, path := range maps {
+		name := path[strings.LastIndex(path, ".")+1:]
+		ret = append(ret, fmt.Sprintf("%s of %s was converted from JSON syntax as a map attribute (%s = { ... }); rewrite it as a block if its provider expects one", path, address, name))
+	}
+	return ret
+}
+
+// renders a local value taken from a JSON syntax file as a native syntax attribute
+func renderJsonLocal(name string, raw json.RawMessage) ([]byte, error) {
+	value, err := renderJsonValue(raw, "  ", false)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%s = %s", name, value)), nil
+}
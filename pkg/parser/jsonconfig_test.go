@@ -0,0 +1,193 @@
+package parser
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func Test_renderJsonValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		reference bool
+		want      string
+	}{
+		{name: "quotes plain strings", raw: `"a \"b\"\n"`, reference: false, want: `"a \"b\"\n"`},
+		{name: "keeps templates within strings", raw: `"${var.name}-role"`, reference: false, want: `"${var.name}-role"`},
+		{name: "unwraps a single interpolation", raw: `"${var.tags}"`, reference: false, want: `var.tags`},
+		{name: "writes references bare", raw: `["aws_iam_role.this"]`, reference: true, want: `[aws_iam_role.this]`},
+		{name: "keeps numbers, bools and null", raw: `[1.5, true, null]`, reference: false, want: `[1.5, true, null]`},
+		{name: "writes objects in order", raw: `{"b": 1, "a-b": "c", "d e": 2}`, reference: false, want: "{\n  b = 1\n  a-b = \"c\"\n  \"d e\" = 2\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderJsonValue(json.RawMessage(tt.raw), "", tt.reference)
+			if err != nil {
+				t.Fatalf("renderJsonValue() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("renderJsonValue() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_renderJsonBlock(t *testing.T) {
+	tests := []struct {
+		name      string
+		blockType string
+		raw       string
+		wantMaps  []string
+	}{
+		{
+			name:      "reports objects of resources rendered as map attributes",
+			blockType: "resource",
+			raw:       `{"versioning": {"enabled": true}, "lifecycle": {"ignore_changes": ["tags"]}, "dynamic": {"rule": {"content": {"tags": {"a": "b"}}}}}`,
+			wantMaps:  []string{"versioning", "dynamic.rule.content.tags"},
+		},
+		{
+			name:      "does not report objects of blocks without provider schemas",
+			blockType: "module",
+			raw:       `{"source": "./eks", "tags": {"a": "b"}}`,
+			wantMaps:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, maps, err := renderJsonBlock(tt.blockType, []string{"a", "b"}, json.RawMessage(tt.raw))
+			if err != nil {
+				t.Fatalf("renderJsonBlock() error = %v", err)
+			}
+			if !reflect.DeepEqual(maps, tt.wantMaps) {
+				t.Errorf("renderJsonBlock() maps = %v, want %v", maps, tt.wantMaps)
+			}
+		})
+	}
+}
+
+func TestMoveHclBlock_Json(t *testing.T) {
+	input := `{
+  "resource": {
+    "aws_iam_role": {
+      "this": {
+        "//": "generated",
+        "name": "${var.name}-role",
+        "tags": {"Team": "platform"},
+        "depends_on": ["aws_iam_policy.this"],
+        "lifecycle": {"ignore_changes": ["tags"]}
+      }
+    },
+    "aws_iam_policy": {
+      "this": {"name": "policy"}
+    }
+  },
+  "locals": {"region": "us-east-1", "env": "dev"}
+}
+`
+	tests := []struct {
+		name       string
+		address    string
+		toFile     string
+		wantSource string
+		wantDest   string
+	}{
+		{
+			name:    "renders a resource as native syntax",
+			address: "aws_iam_role.this",
+			toFile:  "resources.tuf.tf",
+			wantSource: `{
+  "resource": {
+    "aws_iam_policy": {
+      "this": {
+        "name": "policy"
+      }
+    }
+  },
+  "locals": {
+    "region": "us-east-1",
+    "env": "dev"
+  }
+}
+`,
+			wantDest: `resource "aws_iam_role" "this" {
+  # generated
+  name = "${var.name}-role"
+  tags = {
+    Team = "platform"
+  }
+  depends_on = [aws_iam_policy.this]
+  lifecycle {
+    ignore_changes = [tags]
+  }
+}
+`,
+		},
+		{
+			name:    "renders a local as native syntax",
+			address: "local.env",
+			toFile:  "locals.tuf.tf",
+			wantSource: `{
+  "resource": {
+    "aws_iam_role": {
+      "this": {
+        "//": "generated",
+        "name": "${var.name}-role",
+        "tags": {
+          "Team": "platform"
+        },
+        "depends_on": [
+          "aws_iam_policy.this"
+        ],
+        "lifecycle": {
+          "ignore_changes": [
+            "tags"
+          ]
+        }
+      }
+    },
+    "aws_iam_policy": {
+      "this": {
+        "name": "policy"
+      }
+    }
+  },
+  "locals": {
+    "region": "us-east-1"
+  }
+}
+`,
+			wantDest: "locals {\n  env = \"dev\"\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fromFile := path.Join(t.TempDir(), "main.tf.json")
+			toFile := path.Join(t.TempDir(), tt.toFile)
+			if err := os.WriteFile(fromFile, []byte(input), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := MoveHclBlock(&MoveOptions{Address: tt.address, FromFile: fromFile, ToFile: toFile}); err != nil {
+				t.Fatalf("MoveHclBlock() error = %v", err)
+			}
+
+			gotSource, err := os.ReadFile(fromFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotDest, err := os.ReadFile(toFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(gotSource) != tt.wantSource {
+				t.Errorf("MoveHclBlock() source file =\nSTART%sEOF, want\nSTART%sEOF", string(gotSource), tt.wantSource)
+			}
+			if string(gotDest) != tt.wantDest {
+				t.Errorf("MoveHclBlock() destination file =\nSTART%sEOF, want\nSTART%sEOF", string(gotDest), tt.wantDest)
+			}
+		})
+	}
+}
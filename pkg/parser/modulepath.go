@@ -0,0 +1,302 @@
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	filestats "github.com/msarfaty/tuf/pkg/file"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// the prefix of every module call in an address
+	MODULE_PREFIX = "module"
+	// the attribute of a module block that says where the module lives
+	MODULE_SOURCE_ATTRIBUTE = "source"
+)
+
+// a module call along the path to a block (ie module.eks or module.node["blue"])
+type ModuleCall struct {
+	// the name of the module block
+	Name string
+	// the instance key of the module call, if any
+	Key string
+}
+
+func (mc *ModuleCall) String() string {
+	return fmt.Sprintf("%s.%s%s", MODULE_PREFIX, mc.Name, mc.Key)
+}
+
+// joins a module path back into an address prefix (ie module.eks.module.karpenter)
+func ModulePathString(path []*ModuleCall) string {
+	calls := []string{}
+	for _, mc := range path {
+		calls = append(calls, mc.String())
+	}
+	return strings.Join(calls, ".")
+}
+
+// splits an address on the dots that are not within an instance key
+func splitSegments(address string) []string {
+	segments := []string{}
+	start, depth, quoted := 0, 0, false
+	for i := 0; i < len(address); i++ {
+		switch c := address[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '.' && depth == 0:
+			segments = append(segments, address[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(segments, address[start:])
+}
+
+// splits the module path off an address, returning the module calls and the address of the block
+// within the innermost module. The address of a module call keeps its last call as the block,
+// so module.eks.module.karpenter yields [module.eks] and module.karpenter
+func SplitModulePath(address string) ([]*ModuleCall, string, error) {
+	s := &addressScanner{address: address}
+	path, err := s.modulePath()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return path, address[s.pos:], nil
+}
+
+// splits the instance key of the addressed block off the end of an address, keeping the
+// instance keys of any module calls along the way
+func SplitInstanceKey(address string) (string, string, error) {
+	a, err := ParseAddress(address)
+	if err != nil {
+		return "", "", err
+	}
+	key := a.Key
+	a.Key = ""
+
+	return a.String(), key, nil
+}
+
+// the address of the configuration an address refers to, with the instance keys of the addressed block and of
+// every module call along the way removed. Every instance of a block shares the same configuration
+func ConfigAddress(address string) (string, error) {
+	a, err := ParseAddress(address)
+	if err != nil {
+		return "", err
+	}
+	a.Key = ""
+	path := []*ModuleCall{}
+	for _, mc := range a.ModulePath {
+		path = append(path, &ModuleCall{Name: mc.Name})
+	}
+	if len(path) > 0 {
+		a.ModulePath = path
+	}
+
+	return a.String(), nil
+}
+
+// the local source of a module call in a directory; remote sources cannot be resolved to a directory
+func moduleSource(dir string, name string) (string, error) {
+	files, err := filestats.GetAllTerraformFilesInDirectory(dir)
+	if err != nil {
+		return "", err
+	}
+
+	parsed := fileSet{}
+	for _, fname := range files {
+		cf, err := parsed.parse(fname)
+		if err != nil {
+			return "", err
+		}
+		for _, block := range cf.blocks {
+			if block.Type != MODULE_PREFIX || len(block.Labels) != 1 || block.Labels[0] != name {
+				continue
+			}
+			return localSource(block, fname)
+		}
+	}
+
+	return "", fmt.Errorf("no module %s found in %s", name, dir)
+}
+
+// the module block calling the module with the given name from a directory, as previous moves left it, along with
+// the file it is in
+func (files fileSet) moduleCall(dir string, name string) (*hcl.Block, string, error) {
+	names, err := files.directoryFiles(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, fname := range names {
+		cf, err := files.parse(fname)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, block := range cf.blocks {
+			if block.Type == MODULE_PREFIX && len(block.Labels) == 1 && block.Labels[0] == name {
+				return block, fname, nil
+			}
+		}
+	}
+
+	return nil, "", fmt.Errorf("no module %s found in %s", name, dir)
+}
+
+// the literal source of a module block
+func sourceValue(block *hcl.Block, fname string) (string, error) {
+	content, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: MODULE_SOURCE_ATTRIBUTE}},
+	})
+	if diags.HasErrors() {
+		return "", fmt.Errorf("failed to read module %s in %s: %s", block.Labels[0], fname, diags.Error())
+	}
+	attr, ok := content.Attributes[MODULE_SOURCE_ATTRIBUTE]
+	if !ok {
+		return "", fmt.Errorf("module %s in %s has no source", block.Labels[0], fname)
+	}
+	value, diags := attr.Expr.Value(&hcl.EvalContext{})
+	if diags.HasErrors() || !value.Type().Equals(cty.String) {
+		return "", fmt.Errorf("module %s in %s does not have a literal source", block.Labels[0], fname)
+	}
+
+	return value.AsString(), nil
+}
+
+// whether a module source is a path relative to the module that calls it
+func isLocalSource(source string) bool {
+	return strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../")
+}
+
+// the local source of a module block, failing if the source is not a local path
+func localSource(block *hcl.Block, fname string) (string, error) {
+	source, err := sourceValue(block, fname)
+	if err != nil {
+		return "", err
+	}
+	if !isLocalSource(source) {
+		return "", fmt.Errorf("module %s in %s has non-local source %s; only local modules can be resolved to a directory", block.Labels[0], fname, source)
+	}
+	return source, nil
+}
+
+// the source a module block moved from one file to another must have to call the same local module, along with the
+// directory of that module. The source is empty if it does not change, and both are empty if the block is not a
+// module block or its source is not a local path
+func rebasedSource(block *hcl.Block, fname string, dest string) (string, string, error) {
+	if block.Type != MODULE_PREFIX || len(block.Labels) != 1 {
+		return "", "", nil
+	}
+	source, err := sourceValue(block, fname)
+	if err != nil {
+		return "", "", err
+	}
+	if !isLocalSource(source) {
+		return "", "", nil
+	}
+
+	dir, err := filepath.Abs(filepath.Join(filepath.Dir(fname), source))
+	if err != nil {
+		return "", "", err
+	}
+	destDir, err := filepath.Abs(filepath.Dir(dest))
+	if err != nil {
+		return "", "", err
+	}
+	rel, err := filepath.Rel(destDir, dir)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot call local module %s of module %s from %s: %w", source, block.Labels[0], destDir, err)
+	}
+	rel = filepath.ToSlash(rel)
+	if !isLocalSource(rel) {
+		rel = "./" + rel
+	}
+	if rel == source {
+		return "", dir, nil
+	}
+
+	return rel, dir, nil
+}
+
+// sets the source of the module block in some native syntax text, leaving the rest of it as it was
+func setModuleSource(text []byte, source string) ([]byte, error) {
+	f, diags := hclwrite.ParseConfig(text, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse %q: %s", text, diags.Error())
+	}
+	for _, block := range f.Body().Blocks() {
+		if block.Type() == MODULE_PREFIX {
+			block.Body().SetAttributeValue(MODULE_SOURCE_ATTRIBUTE, cty.StringVal(source))
+			return f.BuildTokens(nil).Bytes(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("no module block found in %q", text)
+}
+
+// resolves the directory of the innermost module of a module path by following the local
+// source of each module call, starting from the given directory
+func ResolveModuleDirectory(dir string, path []*ModuleCall) (string, error) {
+	for _, mc := range path {
+		source, err := moduleSource(dir, mc.Name)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve %s: %w", mc, err)
+		}
+		dir = filepath.Join(dir, source)
+	}
+
+	return dir, nil
+}
+
+// finds every local module directory reachable from the module calls in a directory, recursively.
+// module calls with remote sources and files that cannot be parsed are skipped.
+func LocalModuleDirectories(dir string) ([]string, error) {
+	seen := map[string]bool{filepath.Clean(dir): true}
+	ret := []string{}
+	queue := []string{filepath.Clean(dir)}
+	parsed := fileSet{}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		files, err := filestats.GetAllTerraformFilesInDirectory(current)
+		if err != nil {
+			return nil, err
+		}
+		for _, fname := range files {
+			cf, err := parsed.parse(fname)
+			if err != nil {
+				logger.Debugf("skipping unparseable file %s while finding local modules: %s", fname, err)
+				continue
+			}
+			for _, block := range cf.blocks {
+				if block.Type != MODULE_PREFIX || len(block.Labels) != 1 {
+					continue
+				}
+				source, err := localSource(block, fname)
+				if err != nil {
+					continue
+				}
+				moduleDir := filepath.Join(current, source)
+				if !seen[moduleDir] {
+					seen[moduleDir] = true
+					ret = append(ret, moduleDir)
+					queue = append(queue, moduleDir)
+				}
+			}
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// the upstream eks module, which calls its node group modules by local source
+var eksDir = filepath.Join("..", "..", "testdata", "eks")
+
+func TestSplitModulePath(t *testing.T) {
+	type args struct {
+		address string
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantPath []*ModuleCall
+		wantRest string
+		wantErr  bool
+	}{
+		{
+			name:     "leaves root module addresses alone",
+			args:     args{address: "aws_iam_role.this[0]"},
+			wantPath: nil,
+			wantRest: "aws_iam_role.this[0]",
+			wantErr:  false,
+		},
+		{
+			name:     "splits nested module calls off a resource",
+			args:     args{address: "module.eks.module.node[\"a.b\"].aws_iam_role.this"},
+			wantPath: []*ModuleCall{{Name: "eks"}, {Name: "node", Key: "[\"a.b\"]"}},
+			wantRest: "aws_iam_role.this",
+			wantErr:  false,
+		},
+		{
+			name:     "keeps the last module call of a module address",
+			args:     args{address: "module.eks.module.karpenter"},
+			wantPath: []*ModuleCall{{Name: "eks"}},
+			wantRest: "module.karpenter",
+			wantErr:  false,
+		},
+		{
+			name:     "fails with a malformed module instance key",
+			args:     args{address: "module.eks[blue].aws_iam_role.this"},
+			wantPath: nil,
+			wantRest: "",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPath, gotRest, err := SplitModulePath(tt.args.address)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SplitModulePath() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotPath, tt.wantPath) {
+				t.Errorf("SplitModulePath() path = %v, want %v", gotPath, tt.wantPath)
+			}
+			if gotRest != tt.wantRest {
+				t.Errorf("SplitModulePath() rest = %v, want %v", gotRest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestConfigAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    string
+		wantErr bool
+	}{
+		{name: "leaves addresses without keys alone", address: "module.eks.aws_iam_role.this", want: "module.eks.aws_iam_role.this", wantErr: false},
+		{name: "removes the key of a resource", address: "aws_iam_role.this[0]", want: "aws_iam_role.this", wantErr: false},
+		{name: "removes the keys of module calls", address: "module.node[\"a.b\"].module.pool[1]", want: "module.node.module.pool", wantErr: false},
+		{name: "fails with an invalid address", address: "aws_iam_role.this[", want: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConfigAddress(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ConfigAddress() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ConfigAddress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveModuleDirectory(t *testing.T) {
+	type args struct {
+		path []*ModuleCall
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "resolves the root module",
+			args:    args{path: nil},
+			want:    eksDir,
+			wantErr: false,
+		},
+		{
+			name:    "resolves nested local modules",
+			args:    args{path: []*ModuleCall{{Name: "eks_managed_node_group", Key: "[\"blue\"]"}, {Name: "user_data"}}},
+			want:    filepath.Join(eksDir, "modules", "_user_data"),
+			wantErr: false,
+		},
+		{
+			name:    "fails on a module with a remote source",
+			args:    args{path: []*ModuleCall{{Name: "kms"}}},
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name:    "fails on a module that does not exist",
+			args:    args{path: []*ModuleCall{{Name: "missing"}}},
+			want:    "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveModuleDirectory(eksDir, tt.args.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveModuleDirectory() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ResolveModuleDirectory() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalModuleDirectories(t *testing.T) {
+	got, err := LocalModuleDirectories(eksDir)
+	if err != nil {
+		t.Fatalf("LocalModuleDirectories() error = %v", err)
+	}
+	sort.Strings(got)
+
+	want := []string{}
+	for _, module := range []string{"_user_data", "eks-managed-node-group", "fargate-profile", "self-managed-node-group"} {
+		want = append(want, filepath.Join(eksDir, "modules", module))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LocalModuleDirectories() = %v, want %v", got, want)
+	}
+}
@@ -3,41 +3,106 @@ package parser
 import (
 	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/hashicorp/hcl/v2"
-	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/msarfaty/tuf/internal/logging"
 	filestats "github.com/msarfaty/tuf/pkg/file"
 	"go.uber.org/zap"
 )
 
-// the character that preceeds the moved block if file is not empty
+var logger *zap.SugaredLogger
+
+// a range of bytes within a file, [Start, End)
+type FileRange struct {
+	Filename string
+	Start    int
+	End      int
+}
+
+// the contents of a file before and after a move
+type FileEdit struct {
+	Filename string
+	// the contents before the move; nil if the file did not exist
+	Before []byte
+	// the contents after the move
+	After []byte
+}
+
+// describes where a moved HCL block came from and where it ended up
+type MoveResult struct {
+	// the address of the moved block, including its module path
+	Address string
+	// the range the block occupied in the source file before it was removed
+	From FileRange
+	// the range the block occupies in the destination file
+	To FileRange
+	// every file changed by the move, in the order they are written; a copy only changes the destination
+	Edits []*FileEdit
+	// whether the block was copied, leaving the source intact
+	Copy bool
+	// set when the result copies a provider configuration the moved blocks need into the destination
+	Provider *ProviderRef
+	// set when the result merges a required_providers entry the moved blocks need into the destination
+	RequiredProvider string
+	// things that did not stop the move but should be checked, ie providers configured differently in each module
+	Warnings []string
+	// the absolute directory of the local module a moved module block calls, whose source is rewritten to call it
+	// from the destination
+	ModuleDirectory string
+
+	// the objects of a block taken from a JSON syntax file that were rendered as map attributes
+	maps []string
+}
+
+// whether the result copies something the moved blocks depend on, rather than moving a block itself
+func (r *MoveResult) IsDependency() bool {
+	return r.Provider != nil || r.RequiredProvider != ""
+}
+
 const (
-	BUFFER_CHAR     = "\n"
-	BUFFER_CHAR_MAX = 2
+	// name destination files by the kind of block moved (ie resources.tuf.tf or module_<name>.tuf.tf)
+	NAMING_DESCRIPTION = "description"
+	// name destination files after the file each block is moved from
+	NAMING_SOURCE = "source"
+	// name destination files after the type of each resource or data source (ie aws_iam_role.tuf.tf);
+	// other blocks are named by their description
+	NAMING_TYPE = "type"
 )
 
-var logger *zap.SugaredLogger
-
 type MoveOptions struct {
 	// the address to move
 	Address string
 	// the BlockDescription of the block to move
 	BlockDescription *BlockDescription
-	// directory to move from
+	// directory to move from; blocks in child modules are found by following the module path of the address from here
 	FromDirectory string
 	// file to move from
 	FromFile string
-	// directory to move to
+	// directory to move to; the file each block is moved to is chosen by Naming, or is FileName if set
 	ToDirectory string
+	// how the files blocks are moved to within ToDirectory are named; defaults to NAMING_DESCRIPTION
+	Naming string
+	// a single file within ToDirectory that every block is moved to
+	FileName string
 	// file to move to
 	ToFile string
+	// compute the move without writing anything to disk
+	DryRun bool
+	// copy the block to the destination, leaving the source intact
+	Copy bool
+	// copy aliased provider configurations the moved blocks use into the destination if they are missing there
+	CopyProviders bool
 
 	// the terraform files to where the source block may live
 	sourceWorkspaceFiles []string
+	// set when the address is a selector pattern rather than the address of a single block
+	selector *Selector
 }
 
 // validate MoveOptions and set defaults
@@ -56,6 +121,22 @@ func (mo *MoveOptions) validate() error {
 	if mo.ToDirectory != "" && mo.ToFile != "" {
 		return fmt.Errorf("cannot choose both a file and directory to move to")
 	}
+	if mo.ToDirectory == "" && (mo.Naming != "" || mo.FileName != "") {
+		return fmt.Errorf("file naming can only be chosen when moving to a directory")
+	}
+	if mo.Naming != "" && mo.FileName != "" {
+		return fmt.Errorf("cannot choose both a file naming strategy and a file name")
+	}
+	switch mo.Naming {
+	case "":
+		mo.Naming = NAMING_DESCRIPTION
+	case NAMING_DESCRIPTION, NAMING_SOURCE, NAMING_TYPE:
+	default:
+		return fmt.Errorf("unknown file naming %s (expected %s, %s or %s)", mo.Naming, NAMING_DESCRIPTION, NAMING_SOURCE, NAMING_TYPE)
+	}
+	if mo.FileName != "" && (filepath.Base(mo.FileName) != mo.FileName || filepath.Ext(mo.FileName) != filestats.EXT_TERRAFORM) {
+		return fmt.Errorf("file name %s must be the name of a %s file, without a directory", mo.FileName, filestats.EXT_TERRAFORM)
+	}
 
 	if mo.Address == "" && mo.BlockDescription == nil {
 		return fmt.Errorf("must include a blockdescription or resource address to filter for")
@@ -64,135 +145,479 @@ func (mo *MoveOptions) validate() error {
 		return fmt.Errorf("cannot supply both a blockdescription and address for moving")
 	}
 
-	if mo.BlockDescription == nil {
+	var modulePath []*ModuleCall
+	switch {
+	case mo.BlockDescription != nil:
+		modulePath = (*mo.BlockDescription).ModulePath()
+	case IsSelector(mo.Address):
+		selector, err := NewSelector(mo.Address)
+		if err != nil {
+			return err
+		}
+		mo.selector = selector
+		modulePath = selector.ModulePath()
+	default:
 		bd, err := New(mo.Address)
 		if err != nil {
 			return err
 		}
 		mo.BlockDescription = &bd
+		modulePath = bd.ModulePath()
 	}
 
 	mo.sourceWorkspaceFiles = []string{}
 	if mo.FromFile != "" {
 		mo.sourceWorkspaceFiles = append(mo.sourceWorkspaceFiles, mo.FromFile)
 	} else {
-		dNodes, err := os.ReadDir(mo.FromDirectory)
+		dir, err := ResolveModuleDirectory(mo.FromDirectory, modulePath)
 		if err != nil {
-			return fmt.Errorf("failed to open source workspace directory %s: %w", mo.FromDirectory, err)
+			return err
 		}
-		for _, dNode := range dNodes {
-			if dNode.Type().IsRegular() {
-				mo.sourceWorkspaceFiles = append(mo.sourceWorkspaceFiles, dNode.Name())
-			}
+		files, err := filestats.GetAllTerraformFilesInDirectory(dir)
+		if err != nil {
+			return fmt.Errorf("failed to open source workspace directory %s: %w", dir, err)
 		}
+		mo.sourceWorkspaceFiles = append(mo.sourceWorkspaceFiles, files...)
 	}
 
 	return nil
 }
 
-// delete the HCL selection from the source file
-func deleteRange(blockrange *hcl.Range) error {
-	contents, err := os.ReadFile(blockrange.Filename)
-	if err != nil {
-		return fmt.Errorf("failed to open file %s for cleaning up old HCL block: %w", blockrange.Filename, err)
+// the file a block found in the given source file is moved to; blocks moved to a directory go to
+// the file named by the naming strategy
+func (mo *MoveOptions) destination(bd BlockDescription, source string) string {
+	if mo.ToFile != "" {
+		return mo.ToFile
+	}
+	if mo.FileName != "" {
+		return filepath.Join(mo.ToDirectory, mo.FileName)
 	}
-	contents = append(contents[:blockrange.Start.Byte], contents[blockrange.End.Byte:]...)
 
-	// we want to prettify the contents that we delete somewhat
-	// after we delete, we want to remove newlines so that we only preserve 2
-	contents = filestats.DeleteOverNOccurrences(contents, []byte(BUFFER_CHAR), blockrange.Start.Byte, 2)
+	name := bd.DestinationFileName()
+	switch mo.Naming {
+	case NAMING_SOURCE:
+		// blocks from JSON syntax files are written as native syntax
+		name = filepath.Base(source)
+		if filestats.IsTerraformJsonFile(name) {
+			name = strings.TrimSuffix(name, filestats.EXT_TERRAFORM_JSON) + filestats.EXT_TERRAFORM
+		}
+	case NAMING_TYPE:
+		switch d := bd.(type) {
+		case *ResourceBlockDescription:
+			name = d.rType + ".tuf.tf"
+		case *DataBlockDescription:
+			name = fmt.Sprintf("data_%s.tuf.tf", d.dType)
+		}
+	}
+	return filepath.Join(mo.ToDirectory, name)
+}
 
-	// lastly, we want to trim the file to only have one trailing newline if we have to
-	contents = filestats.DeleteOverNOccurrences(contents, []byte(BUFFER_CHAR), len(contents)-1, 1)
+// the contents of files as a pass of moves has left them, read from disk on first use.
+// files are keyed by their cleaned path and a nil entry means the file does not exist
+type fileSet map[string][]byte
 
-	// finally, we write the removed + prettified contents
-	err = os.WriteFile(blockrange.Filename, contents, 0644)
+// reads a file as previous moves left it; a nil slice means the file does not exist
+func (files fileSet) read(name string) ([]byte, error) {
+	if contents, ok := files[filepath.Clean(name)]; ok {
+		return contents, nil
+	}
+	contents, err := readOptionalFile(name)
 	if err != nil {
-		return fmt.Errorf("failed to write prettified from-file %s: %w", blockrange.Filename, err)
+		return nil, err
 	}
+	files[filepath.Clean(name)] = contents
 
-	return nil
+	return contents, nil
 }
 
-// prettify the copied HCL block selection
-// for example, adding newlines where needed if not present
-func prettifyCopySelection(copyBytes []byte, dest string) ([]byte, error) {
-	mt, err := filestats.FileIsEmpty(dest)
+// parses a file as previous moves left it
+func (files fileSet) parse(name string) (*configFile, error) {
+	contents, err := files.read(name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to stat file (%s): %w", dest, err)
+		return nil, fmt.Errorf("failed to read file %s: %w", name, err)
 	}
-	endsWithBufferChar, err := filestats.FileEndsWith(dest, BUFFER_CHAR)
+	if contents == nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", name, fs.ErrNotExist)
+	}
+
+	return parseConfig(name, contents)
+}
+
+// reads a native syntax file as previous moves left it, for editing; a file that does not exist yet is empty
+func (files fileSet) native(name string) ([]byte, *nativeFile, error) {
+	contents, err := files.read(name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check contents of file (%s): %w", dest, err)
+		return nil, nil, err
 	}
-	if !mt && !endsWithBufferChar {
-		copyBytes = append([]byte(BUFFER_CHAR), copyBytes...)
+	f, err := parseNativeFile(name, contents)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return append(copyBytes, []byte(BUFFER_CHAR)...), nil
+	return contents, f, nil
+}
+
+// applies the edits of a move so that later moves see the files as it left them
+func (files fileSet) apply(edits []*FileEdit) {
+	for _, edit := range edits {
+		files[filepath.Clean(edit.Filename)] = edit.After
+	}
 }
 
-// copy an HCL range to a new file
-func copyRange(blockRange *hcl.Range, dest string) error {
-	// read source file from range
-	content, err := os.ReadFile(blockRange.Filename)
+// reads a file that may not exist yet; a nil slice means the file does not exist
+func readOptionalFile(name string) ([]byte, error) {
+	contents, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to open source file %s: %w", blockRange.Filename, err)
+		return nil, err
+	}
+	if contents == nil {
+		contents = []byte{}
+	}
+
+	return contents, nil
+}
+
+// stages every edit in a transaction; a file edited more than once is written as its last edit left it.
+// Planners list the destination of a move before its source, so a failure never loses the block
+func StageEdits(tx *filestats.Transaction, edits []*FileEdit) {
+	for _, edit := range edits {
+		tx.Write(edit.Filename, edit.After)
+	}
+}
+
+// writes every edit to disk at once, so that either all of them are written or none are
+func WriteEdits(edits []*FileEdit) error {
+	tx := filestats.NewTransaction("")
+	StageEdits(tx, edits)
+	if err := tx.Commit(nil); err != nil {
+		return fmt.Errorf("failed to write edits: %w", err)
+	}
+
+	return nil
+}
+
+// the attributes a moved block is given so that it means the same thing in the destination
+type blockRewrite struct {
+	// the source that calls the local module of a module block from the destination; empty if it does not change
+	source string
+	// the provider configuration a block must select to keep using the one passed to the module it is moved out of
+	provider *ProviderRef
+}
+
+// sets the attributes of the rewrite in the native syntax text of a block
+func (r blockRewrite) apply(text []byte) ([]byte, error) {
+	var err error
+	if r.source != "" {
+		if text, err = setModuleSource(text, r.source); err != nil {
+			return nil, err
+		}
+	}
+	if r.provider != nil {
+		if text, err = setBlockProvider(text, *r.provider); err != nil {
+			return nil, err
+		}
+	}
+	return text, nil
+}
+
+// computes the edits needed to move the block at the given index of its source file to the destination
+// file, or only to copy it there if copy is set. Comments attached to the block move with it, and the block
+// is given the attributes of the rewrite
+func planMove(files fileSet, block *hclsyntax.Block, index int, dest string, rewrite blockRewrite, copy bool) (*MoveResult, error) {
+	fname := block.Range().Filename
+	if filepath.Clean(fname) == filepath.Clean(dest) {
+		return nil, fmt.Errorf("block already lives in destination file %s", dest)
+	}
+	if filestats.IsTerraformJsonFile(dest) {
+		return nil, fmt.Errorf("cannot move into JSON syntax file %s; only native syntax files can be written", dest)
 	}
-	copyBytes := content[blockRange.Start.Byte:blockRange.End.Byte]
 
-	// open destination
-	file, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY, 0644)
+	contents, src, err := files.native(fname)
 	if err != nil {
-		return fmt.Errorf("failed to open destination file %s: %w", dest, err)
+		return nil, fmt.Errorf("failed to open source file %s: %w", fname, err)
+	}
+	destContents, dst, err := files.native(dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open destination file %s: %w", dest, err)
 	}
-	defer file.Close()
 
-	copyBytes, err = prettifyCopySelection(copyBytes, dest)
+	text, from, err := src.removeBlock(index)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if text, err = rewrite.apply(text); err != nil {
+		return nil, err
 	}
-	_, err = io.Writer.Write(file, copyBytes)
+	to, err := dst.appendBlock(text)
 	if err != nil {
-		return fmt.Errorf("failed to write hcl block to dest file: %w", err)
+		return nil, err
+	}
+	result := &MoveResult{
+		From: from,
+		To:   to,
+		Edits: []*FileEdit{
+			{Filename: dest, Before: destContents, After: dst.bytes()},
+		},
+	}
+	if !copy {
+		result.Edits = append(result.Edits, &FileEdit{Filename: fname, Before: contents, After: src.bytes()})
 	}
 
-	return nil
+	return result, nil
 }
 
-// move an HCL block according to the given options
-func MoveHclBlock(mo *MoveOptions) error {
-	mo.validate()
+// computes the edits needed to move a block (or local value) out of a JSON syntax file into a native
+// syntax destination file, or only to copy it there if copy is set. The block is rendered as native syntax,
+// with the attributes of the rewrite, and the source file is rewritten without it
+func planJsonMove(files fileSet, block *hcl.Block, bd BlockDescription, dest string, rewrite blockRewrite, copy bool) (*MoveResult, error) {
+	fname := block.DefRange.Filename
+	if filestats.IsTerraformJsonFile(dest) {
+		return nil, fmt.Errorf("cannot move into JSON syntax file %s; only native syntax files can be written", dest)
+	}
 
-	p := hclparse.NewParser()
+	source, err := files.read(fname)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source file %s: %w", fname, err)
+	}
+	destContents, dst, err := files.native(dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open destination file %s: %w", dest, err)
+	}
 
+	removed, raw, err := removeJsonBlock(source, jsonPath(block, bd))
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove %s from %s: %w", bd.address(), fname, err)
+	}
+
+	var text []byte
+	var maps []string
+	var to FileRange
+	if ad, ok := bd.(AttributeDescription); ok {
+		if text, err = renderJsonLocal(ad.AttributeName(), raw); err != nil {
+			return nil, err
+		}
+		if to, err = dst.addLocal(ad.AttributeName(), text); err != nil {
+			return nil, err
+		}
+	} else {
+		if text, maps, err = renderJsonBlock(block.Type, block.Labels, raw); err != nil {
+			return nil, fmt.Errorf("failed to render %s as native syntax: %w", bd.address(), err)
+		}
+		if text, err = rewrite.apply(text); err != nil {
+			return nil, err
+		}
+		if to, err = dst.appendBlock(text); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &MoveResult{
+		// JSON blocks are rewritten rather than cut, so the source range is where the block was defined
+		From: FileRange{Filename: fname, Start: block.DefRange.Start.Byte, End: block.DefRange.End.Byte},
+		To:   to,
+		Edits: []*FileEdit{
+			{Filename: dest, Before: destContents, After: dst.bytes()},
+		},
+		maps: maps,
+	}
+	if !copy {
+		result.Edits = append(result.Edits, &FileEdit{Filename: fname, Before: source, After: removed})
+	}
+
+	return result, nil
+}
+
+// computes the edits needed to move a single attribute out of the block at the given index of its source file
+// into the last locals block of the destination file (or a new one), or only to copy it there if copy is set.
+// The source block is always kept, even if the attribute was the last one in it
+func planAttributeMove(files fileSet, attr *hclsyntax.Attribute, index int, dest string, copy bool) (*MoveResult, error) {
+	fname := attr.SrcRange.Filename
+	if filepath.Clean(fname) == filepath.Clean(dest) {
+		return nil, fmt.Errorf("attribute already lives in destination file %s", dest)
+	}
+	if filestats.IsTerraformJsonFile(dest) {
+		return nil, fmt.Errorf("cannot move into JSON syntax file %s; only native syntax files can be written", dest)
+	}
+
+	source, src, err := files.native(fname)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source file %s: %w", fname, err)
+	}
+	destContents, dst, err := files.native(dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open destination file %s: %w", dest, err)
+	}
+
+	text, from, err := src.removeAttribute(index, attr.Name)
+	if err != nil {
+		return nil, err
+	}
+	to, err := dst.addLocal(attr.Name, text)
+	if err != nil {
+		return nil, err
+	}
+	result := &MoveResult{
+		From: from,
+		To:   to,
+		Edits: []*FileEdit{
+			{Filename: dest, Before: destContents, After: dst.bytes()},
+		},
+	}
+	if !copy {
+		result.Edits = append(result.Edits, &FileEdit{Filename: fname, Before: source, After: src.bytes()})
+	}
+
+	return result, nil
+}
+
+// finds the block described in the source files and plans its move against the files as previous moves left them.
+// the move is followed by a copy of each provider configuration it needs that is missing from the destination
+func planDescribedMove(files fileSet, mo *MoveOptions, bd BlockDescription) ([]*MoveResult, error) {
 	for _, fname := range mo.sourceWorkspaceFiles {
-		hclFile, diags := p.ParseHCLFile(fname)
-		if diags.HasErrors() {
-			return fmt.Errorf("failed to move file while parsing file %s: %s", fname, diags.Error())
-		}
-		body, ok := hclFile.Body.(*hclsyntax.Body)
-		if !ok {
-			return fmt.Errorf("error casting hcl in file=(%s) to hclsyntax", fname)
-		}
-		for _, block := range body.Blocks {
-			if (*mo.BlockDescription).Matches(*block.AsHCLBlock()) {
-				blockRange := block.Range()
-				logger.Debugf("found match for address=[%s] in file %s[%d:%d]", (*mo.BlockDescription).address(), fname, blockRange.Start.Line, blockRange.Start.Column)
-				err := copyRange(&blockRange, mo.ToFile)
-				if err != nil {
-					return fmt.Errorf("failed to copy range (%s[%d:%d]) to (%s): %w", blockRange.Filename, blockRange.Start.Byte, blockRange.End.Byte, mo.ToFile, err)
-				}
-				err = deleteRange(&blockRange)
-				if err != nil {
-					return fmt.Errorf("failed to delete range (%s[%d:%d]): %w", blockRange.Filename, blockRange.Start.Byte, blockRange.End.Byte, err)
+		dest := mo.destination(bd, fname)
+		cf, err := files.parse(fname)
+		if err != nil {
+			return nil, fmt.Errorf("failed to move block while parsing: %w", err)
+		}
+		for i, hclBlock := range cf.blocks {
+			if !bd.Matches(*hclBlock) {
+				continue
+			}
+			blockRange := hclBlock.DefRange
+			logger.Debugf("found match for address=[%s] in file %s[%d:%d]", bd.address(), fname, blockRange.Start.Line, blockRange.Start.Column)
+			// a module block keeps calling the same local module from wherever it is moved to
+			source, moduleDir, err := rebasedSource(hclBlock, fname, dest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to move %s: %w", bd.address(), err)
+			}
+			rewrite := blockRewrite{source: source}
+			// and every block keeps using the provider configurations passed to the module it is moved out of
+			used := []usedProvider{}
+			for _, ref := range providerReferences(hclBlock) {
+				used = append(used, usedProvider{ref: ref, dir: filepath.Dir(fname), modulePath: bd.ModulePath()})
+			}
+			if mo.FromDirectory != "" && len(bd.ModulePath()) > 0 {
+				if used, rewrite.provider, err = passedProviders(files, mo.FromDirectory, bd.ModulePath(), hclBlock, filepath.Dir(dest)); err != nil {
+					return nil, fmt.Errorf("failed to move %s: %w", bd.address(), err)
 				}
-				return nil
 			}
+			var result *MoveResult
+			if cf.isJson {
+				result, err = planJsonMove(files, hclBlock, bd, dest, rewrite, mo.Copy)
+			} else if ad, ok := bd.(AttributeDescription); ok {
+				// only the attribute is moved; the block it lives in may define others
+				result, err = planAttributeMove(files, cf.native[i].Body.Attributes[ad.AttributeName()], i, dest, mo.Copy)
+			} else {
+				blockRange = cf.native[i].Range()
+				result, err = planMove(files, cf.native[i], i, dest, rewrite, mo.Copy)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to move range (%s[%d:%d]) to (%s): %w", blockRange.Filename, blockRange.Start.Byte, blockRange.End.Byte, dest, err)
+			}
+			result.Address = bd.address()
+			result.Copy = mo.Copy
+			result.ModuleDirectory = moduleDir
+			files.apply(result.Edits)
+
+			providers, err := planProviders(files, result, used, mo.CopyProviders)
+			if err != nil {
+				return nil, err
+			}
+			required, err := planRequiredProviders(files, result, bd.ModulePath(), requiredProviderNames(hclBlock))
+			if err != nil {
+				return nil, err
+			}
+			ret := slices.Concat([]*MoveResult{result}, providers, required)
+			for _, r := range ret {
+				r.Warnings = append(r.Warnings, mapAttributeWarnings(r.Address, r.maps)...)
+			}
+			return ret, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no block was found in any file matching the address %s", bd.address())
+}
+
+// move (or copy) an HCL block according to the given options
+func MoveHclBlock(mo *MoveOptions) (*MoveResult, error) {
+	if err := mo.validate(); err != nil {
+		return nil, fmt.Errorf("invalid move options: %w", err)
+	}
+	if mo.selector != nil {
+		return nil, fmt.Errorf("%s selects many blocks; use MoveHclBlocks", mo.Address)
+	}
+
+	results, err := planDescribedMove(fileSet{}, mo, *mo.BlockDescription)
+	if err != nil {
+		return nil, err
+	}
+	// provider configurations and requirements copied for the block are written along with it
+	result := results[0]
+	for _, copied := range results[1:] {
+		result.Edits = append(result.Edits, copied.Edits...)
+	}
+	if !mo.DryRun {
+		if err = WriteEdits(result.Edits); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// move (or copy) every block matched by the address, which may be a selector pattern, in one pass.
+// Each move is planned against the files as the moves before it left them, so the edits of the
+// results can be written one after another. Nothing is written unless every move can be planned, and
+// the edits of every move are written at once.
+func MoveHclBlocks(mo *MoveOptions) ([]*MoveResult, error) {
+	if err := mo.validate(); err != nil {
+		return nil, fmt.Errorf("invalid move options: %w", err)
+	}
+
+	files := fileSet{}
+	descriptions := []BlockDescription{}
+	if mo.selector == nil {
+		descriptions = append(descriptions, *mo.BlockDescription)
+	} else {
+		selected, err := mo.selector.selectFiles(files, mo.sourceWorkspaceFiles)
+		if err != nil {
+			return nil, err
+		}
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("no blocks were found in any file matching the selector %s", mo.Address)
+		}
+		for _, sb := range selected {
+			bd, err := New(sb.Address)
+			if err != nil {
+				return nil, err
+			}
+			descriptions = append(descriptions, bd)
+		}
+	}
+
+	results := []*MoveResult{}
+	for _, bd := range descriptions {
+		planned, err := planDescribedMove(files, mo, bd)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, planned...)
+	}
+
+	if !mo.DryRun {
+		edits := []*FileEdit{}
+		for _, result := range results {
+			edits = append(edits, result.Edits...)
+		}
+		if err := WriteEdits(edits); err != nil {
+			return nil, err
 		}
 	}
 
-	return errors.New("no block was found in any file matching the block description or address")
+	return results, nil
 }
 
 func init() {
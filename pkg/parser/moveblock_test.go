@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -30,6 +31,30 @@ func TestMoveHclBlock(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "moves the whole block of a resource instance",
+			args: args{
+				testDir: path.Join("testdata", "moves", "test1"),
+				mo: &MoveOptions{
+					Address:  "aws_iam_role.eks_auto[0]",
+					FromFile: "original.tf",
+					ToFile:   "moved.tf",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "moves attached leading and trailing comments with the block",
+			args: args{
+				testDir: path.Join("testdata", "moves", "test2"),
+				mo: &MoveOptions{
+					Address:  "aws_iam_role_policy_attachment.cluster_encryption",
+					FromFile: "original.tf",
+					ToFile:   "moved.tf",
+				},
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -51,7 +76,8 @@ func TestMoveHclBlock(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			if err := MoveHclBlock(tt.args.mo); (err != nil) != tt.wantErr {
+			result, err := MoveHclBlock(tt.args.mo)
+			if (err != nil) != tt.wantErr {
 				t.Errorf("MoveHclBlock() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			gotMoved, err := os.ReadFile(tt.args.mo.ToFile)
@@ -63,6 +89,9 @@ func TestMoveHclBlock(t *testing.T) {
 				t.Fatal(fmt.Errorf("test failure: %w", err))
 			}
 
+			if result != nil && !reflect.DeepEqual(gotMoved[result.To.Start:result.To.End], input[result.From.Start:result.From.End]) {
+				t.Errorf("MoveHclBlock() result = %v does not map the moved block between files", result)
+			}
 			if !reflect.DeepEqual(gotMoved, wantMoved) {
 				t.Errorf("MoveHclBlock() moved file =\nSTART%sEOF\nwant\nSTART%sEOF", string(gotMoved), string(wantMoved))
 			}
@@ -72,3 +101,313 @@ func TestMoveHclBlock(t *testing.T) {
 		})
 	}
 }
+
+func TestMoveHclBlock_DryRun(t *testing.T) {
+	testDir := path.Join("testdata", "moves", "test1")
+	input, err := os.ReadFile(path.Join(testDir, "before.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMoved, err := os.ReadFile(path.Join(testDir, "after_moved.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRemoved, err := os.ReadFile(path.Join(testDir, "after_original.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromFile := path.Join(t.TempDir(), "original.tf")
+	toFile := path.Join(t.TempDir(), "moved.tf")
+	if err := os.WriteFile(fromFile, input, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := MoveHclBlock(&MoveOptions{
+		Address:  "aws_iam_role.eks_auto",
+		FromFile: fromFile,
+		ToFile:   toFile,
+		DryRun:   true,
+	})
+	if err != nil {
+		t.Fatalf("MoveHclBlock() error = %v", err)
+	}
+
+	if _, err := os.Stat(toFile); err == nil {
+		t.Errorf("MoveHclBlock() wrote %s during a dry run", toFile)
+	}
+	gotSource, err := os.ReadFile(fromFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotSource, input) {
+		t.Errorf("MoveHclBlock() changed %s during a dry run", fromFile)
+	}
+
+	wantEdits := []*FileEdit{
+		{Filename: toFile, Before: nil, After: wantMoved},
+		{Filename: fromFile, Before: input, After: wantRemoved},
+	}
+	if !reflect.DeepEqual(result.Edits, wantEdits) {
+		t.Errorf("MoveHclBlock() edits do not match the files a move would write")
+	}
+}
+
+func TestMoveHclBlock_Copy(t *testing.T) {
+	input := []byte("data \"aws_caller_identity\" \"current\" {\n}\n\nresource \"aws_iam_role\" \"foo\" {\n}\n")
+	fromFile := path.Join(t.TempDir(), "main.tf")
+	toFile := path.Join(t.TempDir(), "data.tuf.tf")
+	if err := os.WriteFile(fromFile, input, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := MoveHclBlock(&MoveOptions{
+		Address:  "data.aws_caller_identity.current",
+		FromFile: fromFile,
+		ToFile:   toFile,
+		Copy:     true,
+	})
+	if err != nil {
+		t.Fatalf("MoveHclBlock() error = %v", err)
+	}
+
+	gotSource, err := os.ReadFile(fromFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotSource, input) {
+		t.Errorf("MoveHclBlock() changed the source file while copying:\n%s", string(gotSource))
+	}
+	gotCopied, err := os.ReadFile(toFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "data \"aws_caller_identity\" \"current\" {\n}\n"; string(gotCopied) != want {
+		t.Errorf("MoveHclBlock() copied file = %s, want %s", string(gotCopied), want)
+	}
+	if len(result.Edits) != 1 || result.Edits[0].Filename != toFile {
+		t.Errorf("MoveHclBlock() edits = %v, want only the destination", result.Edits)
+	}
+}
+
+func TestMoveHclBlock_ModuleSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		fromFile string
+		input    string
+		want     string
+	}{
+		{
+			name:     "rewrites a local source against the destination",
+			fromFile: "main.tf",
+			input:    "module \"x\" {\n  # the shared module\n  source = \"./modules/x\"\n  count  = 1\n}\n",
+			want:     "module \"x\" {\n  # the shared module\n  source = \"../modules/x\"\n  count  = 1\n}\n",
+		},
+		{
+			name:     "rewrites a local source from a JSON syntax file",
+			fromFile: "main.tf.json",
+			input:    `{"module": {"x": {"source": "./modules/x"}}}`,
+			want:     "module \"x\" {\n  source = \"../modules/x\"\n}\n",
+		},
+		{
+			name:     "keeps a remote source",
+			fromFile: "main.tf",
+			input:    "module \"x\" {\n  source = \"terraform-aws-modules/vpc/aws\"\n}\n",
+			want:     "module \"x\" {\n  source = \"terraform-aws-modules/vpc/aws\"\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fromFile := path.Join(dir, tt.fromFile)
+			toFile := path.Join(dir, "nested", "module_x.tuf.tf")
+			if err := os.WriteFile(fromFile, []byte(tt.input), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Mkdir(path.Join(dir, "nested"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := MoveHclBlock(&MoveOptions{Address: "module.x", FromFile: fromFile, ToFile: toFile})
+			if err != nil {
+				t.Fatalf("MoveHclBlock() error = %v", err)
+			}
+			got, err := os.ReadFile(toFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("MoveHclBlock() moved file = %q, want %q", got, tt.want)
+			}
+			if local := strings.Contains(tt.input, "./modules/x"); local != (result.ModuleDirectory == path.Join(dir, "modules", "x")) {
+				t.Errorf("MoveHclBlock() module directory = %q", result.ModuleDirectory)
+			}
+		})
+	}
+}
+
+func TestMoveHclBlock_Local(t *testing.T) {
+	tests := []struct {
+		name       string
+		dest       string
+		wantSource string
+		wantDest   string
+	}{
+		{
+			name:       "moves a local into a new locals block",
+			dest:       "",
+			wantSource: "locals {\n  name = \"example\"\n}\n",
+			wantDest:   "locals {\n  tags = { Environment = \"dev\" } # shared tags\n}\n",
+		},
+		{
+			name:       "merges a local into an existing locals block",
+			dest:       "locals {\n  region = \"us-east-1\"\n}\n",
+			wantSource: "locals {\n  name = \"example\"\n}\n",
+			wantDest:   "locals {\n  region = \"us-east-1\"\n  tags   = { Environment = \"dev\" } # shared tags\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := []byte("locals {\n  name = \"example\"\n  tags = { Environment = \"dev\" } # shared tags\n}\n")
+			fromFile := path.Join(t.TempDir(), "main.tf")
+			toFile := path.Join(t.TempDir(), "locals.tuf.tf")
+			if err := os.WriteFile(fromFile, input, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.dest != "" {
+				if err := os.WriteFile(toFile, []byte(tt.dest), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := MoveHclBlock(&MoveOptions{
+				Address:  "local.tags",
+				FromFile: fromFile,
+				ToFile:   toFile,
+			})
+			if err != nil {
+				t.Fatalf("MoveHclBlock() error = %v", err)
+			}
+
+			gotSource, err := os.ReadFile(fromFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotDest, err := os.ReadFile(toFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(gotSource) != tt.wantSource {
+				t.Errorf("MoveHclBlock() source file =\nSTART%sEOF, want\nSTART%sEOF", string(gotSource), tt.wantSource)
+			}
+			if string(gotDest) != tt.wantDest {
+				t.Errorf("MoveHclBlock() destination file =\nSTART%sEOF, want\nSTART%sEOF", string(gotDest), tt.wantDest)
+			}
+			// the destination is formatted canonically, which may realign the local with its new neighbours
+			moved, original := strings.Fields(string(gotDest[result.To.Start:result.To.End])), strings.Fields(string(input[result.From.Start:result.From.End]))
+			if !reflect.DeepEqual(moved, original) {
+				t.Errorf("MoveHclBlock() result = %v does not map the moved local between files", result)
+			}
+		})
+	}
+}
+
+func TestMoveOptions_destination(t *testing.T) {
+	tests := []struct {
+		name     string
+		naming   string
+		fileName string
+		address  string
+		source   string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:    "names files by description by default",
+			address: "module.vpc",
+			source:  "main.tf",
+			want:    "b/module_vpc.tuf.tf",
+		},
+		{
+			name:    "mirrors the source file",
+			naming:  NAMING_SOURCE,
+			address: "aws_iam_role.this",
+			source:  "a/iam.tf",
+			want:    "b/iam.tf",
+		},
+		{
+			name:    "mirrors JSON source files as native syntax",
+			naming:  NAMING_SOURCE,
+			address: "aws_iam_role.this",
+			source:  "a/iam.tf.json",
+			want:    "b/iam.tf",
+		},
+		{
+			name:    "groups resources by type",
+			naming:  NAMING_TYPE,
+			address: "aws_iam_role.this[0]",
+			source:  "a/main.tf",
+			want:    "b/aws_iam_role.tuf.tf",
+		},
+		{
+			name:    "groups data sources by type",
+			naming:  NAMING_TYPE,
+			address: "data.aws_caller_identity.current",
+			source:  "a/main.tf",
+			want:    "b/data_aws_caller_identity.tuf.tf",
+		},
+		{
+			name:    "names other blocks by description when grouping by type",
+			naming:  NAMING_TYPE,
+			address: "var.region",
+			source:  "a/main.tf",
+			want:    "b/variables.tuf.tf",
+		},
+		{
+			name:     "moves every block into a fixed file",
+			fileName: "moved.tf",
+			address:  "module.vpc",
+			source:   "a/main.tf",
+			want:     "b/moved.tf",
+		},
+		{
+			name:    "fails with an unknown naming",
+			naming:  "random",
+			address: "module.vpc",
+			wantErr: true,
+		},
+		{
+			name:     "fails with a fixed file outside the destination",
+			fileName: "../moved.tf",
+			address:  "module.vpc",
+			wantErr:  true,
+		},
+		{
+			name:     "fails with both a naming and a fixed file",
+			naming:   NAMING_TYPE,
+			fileName: "moved.tf",
+			address:  "module.vpc",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mo := &MoveOptions{
+				Address:     tt.address,
+				FromFile:    tt.source,
+				ToDirectory: "b",
+				Naming:      tt.naming,
+				FileName:    tt.fileName,
+			}
+			err := mo.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := mo.destination(*mo.BlockDescription, tt.source); got != tt.want {
+				t.Errorf("destination() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
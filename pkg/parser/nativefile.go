@@ -0,0 +1,299 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// a native syntax file held as an hclwrite syntax tree. Blocks and attributes are removed and added as whole
+// items of the tree, along with the comments attached to them, rather than by splicing bytes. Added items, and the
+// blocks they are merged into, are written in canonical format as terraform fmt would write them; the rest of the
+// file is left as it was
+type nativeFile struct {
+	name string
+	file *hclwrite.File
+}
+
+// parses the contents of a native syntax file; nil contents are an empty file
+func parseNativeFile(name string, contents []byte) (*nativeFile, error) {
+	f, diags := hclwrite.ParseConfig(contents, name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse file %s: %s", name, diags.Error())
+	}
+
+	return &nativeFile{name: name, file: f}, nil
+}
+
+// the contents of the file. hclwrite.File.Bytes is not used, since it formats the whole file. An empty file
+// is an empty slice rather than nil, which would mean the file does not exist
+func (f *nativeFile) bytes() []byte {
+	if contents := f.file.BuildTokens(nil).Bytes(); contents != nil {
+		return contents
+	}
+	return []byte{}
+}
+
+// the tokens of the file, without the end of file marker
+func (f *nativeFile) tokens() hclwrite.Tokens {
+	return withoutEOF(f.file.BuildTokens(nil))
+}
+
+// replaces the contents of the file with the given tokens
+func (f *nativeFile) setTokens(tokens hclwrite.Tokens) error {
+	file, diags := hclwrite.ParseConfig(tokens.Bytes(), f.name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("edit left %s invalid: %s", f.name, diags.Error())
+	}
+	f.file = file
+
+	return nil
+}
+
+// rewrites a top level block of the file in canonical format, leaving the rest of the file as it is
+func (f *nativeFile) formatBlock(block *hclwrite.Block) error {
+	tokens := f.tokens()
+	own := withoutEOF(block.BuildTokens(nil))
+	start := indexOfToken(tokens, own[0])
+	if start < 0 {
+		return fmt.Errorf("block is not part of %s", f.name)
+	}
+	end := start + len(own)
+	formatted, err := lexTokens(hclwrite.Format(own.Bytes()))
+	if err != nil {
+		return err
+	}
+
+	return f.setTokens(slices.Concat(tokens[:start], formatted, tokens[end:]))
+}
+
+// the top level block at the given index, which is the same as its index among the blocks of the parsed file
+func (f *nativeFile) block(i int) (*hclwrite.Block, error) {
+	blocks := f.file.Body().Blocks()
+	if i < 0 || i >= len(blocks) {
+		return nil, fmt.Errorf("file %s has no block %d", f.name, i)
+	}
+	return blocks[i], nil
+}
+
+// the last top level block of the given type without labels, or nil if there is none
+func (f *nativeFile) lastBlock(blockType string) *hclwrite.Block {
+	var ret *hclwrite.Block
+	for _, block := range f.file.Body().Blocks() {
+		if block.Type() == blockType && len(block.Labels()) == 0 {
+			ret = block
+		}
+	}
+	return ret
+}
+
+// the byte range of tokens[start:end] within the file. The range starts after the indentation of the first
+// token and ends before the newline that ends the last line, which belongs to the file
+func (f *nativeFile) byteRange(tokens hclwrite.Tokens, start int, end int) FileRange {
+	for end > start && tokens[end-1].Type == hclsyntax.TokenNewline {
+		end--
+	}
+	offset := 0
+	for _, tok := range tokens[:start] {
+		offset += tok.SpacesBefore + len(tok.Bytes)
+	}
+	ret := FileRange{Filename: f.name, Start: offset, End: offset}
+	for i, tok := range tokens[start:end] {
+		if i == 0 {
+			ret.Start += tok.SpacesBefore
+		}
+		ret.End += tok.SpacesBefore + len(tok.Bytes)
+	}
+	if end > start && bytes.HasSuffix(tokens[end-1].Bytes, []byte("\n")) {
+		ret.End--
+	}
+
+	return ret
+}
+
+// the range of an item (a block or attribute) within the file, given the tokens it was built from
+func (f *nativeFile) itemRange(item hclwrite.Tokens) (FileRange, error) {
+	tokens := f.tokens()
+	start := indexOfToken(tokens, item[0])
+	if start < 0 {
+		return FileRange{}, fmt.Errorf("item is not part of %s", f.name)
+	}
+	return f.byteRange(tokens, start, start+len(withoutEOF(item))), nil
+}
+
+// removes a top level block, along with the comments attached to it, returning its text in canonical format
+// and the range it occupied in the file
+func (f *nativeFile) removeBlock(i int) ([]byte, FileRange, error) {
+	block, err := f.block(i)
+	if err != nil {
+		return nil, FileRange{}, err
+	}
+	tokens := f.tokens()
+	start, end := attachedTokens(tokens, block)
+	from := f.byteRange(tokens, start, end)
+	text := canonicalText(tokens[start:end])
+
+	remaining := tidyNewlines(slices.Concat(tokens[:start], tokens[end:]), start)
+	if err = f.setTokens(remaining); err != nil {
+		return nil, FileRange{}, err
+	}
+	return text, from, nil
+}
+
+// removes an attribute from a top level block, along with its comments, returning its text in canonical format
+// and the range it occupied in the file. The block is kept even if the attribute was the last one in it
+func (f *nativeFile) removeAttribute(i int, name string) ([]byte, FileRange, error) {
+	block, err := f.block(i)
+	if err != nil {
+		return nil, FileRange{}, err
+	}
+	attr := block.Body().GetAttribute(name)
+	if attr == nil {
+		return nil, FileRange{}, fmt.Errorf("block %d of %s has no attribute %s", i, f.name, name)
+	}
+	tokens := f.tokens()
+	item := attr.BuildTokens(nil)
+	start := indexOfToken(tokens, item[0])
+	end := start + len(item)
+	from := f.byteRange(tokens, start, end)
+	text := canonicalText(item)
+
+	remaining := tidyNewlines(slices.Concat(tokens[:start], tokens[end:]), start)
+	if err = f.setTokens(remaining); err != nil {
+		return nil, FileRange{}, err
+	}
+	return text, from, nil
+}
+
+// appends a block (with any comments attached to it) to the end of the file, separated from what is already
+// there by a blank line, returning the range it occupies
+func (f *nativeFile) appendBlock(text []byte) (FileRange, error) {
+	added, err := lexTokens(bytes.TrimRight(hclwrite.Format(text), "\n"))
+	if err != nil {
+		return FileRange{}, err
+	}
+	tokens := f.tokens()
+	for len(tokens) > 0 && tokens[len(tokens)-1].Type == hclsyntax.TokenNewline {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) > 0 {
+		tokens = append(tokens, newlineToken())
+		if !bytes.HasSuffix(tokens[len(tokens)-2].Bytes, []byte("\n")) {
+			tokens = append(tokens, newlineToken())
+		}
+	}
+	if err = f.setTokens(slices.Concat(tokens, added, hclwrite.Tokens{newlineToken()})); err != nil {
+		return FileRange{}, err
+	}
+
+	blocks := f.file.Body().Blocks()
+	tokens = f.tokens()
+	start, end := attachedTokens(tokens, blocks[len(blocks)-1])
+	return f.byteRange(tokens, start, end), nil
+}
+
+// adds an attribute to the last locals block of the file, or to a new locals block if there is none,
+// returning the range it occupies
+func (f *nativeFile) addLocal(name string, text []byte) (FileRange, error) {
+	locals := f.lastBlock("locals")
+	if locals == nil {
+		if _, err := f.appendBlock(slices.Concat([]byte("locals {\n"), text, []byte("\n}"))); err != nil {
+			return FileRange{}, err
+		}
+	} else {
+		if locals.Body().GetAttribute(name) != nil {
+			return FileRange{}, fmt.Errorf("local %s already exists in destination file %s", name, f.name)
+		}
+		added, err := lexTokens(text)
+		if err != nil {
+			return FileRange{}, err
+		}
+		openBody(locals)
+		locals.Body().AppendUnstructuredTokens(slices.Concat(added, hclwrite.Tokens{newlineToken()}))
+		// the values of the block are aligned with the new one
+		if err = f.formatBlock(locals); err != nil {
+			return FileRange{}, err
+		}
+	}
+
+	attr := f.lastBlock("locals").Body().GetAttribute(name)
+	return f.itemRange(attr.BuildTokens(nil))
+}
+
+// starts a new line after the opening brace of a block written on a single line (ie locals {}), so that
+// items can be appended to its body
+func openBody(block *hclwrite.Block) {
+	own := block.BuildTokens(nil)
+	for i, tok := range own {
+		if tok.Type != hclsyntax.TokenOBrace {
+			continue
+		}
+		if i+1 < len(own) && own[i+1].Type != hclsyntax.TokenNewline {
+			block.Body().AppendNewline()
+		}
+		return
+	}
+}
+
+// the index of a token within tokens, compared by identity
+func indexOfToken(tokens hclwrite.Tokens, tok *hclwrite.Token) int {
+	return slices.Index(tokens, tok)
+}
+
+func withoutEOF(tokens hclwrite.Tokens) hclwrite.Tokens {
+	return slices.DeleteFunc(slices.Clone(tokens), func(tok *hclwrite.Token) bool {
+		return tok.Type == hclsyntax.TokenEOF
+	})
+}
+
+func newlineToken() *hclwrite.Token {
+	return &hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")}
+}
+
+// the tokens of some native syntax text
+func lexTokens(text []byte) (hclwrite.Tokens, error) {
+	f, diags := hclwrite.ParseConfig(text, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse %q: %s", text, diags.Error())
+	}
+	return withoutEOF(f.BuildTokens(nil)), nil
+}
+
+// the text of an item in canonical format, without the newline that ends it
+func canonicalText(tokens hclwrite.Tokens) []byte {
+	return bytes.TrimRight(hclwrite.Format(tokens.Bytes()), "\n")
+}
+
+// collapses the newlines around the given index of tokens, where an item was removed, so that at most one
+// blank line separates what was on either side of it. No newlines are left at the start of a file or body,
+// and only the newline ending the last line is kept at its end
+func tidyNewlines(tokens hclwrite.Tokens, at int) hclwrite.Tokens {
+	lo, hi := at, at
+	for lo > 0 && tokens[lo-1].Type == hclsyntax.TokenNewline {
+		lo--
+	}
+	for hi < len(tokens) && tokens[hi].Type == hclsyntax.TokenNewline {
+		hi++
+	}
+
+	keep := 2
+	switch {
+	case lo == 0:
+		keep = 0
+	case tokens[lo-1].Type == hclsyntax.TokenOBrace, hi == len(tokens), tokens[hi].Type == hclsyntax.TokenCBrace:
+		keep = 1
+	}
+	if lo > 0 && bytes.HasSuffix(tokens[lo-1].Bytes, []byte("\n")) {
+		// a line comment ends its own line
+		keep = max(keep-1, 0)
+	}
+	if hi-lo <= keep {
+		return tokens
+	}
+
+	return slices.Delete(tokens, lo+keep, hi)
+}
@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestNativeFile_removeBlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		index    int
+		wantText string
+		wantFrom string
+		wantFile string
+	}{
+		{
+			name:     "leaves one blank line between the blocks around it",
+			contents: "locals {}\n\n\nvariable \"a\" {}\n\n\noutput \"b\" {}\n",
+			index:    1,
+			wantText: "variable \"a\" {}",
+			wantFrom: "variable \"a\" {}",
+			wantFile: "locals {}\n\noutput \"b\" {}\n",
+		},
+		{
+			name:     "leaves no blank lines at the top of the file",
+			contents: "variable \"a\" {}\n\noutput \"b\" {}\n",
+			index:    0,
+			wantText: "variable \"a\" {}",
+			wantFrom: "variable \"a\" {}",
+			wantFile: "output \"b\" {}\n",
+		},
+		{
+			name:     "leaves one newline at the end of the file",
+			contents: "locals {}\n\n# about a\nvariable \"a\" {}\n\n",
+			index:    1,
+			wantText: "# about a\nvariable \"a\" {}",
+			wantFrom: "# about a\nvariable \"a\" {}",
+			wantFile: "locals {}\n",
+		},
+		{
+			name:     "formats the removed block and leaves the rest of the file as it was",
+			contents: "locals {\n    a = 1\n    bb = 2\n}\n\nvariable \"a\" {\ndefault = 1\n}\n",
+			index:    1,
+			wantText: "variable \"a\" {\n  default = 1\n}",
+			wantFrom: "variable \"a\" {\ndefault = 1\n}",
+			wantFile: "locals {\n    a = 1\n    bb = 2\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parseNativeFile("main.tf", []byte(tt.contents))
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, from, err := f.removeBlock(tt.index)
+			if err != nil {
+				t.Fatalf("removeBlock() error = %v", err)
+			}
+			if string(text) != tt.wantText {
+				t.Errorf("removeBlock() text = %q, want %q", text, tt.wantText)
+			}
+			if got := string(f.bytes()); got != tt.wantFile {
+				t.Errorf("removeBlock() file = %q, want %q", got, tt.wantFile)
+			}
+			if got := tt.contents[from.Start:from.End]; got != tt.wantFrom {
+				t.Errorf("removeBlock() range = %q, want %q", got, tt.wantFrom)
+			}
+		})
+	}
+}
+
+func TestNativeFile_addLocal(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantFile string
+		// the text of the added local, as the returned range finds it
+		wantRange string
+		wantErr   bool
+	}{
+		{
+			name:      "adds a locals block to an empty file",
+			contents:  "",
+			wantFile:  "locals {\n  tags = {}\n}\n",
+			wantRange: "tags = {}",
+		},
+		{
+			name:      "opens a locals block written on one line",
+			contents:  "locals {}\n",
+			wantFile:  "locals {\n  tags = {}\n}\n",
+			wantRange: "tags = {}",
+		},
+		{
+			name:      "adds the local to the last locals block",
+			contents:  "locals {\n  region = \"us-east-1\"\n}\n\nlocals {\n  name = \"example\"\n}\n",
+			wantFile:  "locals {\n  region = \"us-east-1\"\n}\n\nlocals {\n  name = \"example\"\n  tags = {}\n}\n",
+			wantRange: "tags = {}",
+		},
+		{
+			name:      "formats only the locals block the local is added to",
+			contents:  "variable \"a\" {\ndefault = 1\n}\n\nlocals {\n    environment = \"dev\"\n}\n",
+			wantFile:  "variable \"a\" {\ndefault = 1\n}\n\nlocals {\n  environment = \"dev\"\n  tags        = {}\n}\n",
+			wantRange: "tags        = {}",
+		},
+		{
+			name:     "fails when the local already exists",
+			contents: "locals {\n  tags = {}\n}\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parseNativeFile("locals.tf", []byte(tt.contents))
+			if err != nil {
+				t.Fatal(err)
+			}
+			to, err := f.addLocal("tags", []byte("tags = {}"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("addLocal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := f.bytes()
+			if string(got) != tt.wantFile {
+				t.Errorf("addLocal() file = %q, want %q", got, tt.wantFile)
+			}
+			if s := string(got[to.Start:to.End]); s != tt.wantRange {
+				t.Errorf("addLocal() range = %q, want %q", s, tt.wantRange)
+			}
+		})
+	}
+}
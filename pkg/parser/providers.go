@@ -0,0 +1,540 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	filestats "github.com/msarfaty/tuf/pkg/file"
+)
+
+const (
+	// the attribute of a resource or data block that selects a provider configuration
+	PROVIDER_ATTRIBUTE = "provider"
+	// the attribute of a module block that passes provider configurations to the module
+	PROVIDERS_ATTRIBUTE = "providers"
+	// the attribute of a provider block that names an alternate configuration
+	PROVIDER_ALIAS_ATTRIBUTE = "alias"
+	// the file provider configurations are copied into
+	PROVIDERS_FILE_NAME = "providers.tuf.tf"
+)
+
+// returned when a moved block uses a provider configuration that could be copied into the destination but was not
+var ErrMissingProvider = errors.New("provider configuration is missing from the destination")
+
+// a reference to an aliased provider configuration (ie aws.east)
+type ProviderRef struct {
+	// the local name of the provider (ie aws)
+	Name string
+	// the alias of the configuration (ie east)
+	Alias string
+}
+
+func (p ProviderRef) String() string {
+	if p.Alias == "" {
+		return p.Name
+	}
+	return fmt.Sprintf("%s.%s", p.Name, p.Alias)
+}
+
+// the reference as a traversal, for writing it into a provider attribute
+func (p ProviderRef) traversal() hcl.Traversal {
+	if p.Alias == "" {
+		return hcl.Traversal{hcl.TraverseRoot{Name: p.Name}}
+	}
+	return hcl.Traversal{hcl.TraverseRoot{Name: p.Name}, hcl.TraverseAttr{Name: p.Alias}}
+}
+
+// a provider configuration block found in a module
+type providerConfig struct {
+	ref ProviderRef
+	// the block as native syntax, rendered from JSON syntax if needed
+	text []byte
+	// where the block is defined; the header of blocks in JSON syntax files
+	from FileRange
+	// the objects of a block in a JSON syntax file that were rendered as map attributes
+	maps []string
+}
+
+// the aliased provider configurations a block uses through its provider or providers attributes.
+// default (unaliased) configurations are not returned, since terraform can create them implicitly
+func providerReferences(block *hcl.Block) []ProviderRef {
+	content, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: PROVIDER_ATTRIBUTE}, {Name: PROVIDERS_ATTRIBUTE}},
+	})
+	if diags.HasErrors() {
+		return nil
+	}
+
+	exprs := []hcl.Expression{}
+	if attr, ok := content.Attributes[PROVIDER_ATTRIBUTE]; ok {
+		exprs = append(exprs, attr.Expr)
+	}
+	if attr, ok := content.Attributes[PROVIDERS_ATTRIBUTE]; ok {
+		pairs, _ := hcl.ExprMap(attr.Expr)
+		for _, pair := range pairs {
+			exprs = append(exprs, pair.Value)
+		}
+	}
+
+	ret := []ProviderRef{}
+	for _, expr := range exprs {
+		if ref, ok := providerRef(expr); ok && !slices.Contains(ret, ref) {
+			ret = append(ret, ref)
+		}
+	}
+	return ret
+}
+
+// reads an aliased provider reference (ie aws.east) from an expression
+func providerRef(expr hcl.Expression) (ProviderRef, bool) {
+	traversal, diags := hcl.AbsTraversalForExpr(expr)
+	if diags.HasErrors() || len(traversal) != 2 {
+		return ProviderRef{}, false
+	}
+	attr, ok := traversal[1].(hcl.TraverseAttr)
+	if !ok {
+		return ProviderRef{}, false
+	}
+	return ProviderRef{Name: traversal.RootName(), Alias: attr.Name}, true
+}
+
+// reads a reference to either a default provider configuration (ie aws) or an aliased one (ie aws.east)
+func providerConfigRef(expr hcl.Expression) (ProviderRef, bool) {
+	traversal, diags := hcl.AbsTraversalForExpr(expr)
+	if diags.HasErrors() || len(traversal) != 1 {
+		return providerRef(expr)
+	}
+	return ProviderRef{Name: traversal.RootName()}, true
+}
+
+// the provider configuration a resource or data block selects with its provider attribute, or otherwise the default
+// configuration of the provider its type belongs to. ok is false for other blocks
+func blockProvider(block *hcl.Block) (ProviderRef, bool) {
+	if (block.Type != "resource" && block.Type != "data") || len(block.Labels) != 2 {
+		return ProviderRef{}, false
+	}
+	content, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: PROVIDER_ATTRIBUTE}},
+	})
+	if diags.HasErrors() {
+		return ProviderRef{}, false
+	}
+	if attr, ok := content.Attributes[PROVIDER_ATTRIBUTE]; ok {
+		return providerConfigRef(attr.Expr)
+	}
+	name, _, _ := strings.Cut(block.Labels[0], "_")
+	return ProviderRef{Name: name}, true
+}
+
+// the providers attribute of a module block, mapping the configurations the module knows to those of its caller.
+// ok is false if the block has no providers attribute, in which case the module inherits the default configurations
+// of its caller
+func moduleProvidersMap(block *hcl.Block) (map[ProviderRef]ProviderRef, bool) {
+	content, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: PROVIDERS_ATTRIBUTE}},
+	})
+	if diags.HasErrors() {
+		return nil, false
+	}
+	attr, ok := content.Attributes[PROVIDERS_ATTRIBUTE]
+	if !ok {
+		return nil, false
+	}
+
+	ret := map[ProviderRef]ProviderRef{}
+	pairs, _ := hcl.ExprMap(attr.Expr)
+	for _, pair := range pairs {
+		key, keyOk := providerConfigRef(pair.Key)
+		value, valueOk := providerConfigRef(pair.Value)
+		if keyOk && valueOk {
+			ret[key] = value
+		}
+	}
+	return ret, true
+}
+
+// sets the provider of the block in some native syntax text, leaving the rest of it as it was
+func setBlockProvider(text []byte, ref ProviderRef) ([]byte, error) {
+	f, diags := hclwrite.ParseConfig(text, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse %q: %s", text, diags.Error())
+	}
+	for _, block := range f.Body().Blocks() {
+		block.Body().SetAttributeTraversal(PROVIDER_ATTRIBUTE, ref.traversal())
+		return f.BuildTokens(nil).Bytes(), nil
+	}
+
+	return nil, fmt.Errorf("no block found in %q", text)
+}
+
+// a provider configuration a moved block uses, along with the module that defines it or that it is passed into
+type usedProvider struct {
+	ref ProviderRef
+	// the directory of the module the configuration is known in by ref
+	dir string
+	// the module path of that module
+	modulePath []*ModuleCall
+}
+
+// the module blocks of each module call along a module path, and the directory of each module starting from the given
+// directory of the outermost one, as previous moves left them
+func moduleCalls(files fileSet, dir string, path []*ModuleCall) ([]*hcl.Block, []string, error) {
+	calls := []*hcl.Block{}
+	dirs := []string{dir}
+	for _, mc := range path {
+		block, fname, err := files.moduleCall(dir, mc.Name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve %s: %w", mc, err)
+		}
+		source, err := localSource(block, fname)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve %s: %w", mc, err)
+		}
+		dir = filepath.Join(dir, source)
+		calls = append(calls, block)
+		dirs = append(dirs, dir)
+	}
+	return calls, dirs, nil
+}
+
+// follows a provider configuration used in the module at the end of a module path up through the providers attribute
+// of each module call, as far as the module at index top of the path. The configuration is returned as it is known in
+// the module that defines it, or in the module at top if it is passed all the way in
+func callerProvider(calls []*hcl.Block, dirs []string, path []*ModuleCall, top int, ref ProviderRef) usedProvider {
+	for i := len(calls) - 1; i >= top; i-- {
+		providers, ok := moduleProvidersMap(calls[i])
+		if to, mapped := providers[ref]; mapped {
+			ref = to
+			continue
+		}
+		// aliased configurations are only passed in explicitly, and default ones are no longer inherited once any
+		// configuration is
+		if ok || ref.Alias != "" {
+			return usedProvider{ref: ref, dir: dirs[i+1], modulePath: path[:i+1]}
+		}
+	}
+	return usedProvider{ref: ref, dir: dirs[top], modulePath: path[:top]}
+}
+
+// the aliased provider configurations a block moved out of the module at the end of a module path uses, as they are
+// known in the modules they come from, found by following the providers attribute of each module call along the path
+// from the directory of the outermost module. A resource or data block passed its configuration under another name is
+// given the configuration it must select to keep using it; nil if it keeps the one it selects. A module block cannot
+// be given its providers this way, so it cannot be moved if its module is passed a configuration under another name.
+// Configurations are only followed out of the modules the block leaves, so a block moved into one of the modules along
+// its path keeps the configurations that module is passed
+func passedProviders(files fileSet, dir string, path []*ModuleCall, block *hcl.Block, destDir string) ([]usedProvider, *ProviderRef, error) {
+	calls, dirs, err := moduleCalls(files, dir, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	top := 0
+	for i, d := range dirs {
+		if sameDirectory(d, destDir) {
+			top = i
+		}
+	}
+
+	if ref, ok := blockProvider(block); ok {
+		used := callerProvider(calls, dirs, path, top, ref)
+		var provider *ProviderRef
+		if used.ref != ref {
+			provider = &used.ref
+		}
+		if used.ref.Alias == "" {
+			return nil, provider, nil
+		}
+		return []usedProvider{used}, provider, nil
+	}
+
+	refs := providerReferences(block)
+	if block.Type == MODULE_PREFIX {
+		providers, ok := moduleProvidersMap(block)
+		if ok {
+			refs = slices.Collect(maps.Values(providers))
+		} else {
+			// the module inherits the default configurations of the module it is moved out of
+			for _, call := range calls[top:] {
+				providers, _ := moduleProvidersMap(call)
+				refs = append(refs, slices.Collect(maps.Keys(providers))...)
+			}
+			refs = slices.DeleteFunc(refs, func(ref ProviderRef) bool { return ref.Alias != "" })
+		}
+		slices.SortFunc(refs, func(a ProviderRef, b ProviderRef) int { return strings.Compare(a.String(), b.String()) })
+		refs = slices.Compact(refs)
+	}
+
+	ret := []usedProvider{}
+	for _, ref := range refs {
+		used := callerProvider(calls, dirs, path, top, ref)
+		if used.ref != ref {
+			return nil, nil, fmt.Errorf("provider %s used by module %s is passed into %s as %s; moving the module block out would leave it without that configuration", ref, block.Labels[0], dirs[len(dirs)-1], used.ref)
+		}
+		if used.ref.Alias != "" {
+			ret = append(ret, used)
+		}
+	}
+	return ret, nil, nil
+}
+
+// whether two paths name the same directory
+func sameDirectory(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// the alias of a provider block; empty for the default configuration
+func providerAlias(block *hcl.Block) string {
+	content, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: PROVIDER_ALIAS_ATTRIBUTE}},
+	})
+	if diags.HasErrors() {
+		return ""
+	}
+	attr, ok := content.Attributes[PROVIDER_ALIAS_ATTRIBUTE]
+	if !ok {
+		return ""
+	}
+	value, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || !value.Type().IsPrimitiveType() || value.IsNull() || !value.IsKnown() {
+		return ""
+	}
+	return value.AsString()
+}
+
+// the provider configurations a child module expects to be passed in through configuration_aliases
+func configurationAliases(block *hcl.Block) []ProviderRef {
+	content, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "required_providers"}},
+	})
+	if diags.HasErrors() {
+		return nil
+	}
+
+	ret := []ProviderRef{}
+	for _, rp := range content.Blocks {
+		attrs, diags := rp.Body.JustAttributes()
+		if diags.HasErrors() {
+			continue
+		}
+		for _, attr := range attrs {
+			pairs, _ := hcl.ExprMap(attr.Expr)
+			for _, pair := range pairs {
+				if key, diags := pair.Key.Value(nil); diags.HasErrors() || key.AsString() != "configuration_aliases" {
+					continue
+				}
+				aliases, _ := hcl.ExprList(pair.Value)
+				for _, alias := range aliases {
+					if ref, ok := providerRef(alias); ok {
+						ret = append(ret, ref)
+					}
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// the text of a provider block as native syntax, rendering it if it comes from a JSON syntax file along with
+// the objects in it that were rendered as map attributes
+func providerText(files fileSet, cf *configFile, i int, ref ProviderRef) ([]byte, []string, error) {
+	block := cf.blocks[i]
+	contents, err := files.read(block.DefRange.Filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !cf.isJson {
+		r := cf.native[i].Range()
+		return contents[r.Start.Byte:r.End.Byte], nil, nil
+	}
+
+	// find the JSON body of this configuration; a provider may have many configurations in an array
+	top, _, err := parseJsonObject(contents)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, m := range top {
+		if m.Key != "provider" {
+			continue
+		}
+		providers, _, err := parseJsonObject(m.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, p := range providers {
+			if p.Key != ref.Name {
+				continue
+			}
+			bodies, _, err := jsonBlockBodies(p.Value, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, body := range bodies {
+				raw, err := json.Marshal(body)
+				if err != nil {
+					return nil, nil, err
+				}
+				var alias string
+				for _, attr := range body {
+					if attr.Key == PROVIDER_ALIAS_ATTRIBUTE {
+						json.Unmarshal(attr.Value, &alias)
+					}
+				}
+				if alias == ref.Alias {
+					return renderJsonBlock("provider", []string{ref.Name}, raw)
+				}
+			}
+		}
+	}
+
+	return nil, nil, fmt.Errorf("failed to find provider %s in %s", ref, block.DefRange.Filename)
+}
+
+// the terraform files of a directory as previous moves left them, including files created by those moves
+func (files fileSet) directoryFiles(dir string) ([]string, error) {
+	ret, err := filestats.GetAllTerraformFilesInDirectory(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range ret {
+		ret[i] = filepath.Clean(name)
+	}
+	for name, contents := range files {
+		isTerraform := filepath.Ext(name) == filestats.EXT_TERRAFORM || filestats.IsTerraformJsonFile(name)
+		if contents == nil || !isTerraform || filepath.Dir(name) != filepath.Clean(dir) || slices.Contains(ret, name) {
+			continue
+		}
+		ret = append(ret, name)
+	}
+	slices.Sort(ret)
+
+	return slices.DeleteFunc(ret, func(name string) bool {
+		contents, err := files.read(name)
+		return err == nil && contents == nil
+	}), nil
+}
+
+// the aliased provider configurations defined in a module directory, and those the module expects through configuration_aliases
+func moduleProviders(files fileSet, dir string) (map[ProviderRef]*providerConfig, []ProviderRef, error) {
+	names, err := files.directoryFiles(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	configs := map[ProviderRef]*providerConfig{}
+	expected := []ProviderRef{}
+	for _, name := range names {
+		cf, err := files.parse(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, block := range cf.blocks {
+			switch block.Type {
+			case "terraform":
+				expected = append(expected, configurationAliases(block)...)
+			case "provider":
+				ref := ProviderRef{Name: block.Labels[0], Alias: providerAlias(block)}
+				if ref.Alias == "" {
+					continue
+				}
+				text, maps, err := providerText(files, cf, i, ref)
+				if err != nil {
+					return nil, nil, err
+				}
+				from := FileRange{Filename: name, Start: block.DefRange.Start.Byte, End: block.DefRange.End.Byte}
+				if !cf.isJson {
+					r := cf.native[i].Range()
+					from = FileRange{Filename: name, Start: r.Start.Byte, End: r.End.Byte}
+				}
+				configs[ref] = &providerConfig{ref: ref, text: text, from: from, maps: maps}
+			}
+		}
+	}
+
+	return configs, expected, nil
+}
+
+// whether two provider configurations are written the same way, ignoring whitespace
+func equivalentProviders(a []byte, b []byte) bool {
+	strip := func(text []byte) []byte {
+		return bytes.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, text)
+	}
+	return bytes.Equal(strip(a), strip(b))
+}
+
+// checks that every aliased provider configuration a moved block uses exists in the destination module.
+// Missing configurations are copied from the module they are known in into the providers file of the destination
+// if copy is set, returning a result for each copy; otherwise the move fails. Configurations that exist in both
+// modules but are written differently are reported as warnings on the result of the block.
+func planProviders(files fileSet, result *MoveResult, used []usedProvider, copy bool) ([]*MoveResult, error) {
+	if len(used) == 0 {
+		return nil, nil
+	}
+	dstDir := filepath.Dir(result.To.Filename)
+	dstConfigs, dstExpected, err := moduleProviders(files, dstDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read providers of %s: %w", dstDir, err)
+	}
+
+	ret := []*MoveResult{}
+	for _, u := range used {
+		ref, srcDir := u.ref, u.dir
+		srcConfigs, srcExpected, err := moduleProviders(files, srcDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read providers of %s: %w", srcDir, err)
+		}
+		src, inSource := srcConfigs[ref]
+		dst, inDestination := dstConfigs[ref]
+		switch {
+		case inDestination && inSource && !equivalentProviders(src.text, dst.text):
+			result.Warnings = append(result.Warnings, fmt.Sprintf("provider %s used by %s is configured differently in %s and %s; check that they are interchangeable", ref, result.Address, src.from.Filename, dst.from.Filename))
+		case inDestination, slices.Contains(dstExpected, ref):
+		case !inSource && slices.Contains(srcExpected, ref):
+			return nil, fmt.Errorf("provider %s used by %s is passed into %s by its caller and is not configured in %s", ref, result.Address, srcDir, dstDir)
+		case !inSource:
+			return nil, fmt.Errorf("provider %s used by %s is not configured in %s or %s", ref, result.Address, srcDir, dstDir)
+		case !copy:
+			return nil, fmt.Errorf("%w: %s used by %s is configured in %s but not in %s", ErrMissingProvider, ref, result.Address, src.from.Filename, dstDir)
+		default:
+			dest := filepath.Join(dstDir, PROVIDERS_FILE_NAME)
+			before, f, err := files.native(dest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open destination file %s: %w", dest, err)
+			}
+			to, err := f.appendBlock(src.text)
+			if err != nil {
+				return nil, err
+			}
+			copied := &MoveResult{
+				Address:  withModulePath(u.modulePath, "provider."+ref.String()),
+				Provider: &ref,
+				Copy:     true,
+				From:     src.from,
+				To:       to,
+				Edits:    []*FileEdit{{Filename: dest, Before: before, After: f.bytes()}},
+				maps:     src.maps,
+			}
+			files.apply(copied.Edits)
+			// the copy is now part of the destination, so later blocks using it find it there
+			dstConfigs[ref] = &providerConfig{ref: ref, text: src.text, from: copied.To}
+			ret = append(ret, copied)
+		}
+	}
+
+	return ret, nil
+}
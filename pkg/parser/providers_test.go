@@ -0,0 +1,212 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestMoveHclBlocks_Providers(t *testing.T) {
+	east := "provider \"aws\" {\n  alias  = \"east\"\n  region = \"us-east-1\"\n}\n"
+	tests := []struct {
+		name          string
+		source        string
+		destination   string
+		copyProviders bool
+		wantResults   int
+		wantProviders string
+		wantWarnings  int
+		wantErr       error
+	}{
+		{
+			name:        "fails when an aliased provider is missing from the destination",
+			source:      "resource \"aws_iam_role\" \"this\" {\n  provider = aws.east\n}\n\n" + east,
+			destination: "",
+			wantErr:     ErrMissingProvider,
+		},
+		{
+			name:          "copies a missing provider used by a module",
+			source:        "module \"vpc\" {\n  source    = \"./vpc\"\n  providers = { aws = aws.east }\n}\n\n" + east,
+			destination:   "",
+			copyProviders: true,
+			wantResults:   2,
+			wantProviders: east,
+		},
+		{
+			name:        "passes when the destination configures the same provider",
+			source:      "resource \"aws_iam_role\" \"this\" {\n  provider = aws.east\n}\n\n" + east,
+			destination: east,
+			wantResults: 1,
+		},
+		{
+			name:         "warns when the destination configures the provider differently",
+			source:       "resource \"aws_iam_role\" \"this\" {\n  provider = aws.east\n}\n\n" + east,
+			destination:  "provider \"aws\" {\n  alias  = \"east\"\n  region = \"us-east-2\"\n}\n",
+			wantResults:  1,
+			wantWarnings: 1,
+		},
+		{
+			name:        "passes when the destination expects the provider from its caller",
+			source:      "resource \"aws_iam_role\" \"this\" {\n  provider = aws.east\n}\n\n" + east,
+			destination: "terraform {\n  required_providers {\n    aws = {\n      source                = \"hashicorp/aws\"\n      configuration_aliases = [aws.east]\n    }\n  }\n}\n",
+			wantResults: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fromFile := path.Join(t.TempDir(), "main.tf")
+			toDir := t.TempDir()
+			if err := os.WriteFile(fromFile, []byte(tt.source), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.destination != "" {
+				if err := os.WriteFile(path.Join(toDir, "main.tf"), []byte(tt.destination), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			selector := "aws_iam_role.*"
+			if tt.copyProviders {
+				selector = "module.*"
+			}
+			results, err := MoveHclBlocks(&MoveOptions{
+				Address:       selector,
+				FromFile:      fromFile,
+				ToDirectory:   toDir,
+				CopyProviders: tt.copyProviders,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MoveHclBlocks() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(results) != tt.wantResults {
+				t.Errorf("MoveHclBlocks() = %d results, want %d", len(results), tt.wantResults)
+			}
+			if len(results[0].Warnings) != tt.wantWarnings {
+				t.Errorf("MoveHclBlocks() warnings = %v, want %d", results[0].Warnings, tt.wantWarnings)
+			}
+			gotProviders, err := os.ReadFile(path.Join(toDir, PROVIDERS_FILE_NAME))
+			if err != nil && tt.wantProviders != "" {
+				t.Fatal(err)
+			}
+			if string(gotProviders) != tt.wantProviders {
+				t.Errorf("MoveHclBlocks() providers file =\nSTART%sEOF, want\nSTART%sEOF", string(gotProviders), tt.wantProviders)
+			}
+		})
+	}
+}
+
+func TestMoveHclBlocks_PassedProviders(t *testing.T) {
+	east := "provider \"aws\" {\n  alias  = \"east\"\n  region = \"us-east-1\"\n}\n"
+	call := func(providers string) string {
+		return "module \"child\" {\n  source    = \"./child\"\n  providers = " + providers + "\n}\n\n" + east
+	}
+	tests := []struct {
+		name          string
+		root          string
+		child         string
+		address       string
+		copyProviders bool
+		// whether the block is moved to another file of the child module rather than out of it
+		withinChild bool
+		wantBlock   string
+		wantResults int
+		wantErr     bool
+	}{
+		{
+			name:          "selects the configuration passed as the default one",
+			root:          call("{ aws = aws.east }"),
+			child:         "resource \"aws_iam_role\" \"this\" {\n}\n",
+			address:       "module.child.aws_iam_role.this",
+			copyProviders: true,
+			wantBlock:     "resource \"aws_iam_role\" \"this\" {\n  provider = aws.east\n}\n",
+			wantResults:   2,
+		},
+		{
+			name:          "selects the configuration passed under another alias",
+			root:          call("{ aws.west = aws.east }"),
+			child:         "resource \"aws_iam_role\" \"this\" {\n  provider = aws.west\n}\n",
+			address:       "module.child.aws_iam_role.this",
+			copyProviders: true,
+			wantBlock:     "resource \"aws_iam_role\" \"this\" {\n  provider = aws.east\n}\n",
+			wantResults:   2,
+		},
+		{
+			name:    "fails when the passed configuration is missing from the destination",
+			root:    call("{ aws = aws.east }"),
+			child:   "resource \"aws_iam_role\" \"this\" {\n}\n",
+			address: "module.child.aws_iam_role.this",
+			wantErr: true,
+		},
+		{
+			name:        "keeps the default configuration inherited from the caller",
+			root:        "module \"child\" {\n  source = \"./child\"\n}\n",
+			child:       "resource \"aws_iam_role\" \"this\" {\n}\n",
+			address:     "module.child.aws_iam_role.this",
+			wantBlock:   "resource \"aws_iam_role\" \"this\" {\n}\n",
+			wantResults: 1,
+		},
+		{
+			name:        "keeps the configuration of a block moved within its module",
+			root:        call("{ aws = aws.east }"),
+			child:       "resource \"aws_iam_role\" \"this\" {\n}\n",
+			address:     "module.child.aws_iam_role.this",
+			withinChild: true,
+			wantBlock:   "resource \"aws_iam_role\" \"this\" {\n}\n",
+			wantResults: 1,
+		},
+		{
+			name:    "fails to move a module block whose module is passed a configuration under another name",
+			root:    call("{ aws = aws.east }"),
+			child:   "module \"grandchild\" {\n  source = \"../grandchild\"\n}\n",
+			address: "module.child.module.grandchild",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fromDir := t.TempDir()
+			toDir := t.TempDir()
+			if tt.withinChild {
+				toDir = path.Join(fromDir, "child")
+			}
+			for name, contents := range map[string]string{"main.tf": tt.root, "child/main.tf": tt.child, "grandchild/main.tf": ""} {
+				if err := os.MkdirAll(path.Dir(path.Join(fromDir, name)), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path.Join(fromDir, name), []byte(contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			results, err := MoveHclBlocks(&MoveOptions{
+				Address:       tt.address,
+				FromDirectory: fromDir,
+				ToDirectory:   toDir,
+				FileName:      "moved.tf",
+				CopyProviders: tt.copyProviders,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MoveHclBlocks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(results) != tt.wantResults {
+				t.Errorf("MoveHclBlocks() = %d results, want %d", len(results), tt.wantResults)
+			}
+			gotBlock, err := os.ReadFile(path.Join(toDir, "moved.tf"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(gotBlock) != tt.wantBlock {
+				t.Errorf("MoveHclBlocks() moved block =\nSTART%sEOF, want\nSTART%sEOF", string(gotBlock), tt.wantBlock)
+			}
+		})
+	}
+}
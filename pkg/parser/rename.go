@@ -0,0 +1,241 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	filestats "github.com/msarfaty/tuf/pkg/file"
+)
+
+// the file moved blocks are written to, in the module of the renamed block
+const MOVED_FILE_NAME = "moved.tuf.tf"
+
+// options for renaming a block within the module it lives in
+type RenameOptions struct {
+	// the address of the block to rename
+	Address string
+	// the address to rename the block to; only its name may differ from Address
+	NewAddress string
+	// the directory of the root module; blocks in child modules are found by following the module path of the address from here
+	Directory string
+	// compute the rename without writing anything to disk
+	DryRun bool
+
+	from *Address
+	to   *Address
+}
+
+// validate RenameOptions
+func (ro *RenameOptions) validate() error {
+	if ro.Directory == "" {
+		return errors.New("must set the directory to rename in")
+	}
+
+	from, err := ParseAddress(ro.Address)
+	if err != nil {
+		return err
+	}
+	to, err := ParseAddress(ro.NewAddress)
+	if err != nil {
+		return err
+	}
+	switch {
+	case from.Kind != ADDRESS_RESOURCE && from.Kind != ADDRESS_DATA && from.Kind != ADDRESS_MODULE:
+		return fmt.Errorf("only resources, data sources and modules can be renamed (%s is none of these)", ro.Address)
+	case from.Key != "" || to.Key != "":
+		return fmt.Errorf("cannot rename %s to %s; only whole blocks can be renamed, not single instances", ro.Address, ro.NewAddress)
+	case from.Kind != to.Kind || from.Type != to.Type:
+		return fmt.Errorf("cannot rename %s to %s; only the name of a block can change", ro.Address, ro.NewAddress)
+	case ModulePathString(from.ModulePath) != ModulePathString(to.ModulePath):
+		return fmt.Errorf("cannot rename %s to %s in another module; move the block and rename it separately", ro.Address, ro.NewAddress)
+	case from.Name == to.Name:
+		return fmt.Errorf("%s is already named %s", ro.Address, from.Name)
+	}
+	ro.from, ro.to = from, to
+
+	return nil
+}
+
+// the names of the traversal that references the addressed block from within its own module
+// (ie aws_iam_role.this, data.aws_caller_identity.this or module.eks)
+func referenceNames(a *Address) []string {
+	switch a.Kind {
+	case ADDRESS_RESOURCE:
+		return []string{a.Type, a.Name}
+	case ADDRESS_DATA:
+		return []string{ADDRESS_DATA, a.Type, a.Name}
+	default:
+		return []string{a.Kind, a.Name}
+	}
+}
+
+// renames every reference starting with the search names in the attributes of a body and every body nested in it
+func renameReferences(body *hclwrite.Body, search []string, replacement []string) {
+	for _, attr := range body.Attributes() {
+		attr.Expr().RenameVariablePrefix(search, replacement)
+	}
+	for _, block := range body.Blocks() {
+		renameReferences(block.Body(), search, replacement)
+	}
+}
+
+// whether JSON syntax contents mention a reference, which tuf cannot rewrite within JSON strings
+func mentionsReference(contents []byte, names []string) bool {
+	ref := regexp.QuoteMeta(names[0])
+	for _, name := range names[1:] {
+		ref += `\.` + regexp.QuoteMeta(name)
+	}
+	return regexp.MustCompile(`(^|[^\w.])` + ref + `\b`).Match(contents)
+}
+
+// computes the edits needed to rename a block in place: its labels are rewritten, every reference to it in its
+// module is updated, and a moved block is added to MOVED_FILE_NAME so terraform renames its state. Data sources
+// have no state of their own, so they are renamed without a moved block. References within moved and removed
+// blocks are left alone, since they name addresses as they were
+func planRename(files fileSet, ro *RenameOptions) (*MoveResult, error) {
+	dir, err := ResolveModuleDirectory(ro.Directory, ro.from.ModulePath)
+	if err != nil {
+		return nil, err
+	}
+	names, err := files.directoryFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open module directory %s: %w", dir, err)
+	}
+	bd, err := New(ro.Address)
+	if err != nil {
+		return nil, err
+	}
+	renamed, err := New(ro.NewAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	fname, index := "", -1
+	for _, name := range names {
+		cf, err := files.parse(name)
+		if err != nil {
+			return nil, err
+		}
+		for i, block := range cf.blocks {
+			if renamed.Matches(*block) {
+				return nil, fmt.Errorf("cannot rename %s to %s, which already exists in %s", ro.Address, ro.NewAddress, name)
+			}
+			if !bd.Matches(*block) {
+				continue
+			}
+			if cf.isJson {
+				return nil, fmt.Errorf("cannot rename %s in JSON syntax file %s; only native syntax files can be written", ro.Address, name)
+			}
+			fname, index = name, i
+		}
+	}
+	if fname == "" {
+		return nil, fmt.Errorf("no block was found in any file matching the address %s", ro.Address)
+	}
+
+	search, replacement := referenceNames(ro.from), referenceNames(ro.to)
+	result := &MoveResult{Address: ro.Address, Edits: []*FileEdit{}}
+	for _, name := range names {
+		before, err := files.read(name)
+		if err != nil {
+			return nil, err
+		}
+		if filestats.IsTerraformJsonFile(name) {
+			if mentionsReference(before, search) {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("references to %s in JSON syntax file %s are not updated; rename them by hand", ro.Address, name))
+			}
+			continue
+		}
+
+		_, f, err := files.native(name)
+		if err != nil {
+			return nil, err
+		}
+		unchanged := f.bytes()
+		if name == fname {
+			block, err := f.block(index)
+			if err != nil {
+				return nil, err
+			}
+			tokens := f.tokens()
+			start, end := attachedTokens(tokens, block)
+			result.From = f.byteRange(tokens, start, end)
+			// the name is always the last label (ie resource "aws_iam_role" "this" or module "eks")
+			block.SetLabels(slices.Concat(block.Labels()[:len(block.Labels())-1], []string{ro.to.Name}))
+		}
+		for _, block := range f.file.Body().Blocks() {
+			if block.Type() != "moved" && block.Type() != "removed" {
+				renameReferences(block.Body(), search, replacement)
+			}
+		}
+		if bytes.Equal(f.bytes(), unchanged) {
+			continue
+		}
+		if name == fname {
+			block, err := f.block(index)
+			if err != nil {
+				return nil, err
+			}
+			// only the renamed block is formatted, so that renaming never reformats the code around it
+			if err = f.formatBlock(block); err != nil {
+				return nil, err
+			}
+			if block, err = f.block(index); err != nil {
+				return nil, err
+			}
+			tokens := f.tokens()
+			start, end := attachedTokens(tokens, block)
+			result.To = f.byteRange(tokens, start, end)
+		}
+		result.Edits = append(result.Edits, &FileEdit{Filename: name, Before: before, After: f.bytes()})
+	}
+	files.apply(result.Edits)
+
+	if ro.from.Kind == ADDRESS_DATA {
+		return result, nil
+	}
+	dest := filepath.Join(dir, MOVED_FILE_NAME)
+	before, f, err := files.native(dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", dest, err)
+	}
+	from := &Address{Kind: ro.from.Kind, Type: ro.from.Type, Name: ro.from.Name}
+	to := &Address{Kind: ro.to.Kind, Type: ro.to.Type, Name: ro.to.Name}
+	if _, err = f.appendBlock([]byte(fmt.Sprintf("moved {\n  from = %s\n  to   = %s\n}", from, to))); err != nil {
+		return nil, err
+	}
+	// the moved file may already have been edited if it held references (ie in an import block)
+	idx := slices.IndexFunc(result.Edits, func(edit *FileEdit) bool { return edit.Filename == filepath.Clean(dest) })
+	if idx >= 0 {
+		result.Edits[idx].After = f.bytes()
+	} else {
+		result.Edits = append(result.Edits, &FileEdit{Filename: filepath.Clean(dest), Before: before, After: f.bytes()})
+	}
+	files.apply(result.Edits)
+
+	return result, nil
+}
+
+// rename a block within the module it lives in, updating every reference to it
+func RenameHclBlock(ro *RenameOptions) (*MoveResult, error) {
+	if err := ro.validate(); err != nil {
+		return nil, fmt.Errorf("invalid rename options: %w", err)
+	}
+
+	result, err := planRename(fileSet{}, ro)
+	if err != nil {
+		return nil, err
+	}
+	if !ro.DryRun {
+		if err = WriteEdits(result.Edits); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/msarfaty/tuf/internal/testutils"
+)
+
+func TestRenameHclBlock(t *testing.T) {
+	sg := "resource \"aws_security_group\" \"foo\" {\n  name = \"foo\"\n}\n"
+	tests := []struct {
+		name         string
+		contents     map[string]string
+		address      string
+		newAddress   string
+		want         map[string]string
+		wantWarnings int
+		wantErr      bool
+	}{
+		{
+			name: "renames a resource and every reference to it",
+			contents: map[string]string{
+				"main.tf":  sg,
+				"rules.tf": "resource \"aws_security_group_rule\" \"ingress\" {\n  security_group_id = aws_security_group.foo.id\n  description       = \"for ${aws_security_group.foo.name}\"\n  depends_on        = [aws_security_group.foo, aws_security_group.foobar]\n}\n",
+			},
+			address:    "aws_security_group.foo",
+			newAddress: "aws_security_group.bar",
+			want: map[string]string{
+				"main.tf":       "resource \"aws_security_group\" \"bar\" {\n  name = \"foo\"\n}\n",
+				"rules.tf":      "resource \"aws_security_group_rule\" \"ingress\" {\n  security_group_id = aws_security_group.bar.id\n  description       = \"for ${aws_security_group.bar.name}\"\n  depends_on        = [aws_security_group.bar, aws_security_group.foobar]\n}\n",
+				MOVED_FILE_NAME: "moved {\n  from = aws_security_group.foo\n  to   = aws_security_group.bar\n}\n",
+			},
+		},
+		{
+			name: "leaves earlier moved blocks naming the old address alone",
+			contents: map[string]string{
+				"main.tf":       sg,
+				MOVED_FILE_NAME: "moved {\n  from = aws_security_group.old\n  to   = aws_security_group.foo\n}\n",
+			},
+			address:    "aws_security_group.foo",
+			newAddress: "aws_security_group.bar",
+			want: map[string]string{
+				"main.tf":       "resource \"aws_security_group\" \"bar\" {\n  name = \"foo\"\n}\n",
+				MOVED_FILE_NAME: "moved {\n  from = aws_security_group.old\n  to   = aws_security_group.foo\n}\n\nmoved {\n  from = aws_security_group.foo\n  to   = aws_security_group.bar\n}\n",
+			},
+		},
+		{
+			name: "formats only the renamed block",
+			contents: map[string]string{
+				"main.tf":  "resource \"aws_security_group\" \"foo\" {\n    name = \"foo\"\n}\n\nresource \"aws_vpc\" \"this\" {\n    cidr_block = \"10.0.0.0/16\"\n}\n",
+				"rules.tf": "resource \"aws_security_group_rule\" \"ingress\" {\n    security_group_id = aws_security_group.foo.id\n    type = \"ingress\"\n}\n",
+			},
+			address:    "aws_security_group.foo",
+			newAddress: "aws_security_group.bar",
+			want: map[string]string{
+				"main.tf":       "resource \"aws_security_group\" \"bar\" {\n  name = \"foo\"\n}\n\nresource \"aws_vpc\" \"this\" {\n    cidr_block = \"10.0.0.0/16\"\n}\n",
+				"rules.tf":      "resource \"aws_security_group_rule\" \"ingress\" {\n    security_group_id = aws_security_group.bar.id\n    type = \"ingress\"\n}\n",
+				MOVED_FILE_NAME: "moved {\n  from = aws_security_group.foo\n  to   = aws_security_group.bar\n}\n",
+			},
+		},
+		{
+			name: "renames a module call",
+			contents: map[string]string{
+				"main.tf": "module \"eks\" {\n  source = \"./eks\"\n}\n\noutput \"cluster\" {\n  value = module.eks.cluster_name\n}\n",
+			},
+			address:    "module.eks",
+			newAddress: "module.cluster",
+			want: map[string]string{
+				"main.tf":       "module \"cluster\" {\n  source = \"./eks\"\n}\n\noutput \"cluster\" {\n  value = module.cluster.cluster_name\n}\n",
+				MOVED_FILE_NAME: "moved {\n  from = module.eks\n  to   = module.cluster\n}\n",
+			},
+		},
+		{
+			name: "renames a data source without a moved block",
+			contents: map[string]string{
+				"main.tf": "data \"aws_caller_identity\" \"this\" {}\n\noutput \"account\" {\n  value = data.aws_caller_identity.this.account_id\n}\n",
+			},
+			address:    "data.aws_caller_identity.this",
+			newAddress: "data.aws_caller_identity.current",
+			want: map[string]string{
+				"main.tf": "data \"aws_caller_identity\" \"current\" {}\n\noutput \"account\" {\n  value = data.aws_caller_identity.current.account_id\n}\n",
+			},
+		},
+		{
+			name: "warns about references in JSON syntax files",
+			contents: map[string]string{
+				"main.tf":         sg,
+				"outputs.tf.json": `{"output": {"sg": {"value": "${aws_security_group.foo.id}"}}}`,
+			},
+			address:      "aws_security_group.foo",
+			newAddress:   "aws_security_group.bar",
+			wantWarnings: 1,
+			want: map[string]string{
+				"main.tf":         "resource \"aws_security_group\" \"bar\" {\n  name = \"foo\"\n}\n",
+				"outputs.tf.json": `{"output": {"sg": {"value": "${aws_security_group.foo.id}"}}}`,
+				MOVED_FILE_NAME:   "moved {\n  from = aws_security_group.foo\n  to   = aws_security_group.bar\n}\n",
+			},
+		},
+		{
+			name:       "fails when the new address already exists",
+			contents:   map[string]string{"main.tf": sg + "\n" + "resource \"aws_security_group\" \"bar\" {}\n"},
+			address:    "aws_security_group.foo",
+			newAddress: "aws_security_group.bar",
+			wantErr:    true,
+		},
+		{
+			name:       "fails to change the type of a resource",
+			contents:   map[string]string{"main.tf": sg},
+			address:    "aws_security_group.foo",
+			newAddress: "aws_vpc_security_group.foo",
+			wantErr:    true,
+		},
+		{
+			name:       "fails to rename a single instance",
+			contents:   map[string]string{"main.tf": sg},
+			address:    "aws_security_group.foo[0]",
+			newAddress: "aws_security_group.bar[0]",
+			wantErr:    true,
+		},
+		{
+			name:       "fails to rename a variable",
+			contents:   map[string]string{"main.tf": "variable \"region\" {}\n"},
+			address:    "var.region",
+			newAddress: "var.aws_region",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: tt.contents})
+			result, err := RenameHclBlock(&RenameOptions{Address: tt.address, NewAddress: tt.newAddress, Directory: dir})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RenameHclBlock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(result.Warnings) != tt.wantWarnings {
+				t.Errorf("RenameHclBlock() warnings = %v, want %d", result.Warnings, tt.wantWarnings)
+			}
+
+			got := map[string]string{}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				contents, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[entry.Name()] = string(contents)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RenameHclBlock() files = %q, want %q", got, tt.want)
+			}
+			block, err := os.ReadFile(result.To.Filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := string(block[result.To.Start:result.To.End]); s != tt.want["main.tf"][:len(s)] {
+				t.Errorf("RenameHclBlock() range = %q, want the renamed block", s)
+			}
+		})
+	}
+}
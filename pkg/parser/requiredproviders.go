@@ -0,0 +1,302 @@
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// the block of a terraform block that declares which providers a module needs
+	REQUIRED_PROVIDERS_BLOCK = "required_providers"
+	// the file a terraform block is created in when the destination has none
+	VERSIONS_FILE_NAME = "versions.tuf.tf"
+	// the registry that provider sources without a hostname are installed from
+	DEFAULT_PROVIDER_REGISTRY = "registry.terraform.io/"
+)
+
+// a provider a module declares in required_providers
+type providerRequirement struct {
+	// the local name of the provider (ie aws)
+	name string
+	// the source address as written; empty if the provider is implicitly from hashicorp
+	source string
+	// the version constraint; empty if the provider is not constrained
+	version string
+	// the file the requirement is declared in
+	filename string
+}
+
+// the source address a requirement installs from, normalized so that equivalent addresses compare equal
+func (r *providerRequirement) normalizedSource() string {
+	if r.source == "" {
+		return "hashicorp/" + r.name
+	}
+	return strings.TrimPrefix(strings.ToLower(r.source), DEFAULT_PROVIDER_REGISTRY)
+}
+
+// the requirement as the value of a required_providers entry
+func (r *providerRequirement) value() cty.Value {
+	attrs := map[string]cty.Value{}
+	if r.source != "" {
+		attrs["source"] = cty.StringVal(r.source)
+	}
+	if r.version != "" {
+		attrs["version"] = cty.StringVal(r.version)
+	}
+	return cty.ObjectVal(attrs)
+}
+
+// the provider requirements of a module directory, and the native syntax terraform block new requirements
+// are merged into: the one with a required_providers block if there is one, otherwise the first
+type moduleRequirements struct {
+	byName map[string]*providerRequirement
+	// the file the terraform block is in; empty if the module has no native syntax terraform block
+	filename string
+	// the index of the terraform block among the top level blocks of its file
+	index int
+	// whether the terraform block has a required_providers block, rather than needing one added
+	isRequiredProviders bool
+}
+
+// the local names of the providers a block needs to be installed: the provider it selects (or implies through
+// its resource type) for resources and data sources, and the providers passed to a module call
+func requiredProviderNames(block *hcl.Block) []string {
+	content, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: PROVIDER_ATTRIBUTE}, {Name: PROVIDERS_ATTRIBUTE}},
+	})
+	if diags.HasErrors() {
+		return nil
+	}
+
+	ret := []string{}
+	add := func(expr hcl.Expression) {
+		traversal, diags := hcl.AbsTraversalForExpr(expr)
+		if !diags.HasErrors() && !slices.Contains(ret, traversal.RootName()) {
+			ret = append(ret, traversal.RootName())
+		}
+	}
+	switch block.Type {
+	case "resource", "data":
+		if attr, ok := content.Attributes[PROVIDER_ATTRIBUTE]; ok {
+			add(attr.Expr)
+		} else if len(block.Labels) > 0 {
+			// the provider of a resource type is implied by its prefix (ie aws_iam_role is from aws)
+			name, _, _ := strings.Cut(block.Labels[0], "_")
+			ret = append(ret, name)
+		}
+	case "module":
+		if attr, ok := content.Attributes[PROVIDERS_ATTRIBUTE]; ok {
+			pairs, _ := hcl.ExprMap(attr.Expr)
+			for _, pair := range pairs {
+				add(pair.Value)
+			}
+		}
+	}
+
+	return ret
+}
+
+// reads a single required_providers entry; either an object of source and version, or a legacy version string
+func readRequirement(attr *hcl.Attribute) (*providerRequirement, error) {
+	ret := &providerRequirement{name: attr.Name, filename: attr.Range.Filename}
+	if value, diags := attr.Expr.Value(nil); !diags.HasErrors() && value.Type().IsPrimitiveType() {
+		if !value.IsNull() && value.IsKnown() {
+			ret.version = value.AsString()
+		}
+		return ret, nil
+	}
+
+	pairs, diags := hcl.ExprMap(attr.Expr)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("invalid required provider %s: %s", attr.Name, diags.Error())
+	}
+	for _, pair := range pairs {
+		key, diags := pair.Key.Value(nil)
+		if diags.HasErrors() || !key.Type().IsPrimitiveType() {
+			continue
+		}
+		var field *string
+		switch key.AsString() {
+		case "source":
+			field = &ret.source
+		case "version":
+			field = &ret.version
+		default:
+			// configuration_aliases only describe how the module is called, so they are not carried over
+			continue
+		}
+		value, diags := pair.Value.Value(nil)
+		if diags.HasErrors() || !value.Type().IsPrimitiveType() || value.IsNull() || !value.IsKnown() {
+			return nil, fmt.Errorf("invalid %s of required provider %s", key.AsString(), attr.Name)
+		}
+		*field = value.AsString()
+	}
+
+	return ret, nil
+}
+
+// reads the provider requirements of every terraform block in a module directory
+func readModuleRequirements(files fileSet, dir string) (*moduleRequirements, error) {
+	names, err := files.directoryFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &moduleRequirements{byName: map[string]*providerRequirement{}}
+	for _, name := range names {
+		cf, err := files.parse(name)
+		if err != nil {
+			return nil, err
+		}
+		for i, block := range cf.blocks {
+			if block.Type != "terraform" {
+				continue
+			}
+			if !cf.isJson && ret.filename == "" {
+				ret.filename, ret.index = name, i
+			}
+			content, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+				Blocks: []hcl.BlockHeaderSchema{{Type: REQUIRED_PROVIDERS_BLOCK}},
+			})
+			if diags.HasErrors() {
+				return nil, fmt.Errorf("failed to read terraform block in %s: %s", name, diags.Error())
+			}
+			for _, rp := range content.Blocks {
+				if !cf.isJson && !ret.isRequiredProviders {
+					ret.filename, ret.index, ret.isRequiredProviders = name, i, true
+				}
+				attrs, diags := rp.Body.JustAttributes()
+				if diags.HasErrors() {
+					return nil, fmt.Errorf("failed to read required_providers in %s: %s", name, diags.Error())
+				}
+				for _, attr := range attrs {
+					requirement, err := readRequirement(attr)
+					if err != nil {
+						return nil, fmt.Errorf("failed to read required_providers in %s: %w", name, err)
+					}
+					ret.byName[attr.Name] = requirement
+				}
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// sets a provider requirement in the required_providers block of the terraform block at the given index of
+// a file, adding a required_providers block if there is none, returning the range the requirement occupies
+func setRequirement(f *nativeFile, index int, requirement *providerRequirement) (FileRange, error) {
+	terraform, err := f.block(index)
+	if err != nil {
+		return FileRange{}, err
+	}
+	required := terraform.Body().FirstMatchingBlock(REQUIRED_PROVIDERS_BLOCK, nil)
+	if required == nil {
+		body := terraform.Body()
+		openBody(terraform)
+		if len(body.Attributes()) > 0 || len(body.Blocks()) > 0 {
+			body.AppendNewline()
+		}
+		required = body.AppendNewBlock(REQUIRED_PROVIDERS_BLOCK, nil)
+	}
+	openBody(required)
+	required.Body().SetAttributeValue(requirement.name, requirement.value())
+	if err = f.formatBlock(terraform); err != nil {
+		return FileRange{}, err
+	}
+
+	if terraform, err = f.block(index); err != nil {
+		return FileRange{}, err
+	}
+	attr := terraform.Body().FirstMatchingBlock(REQUIRED_PROVIDERS_BLOCK, nil).Body().GetAttribute(requirement.name)
+	return f.itemRange(attr.BuildTokens(nil))
+}
+
+// plans merging a provider requirement into the destination module, returning a result that copies it
+func mergeRequirement(files fileSet, dst *moduleRequirements, dstDir string, requirement *providerRequirement) (*MoveResult, error) {
+	dest, index := dst.filename, dst.index
+	if dest == "" {
+		// the destination has nowhere to put the requirement, so a terraform block is created for it
+		dest = filepath.Join(dstDir, VERSIONS_FILE_NAME)
+	}
+	before, f, err := files.native(dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open destination file %s: %w", dest, err)
+	}
+	if dst.filename == "" {
+		if _, err = f.appendBlock([]byte("terraform {\n}")); err != nil {
+			return nil, err
+		}
+		index = len(f.file.Body().Blocks()) - 1
+	}
+
+	to, err := setRequirement(f, index, requirement)
+	if err != nil {
+		return nil, err
+	}
+	return &MoveResult{
+		Copy:             true,
+		RequiredProvider: requirement.name,
+		To:               to,
+		Edits:            []*FileEdit{{Filename: dest, Before: before, After: f.bytes()}},
+	}, nil
+}
+
+// merges the required_providers entries a moved block needs from the source module into the destination module,
+// returning a result for each entry copied. Providers required from different sources or with different version
+// constraints in each module are reported as warnings on the result of the block, to be resolved by hand.
+func planRequiredProviders(files fileSet, result *MoveResult, modulePath []*ModuleCall, names []string) ([]*MoveResult, error) {
+	srcDir := filepath.Dir(result.From.Filename)
+	dstDir := filepath.Dir(result.To.Filename)
+	if len(names) == 0 || filepath.Clean(srcDir) == filepath.Clean(dstDir) {
+		return nil, nil
+	}
+	src, err := readModuleRequirements(files, srcDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read required providers of %s: %w", srcDir, err)
+	}
+	dst, err := readModuleRequirements(files, dstDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read required providers of %s: %w", dstDir, err)
+	}
+
+	ret := []*MoveResult{}
+	for _, name := range names {
+		required, inSource := src.byName[name]
+		if !inSource {
+			required = &providerRequirement{name: name}
+		}
+		existing, inDestination := dst.byName[name]
+		switch {
+		case inDestination && required.normalizedSource() != existing.normalizedSource():
+			result.Warnings = append(result.Warnings, fmt.Sprintf("provider %s used by %s is required from %s in %s but from %s in %s", name, result.Address, required.normalizedSource(), srcDir, existing.normalizedSource(), existing.filename))
+		case inDestination && inSource && required.version != existing.version:
+			result.Warnings = append(result.Warnings, fmt.Sprintf("provider %s used by %s is constrained to %q in %s but %q in %s; check that both can be satisfied", name, result.Address, required.version, required.filename, existing.version, existing.filename))
+		case inDestination, !inSource:
+			// the destination already requires it, or neither module constrains it
+		case !dst.isRequiredProviders && len(dst.byName) > 0:
+			return nil, fmt.Errorf("provider %s used by %s cannot be added to the required providers of %s, which are written in JSON syntax", name, result.Address, dstDir)
+		default:
+			merged, err := mergeRequirement(files, dst, dstDir, required)
+			if err != nil {
+				return nil, err
+			}
+			merged.Address = withModulePath(modulePath, "terraform."+REQUIRED_PROVIDERS_BLOCK+"."+name)
+			merged.From = FileRange{Filename: required.filename}
+			files.apply(merged.Edits)
+			ret = append(ret, merged)
+
+			// later requirements are merged into the block as it now is
+			if dst, err = readModuleRequirements(files, dstDir); err != nil {
+				return nil, fmt.Errorf("failed to read required providers of %s: %w", dstDir, err)
+			}
+		}
+	}
+
+	return ret, nil
+}
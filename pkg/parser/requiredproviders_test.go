@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestMoveHclBlocks_RequiredProviders(t *testing.T) {
+	role := "resource \"aws_iam_role\" \"this\" {\n  name = \"this\"\n}\n"
+	versions := "terraform {\n  required_providers {\n    aws = {\n      source  = \"hashicorp/aws\"\n      version = \">= 5.95\"\n    }\n  }\n}\n"
+	tests := []struct {
+		name         string
+		source       string
+		destination  string
+		wantResults  int
+		wantFile     string
+		wantContents string
+		wantWarnings int
+	}{
+		{
+			name:         "creates a terraform block when the destination has none",
+			source:       role + "\n" + versions,
+			destination:  "",
+			wantResults:  2,
+			wantFile:     VERSIONS_FILE_NAME,
+			wantContents: versions,
+		},
+		{
+			name:         "adds the requirement to existing required_providers",
+			source:       role + "\n" + versions,
+			destination:  "terraform {\n  required_providers {\n    tls = {\n      source = \"hashicorp/tls\"\n    }\n  }\n}\n",
+			wantResults:  2,
+			wantFile:     "main.tf",
+			wantContents: "terraform {\n  required_providers {\n    tls = {\n      source = \"hashicorp/tls\"\n    }\n    aws = {\n      source  = \"hashicorp/aws\"\n      version = \">= 5.95\"\n    }\n  }\n}\n",
+		},
+		{
+			name:         "adds required_providers to a terraform block without one",
+			source:       role + "\n" + versions,
+			destination:  "terraform {\n  required_version = \">= 1.3.2\"\n}\n",
+			wantResults:  2,
+			wantFile:     "main.tf",
+			wantContents: "terraform {\n  required_version = \">= 1.3.2\"\n\n  required_providers {\n    aws = {\n      source  = \"hashicorp/aws\"\n      version = \">= 5.95\"\n    }\n  }\n}\n",
+		},
+		{
+			name:         "warns when version constraints conflict",
+			source:       role + "\n" + versions,
+			destination:  "terraform {\n  required_providers {\n    aws = {\n      source  = \"hashicorp/aws\"\n      version = \"~> 4.0\"\n    }\n  }\n}\n",
+			wantResults:  1,
+			wantWarnings: 1,
+		},
+		{
+			name:         "warns when sources conflict",
+			source:       role,
+			destination:  "terraform {\n  required_providers {\n    aws = {\n      source = \"example/aws\"\n    }\n  }\n}\n",
+			wantResults:  1,
+			wantWarnings: 1,
+		},
+		{
+			name:         "treats registry hostnames as the same source",
+			source:       role + "\n" + versions,
+			destination:  "terraform {\n  required_providers {\n    aws = {\n      source  = \"registry.terraform.io/hashicorp/aws\"\n      version = \">= 5.95\"\n    }\n  }\n}\n",
+			wantResults:  1,
+			wantWarnings: 0,
+		},
+		{
+			name:        "requires nothing when the source does not constrain the provider",
+			source:      role,
+			destination: "",
+			wantResults: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fromFile := path.Join(t.TempDir(), "main.tf")
+			toDir := t.TempDir()
+			if err := os.WriteFile(fromFile, []byte(tt.source), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.destination != "" {
+				if err := os.WriteFile(path.Join(toDir, "main.tf"), []byte(tt.destination), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			results, err := MoveHclBlocks(&MoveOptions{
+				Address:     "aws_iam_role.*",
+				FromFile:    fromFile,
+				ToDirectory: toDir,
+			})
+			if err != nil {
+				t.Fatalf("MoveHclBlocks() error = %v", err)
+			}
+			if len(results) != tt.wantResults {
+				t.Errorf("MoveHclBlocks() = %d results, want %d", len(results), tt.wantResults)
+			}
+			if len(results[0].Warnings) != tt.wantWarnings {
+				t.Errorf("MoveHclBlocks() warnings = %v, want %d", results[0].Warnings, tt.wantWarnings)
+			}
+			if tt.wantFile == "" {
+				return
+			}
+			got, err := os.ReadFile(path.Join(toDir, tt.wantFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantContents {
+				t.Errorf("MoveHclBlocks() %s =\nSTART%sEOF, want\nSTART%sEOF", tt.wantFile, string(got), tt.wantContents)
+			}
+		})
+	}
+}
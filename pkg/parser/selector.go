@@ -0,0 +1,201 @@
+package parser
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// the characters that make an address a selector pattern rather than the address of a single block
+const SELECTOR_WILDCARDS = "*?"
+
+// selects every block matching a pattern (ie aws_iam_*.*, module.* or resource.aws_eks_node_group.*).
+// each label of the block is matched with path.Match; module paths must be written out in full
+type Selector struct {
+	// the kind of block selected: module, data, resource, var, output or local
+	kind string
+	// the patterns the labels of a selected block must match, in order
+	patterns []string
+	// the module calls leading to the module the selected blocks live in
+	modulePath []*ModuleCall
+}
+
+// a block matched by a selector
+type SelectedBlock struct {
+	// the address of the block, including its module path
+	Address string
+	// where the block (or local value) is defined; the header of a block, or the whole local value
+	Range hcl.Range
+}
+
+// whether an address is a selector pattern rather than the address of a single block
+func IsSelector(address string) bool {
+	for _, segment := range splitSegments(address) {
+		base, _, _ := strings.Cut(segment, "[")
+		if strings.ContainsAny(base, SELECTOR_WILDCARDS) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reads a label of a selector, which may contain wildcards (ie aws_iam_* or ?) but otherwise follows the
+// rules of an identifier
+func (s *addressScanner) labelPattern(what string) (string, error) {
+	start := s.pos
+	for !s.done() {
+		r, size := utf8.DecodeRuneInString(s.address[s.pos:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && !strings.ContainsRune(SELECTOR_WILDCARDS, r) {
+			break
+		}
+		s.pos += size
+	}
+	if start == s.pos {
+		return "", s.fail(s.pos, "unexpected %s, expected %s", s.next(), what)
+	}
+	if r, _ := utf8.DecodeRuneInString(s.address[start:]); unicode.IsDigit(r) || r == '-' {
+		return "", s.fail(start, "%s cannot start with %s", what, strconv.QuoteRune(r))
+	}
+
+	return s.address[start:s.pos], nil
+}
+
+// Creates a Selector from a pattern. The module path and block type are read with the address grammar, so
+// wildcards are only allowed in the labels of the selected blocks. Errors wrap *AddressError values pointing
+// at the offending character
+func NewSelector(pattern string) (*Selector, error) {
+	s := &addressScanner{address: pattern}
+	modulePath, err := s.modulePath()
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %s: %w", pattern, err)
+	}
+
+	sel := &Selector{modulePath: modulePath, patterns: []string{}}
+	first, err := s.labelPattern("a block type or resource type")
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %s: %w", pattern, err)
+	}
+	want := 1
+	switch first {
+	case ADDRESS_DATA, ADDRESS_RESOURCE:
+		sel.kind = first
+		want = 2
+	case ADDRESS_MODULE, ADDRESS_VARIABLE, ADDRESS_OUTPUT, ADDRESS_LOCAL:
+		sel.kind = first
+	default:
+		// resource selectors do not have to be prefixed
+		sel.kind = ADDRESS_RESOURCE
+		sel.patterns = append(sel.patterns, first)
+		want = 2
+	}
+	for len(sel.patterns) < want {
+		what := "a name"
+		if len(sel.patterns)+1 < want {
+			what = "a type"
+		}
+		if err = s.dot(what); err != nil {
+			return nil, fmt.Errorf("invalid selector %s: %w", pattern, err)
+		}
+		label, err := s.labelPattern(what)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %s: %w", pattern, err)
+		}
+		sel.patterns = append(sel.patterns, label)
+	}
+	if !s.done() && s.address[s.pos] == '[' {
+		return nil, fmt.Errorf("invalid selector %s: %w", pattern, s.fail(s.pos, "selectors cannot have instance keys"))
+	}
+	if !s.done() {
+		return nil, fmt.Errorf("invalid selector %s: %w", pattern, s.fail(s.pos, "unexpected %s after the end of the selector", s.next()))
+	}
+
+	return sel, nil
+}
+
+func (s *Selector) ModulePath() []*ModuleCall {
+	return s.modulePath
+}
+
+// whether every label matches the pattern in the same position
+func (s *Selector) labelsMatch(labels []string) bool {
+	if len(labels) != len(s.patterns) {
+		return false
+	}
+	for i, p := range s.patterns {
+		if ok, _ := path.Match(p, labels[i]); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// the addresses of the selected blocks in a single parsed file, in the order they are written
+func (s *Selector) selectConfig(cf *configFile) []*SelectedBlock {
+	ret := []*SelectedBlock{}
+	for _, block := range cf.blocks {
+		var address string
+		switch {
+		case s.kind == "local" && block.Type == "locals" && len(block.Labels) == 0:
+			attrs, diags := block.Body.JustAttributes()
+			if diags.HasErrors() {
+				continue
+			}
+			matched := []*hcl.Attribute{}
+			for name, attr := range attrs {
+				if ok, _ := path.Match(s.patterns[0], name); ok {
+					matched = append(matched, attr)
+				}
+			}
+			slices.SortFunc(matched, func(a, b *hcl.Attribute) int {
+				return a.Range.Start.Byte - b.Range.Start.Byte
+			})
+			for _, attr := range matched {
+				ret = append(ret, &SelectedBlock{Address: withModulePath(s.modulePath, "local."+attr.Name), Range: attr.Range})
+			}
+			continue
+		case s.kind == "module" && block.Type == "module", s.kind == "var" && block.Type == "variable", s.kind == "output" && block.Type == "output":
+			if s.labelsMatch(block.Labels) {
+				address = fmt.Sprintf("%s.%s", s.kind, block.Labels[0])
+			}
+		case s.kind == "data" && block.Type == "data":
+			if s.labelsMatch(block.Labels) {
+				address = fmt.Sprintf("data.%s.%s", block.Labels[0], block.Labels[1])
+			}
+		case s.kind == "resource" && block.Type == "resource":
+			if s.labelsMatch(block.Labels) {
+				address = fmt.Sprintf("%s.%s", block.Labels[0], block.Labels[1])
+			}
+		}
+		if address != "" {
+			ret = append(ret, &SelectedBlock{Address: withModulePath(s.modulePath, address), Range: block.DefRange})
+		}
+	}
+
+	return ret
+}
+
+// finds every block in the given files that this selector matches, in the order they are written
+func (s *Selector) Select(files []string) ([]*SelectedBlock, error) {
+	return s.selectFiles(fileSet{}, files)
+}
+
+func (s *Selector) selectFiles(files fileSet, names []string) ([]*SelectedBlock, error) {
+	ret := []*SelectedBlock{}
+	for _, fname := range names {
+		cf, err := files.parse(fname)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s.selectConfig(cf)...)
+	}
+
+	return ret, nil
+}
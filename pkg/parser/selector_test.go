@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestIsSelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    bool
+	}{
+		{name: "resource address", address: "aws_iam_role.this", want: false},
+		{name: "wildcard in a resource type", address: "aws_iam_*.*", want: true},
+		{name: "wildcard in a module name", address: "module.*", want: true},
+		{name: "wildcard inside an instance key", address: "module.node[\"*\"]", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSelector(tt.address); got != tt.want {
+				t.Errorf("IsSelector() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    *Selector
+		wantErr bool
+		// the byte offset the error points at
+		wantOffset int
+	}{
+		{
+			name:    "resource selector without a prefix",
+			pattern: "aws_iam_*.*",
+			want:    &Selector{kind: "resource", patterns: []string{"aws_iam_*", "*"}},
+			wantErr: false,
+		},
+		{
+			name:    "resource selector with a prefix",
+			pattern: "resource.aws_eks_node_group.*",
+			want:    &Selector{kind: "resource", patterns: []string{"aws_eks_node_group", "*"}},
+			wantErr: false,
+		},
+		{
+			name:    "module selector in a nested module",
+			pattern: "module.eks.module.*",
+			want:    &Selector{kind: "module", patterns: []string{"*"}, modulePath: []*ModuleCall{{Name: "eks"}}},
+			wantErr: false,
+		},
+		{
+			name:    "resource selector in a module named like a block type",
+			pattern: "module.data.aws_iam_?.*",
+			want:    &Selector{kind: "resource", patterns: []string{"aws_iam_?", "*"}, modulePath: []*ModuleCall{{Name: "data"}}},
+			wantErr: false,
+		},
+		{
+			name:       "fails with a wildcard in the module path",
+			pattern:    "module.*.aws_iam_role.*",
+			want:       nil,
+			wantErr:    true,
+			wantOffset: 7,
+		},
+		{
+			name:       "fails with too few parts",
+			pattern:    "data.*",
+			want:       nil,
+			wantErr:    true,
+			wantOffset: 6,
+		},
+		{
+			name:       "fails with too many parts",
+			pattern:    "local.a*.b",
+			want:       nil,
+			wantErr:    true,
+			wantOffset: 8,
+		},
+		{
+			name:       "fails with a malformed pattern",
+			pattern:    "aws_iam_[.*",
+			want:       nil,
+			wantErr:    true,
+			wantOffset: 8,
+		},
+		{
+			name:       "fails with an instance key",
+			pattern:    "aws_iam_role.*[0]",
+			want:       nil,
+			wantErr:    true,
+			wantOffset: 14,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSelector(tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSelector() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var addressErr *AddressError
+			if err != nil && (!errors.As(err, &addressErr) || addressErr.Offset != tt.wantOffset) {
+				t.Errorf("NewSelector() error = %v, want an address error at offset %d", err, tt.wantOffset)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewSelector() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveHclBlocks(t *testing.T) {
+	input := "resource \"aws_iam_role\" \"a\" {\n}\n\nresource \"aws_s3_bucket\" \"logs\" {\n}\n\nresource \"aws_iam_policy\" \"b\" {\n}\n"
+	fromFile := path.Join(t.TempDir(), "main.tf")
+	toDir := t.TempDir()
+	if err := os.WriteFile(fromFile, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := MoveHclBlocks(&MoveOptions{
+		Address:     "aws_iam_*.*",
+		FromFile:    fromFile,
+		ToDirectory: toDir,
+	})
+	if err != nil {
+		t.Fatalf("MoveHclBlocks() error = %v", err)
+	}
+
+	gotAddresses := []string{}
+	for _, result := range results {
+		gotAddresses = append(gotAddresses, result.Address)
+	}
+	if want := []string{"aws_iam_role.a", "aws_iam_policy.b"}; !reflect.DeepEqual(gotAddresses, want) {
+		t.Errorf("MoveHclBlocks() moved %v, want %v", gotAddresses, want)
+	}
+	gotSource, err := os.ReadFile(fromFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "resource \"aws_s3_bucket\" \"logs\" {\n}\n"; string(gotSource) != want {
+		t.Errorf("MoveHclBlocks() source file =\nSTART%sEOF, want\nSTART%sEOF", string(gotSource), want)
+	}
+	gotMoved, err := os.ReadFile(path.Join(toDir, "resources.tuf.tf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "resource \"aws_iam_role\" \"a\" {\n}\n\nresource \"aws_iam_policy\" \"b\" {\n}\n"; string(gotMoved) != want {
+		t.Errorf("MoveHclBlocks() moved file =\nSTART%sEOF, want\nSTART%sEOF", string(gotMoved), want)
+	}
+}
+
+func TestMoveHclBlocks_EmptiedFile(t *testing.T) {
+	fromDir := t.TempDir()
+	toDir := t.TempDir()
+	contents := map[string]string{
+		"iam.tf":  "resource \"aws_iam_role\" \"a\" {\n}\n",
+		"main.tf": "resource \"aws_iam_policy\" \"b\" {\n}\n",
+	}
+	for name, c := range contents {
+		if err := os.WriteFile(path.Join(fromDir, name), []byte(c), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := MoveHclBlocks(&MoveOptions{
+		Address:       "aws_iam_*.*",
+		FromDirectory: fromDir,
+		ToDirectory:   toDir,
+	})
+	if err != nil {
+		t.Fatalf("MoveHclBlocks() error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("MoveHclBlocks() moved %d block(s), want 2", len(results))
+	}
+	for name := range contents {
+		got, err := os.ReadFile(path.Join(fromDir, name))
+		if err != nil {
+			t.Fatalf("MoveHclBlocks() removed %s, want it left empty: %v", name, err)
+		}
+		if len(got) != 0 {
+			t.Errorf("MoveHclBlocks() left %s as %q, want it empty", name, got)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+locals {
+  name = "example"
+  tags = {
+    Environment = "dev"
+  }
+}
@@ -0,0 +1,255 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// the kind of operation recorded in the journal
+type OperationType string
+
+const (
+	OPERATION_INIT     OperationType = "init"
+	OPERATION_MOVE     OperationType = "move"
+	OPERATION_COPY     OperationType = "copy"
+	OPERATION_FINALIZE OperationType = "finalize"
+	OPERATION_UNDO     OperationType = "undo"
+	OPERATION_RENAME   OperationType = "rename"
+)
+
+// a range of bytes within a file, [Start, End)
+type ByteRange struct {
+	Start int `yaml:"start"`
+	End   int `yaml:"end"`
+}
+
+// A FileChange records how a single workspace file was changed by an operation
+type FileChange struct {
+	// the name of the file, relative to its workspace
+	Name string `yaml:"name"`
+	// the bytes of the file that were affected by the operation
+	Range ByteRange `yaml:"range"`
+	// md5 of the file before the operation; empty if the file did not exist
+	Md5Before string `yaml:"md5Before"`
+	// md5 of the file after the operation; empty if the file no longer exists
+	Md5After string `yaml:"md5After"`
+}
+
+// A MovedBlock is one of the blocks moved by an operation that moved several at once
+type MovedBlock struct {
+	// the address of the block in the source workspace
+	SourceAddress string `yaml:"sourceAddress"`
+	// the address of the block in the destination workspace
+	DestinationAddress string `yaml:"destinationAddress"`
+}
+
+// An Operation is a single entry in the journal of a tuf migration
+type Operation struct {
+	Id        string        `yaml:"id"`
+	Type      OperationType `yaml:"type"`
+	Timestamp time.Time     `yaml:"timestamp"`
+
+	// uuid of the workspace the operation read from
+	SourceWorkspace string `yaml:"sourceWorkspace,omitempty"`
+	// the address of the block in the source workspace
+	SourceAddress string `yaml:"sourceAddress,omitempty"`
+	// how the source file was changed
+	SourceFile *FileChange `yaml:"sourceFile,omitempty"`
+	// the other files of the source workspace the operation changed (ie the files of every block a selector moved)
+	SourceOtherFiles []*FileChange `yaml:"sourceOtherFiles,omitempty"`
+
+	// uuid of the workspace the operation wrote to
+	DestinationWorkspace string `yaml:"destinationWorkspace,omitempty"`
+	// the address of the block in the destination workspace
+	DestinationAddress string `yaml:"destinationAddress,omitempty"`
+	// how the destination file was changed
+	DestinationFile *FileChange `yaml:"destinationFile,omitempty"`
+
+	// the other files of the destination workspace the operation changed (ie the files a rename updated
+	// references in, and the file its moved block was added to)
+	OtherFiles []*FileChange `yaml:"otherFiles,omitempty"`
+
+	// every block moved by an operation that moved several at once, whose addresses are then the selector it was
+	// given; empty when the operation moved the single block its addresses name
+	Blocks []*MovedBlock `yaml:"blocks,omitempty"`
+
+	// the id of the operation that this operation reversed
+	Undoes string `yaml:"undoes,omitempty"`
+}
+
+// the operation as the moves of single blocks: a copy for each of its blocks, or the operation itself if it
+// moved a single block. The copies share the id of the operation
+func (op *Operation) Moves() []*Operation {
+	if len(op.Blocks) == 0 {
+		return []*Operation{op}
+	}
+
+	ret := []*Operation{}
+	for _, block := range op.Blocks {
+		move := *op
+		move.SourceAddress, move.DestinationAddress, move.Blocks = block.SourceAddress, block.DestinationAddress, nil
+		ret = append(ret, &move)
+	}
+	return ret
+}
+
+// whether the operation changed any file of its source workspace
+func (op *Operation) ChangesSource() bool {
+	return op.SourceFile != nil || len(op.SourceOtherFiles) > 0
+}
+
+func (op *Operation) String() string {
+	switch op.Type {
+	case OPERATION_MOVE, OPERATION_COPY, OPERATION_RENAME:
+		return fmt.Sprintf("Operation{id=%s type=%s %s:%s -> %s:%s}", op.Id, op.Type, op.SourceWorkspace, op.SourceAddress, op.DestinationWorkspace, op.DestinationAddress)
+	case OPERATION_UNDO:
+		return fmt.Sprintf("Operation{id=%s type=%s undoes=%s}", op.Id, op.Type, op.Undoes)
+	default:
+		return fmt.Sprintf("Operation{id=%s type=%s}", op.Id, op.Type)
+	}
+}
+
+// the name of a file relative to the workspace it lives in
+func (ws *Workspace) RelativeName(path string) (string, error) {
+	abspath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path for %s: %w", path, err)
+	}
+	rel, err := filepath.Rel(ws.Abspath, abspath)
+	if err != nil {
+		return "", fmt.Errorf("%s is not within workspace %s: %w", path, ws.Abspath, err)
+	}
+
+	return rel, nil
+}
+
+// the tracked md5 of a file in the workspace, or empty if the file is not tracked
+func (ws *Workspace) md5For(name string) string {
+	for _, f := range ws.Files {
+		if f.Name == name {
+			return f.Md5
+		}
+	}
+
+	return ""
+}
+
+// the workspaces touched by an operation. Finalizing may write to every workspace, so it touches all of them
+func (wsmgr *WorkspaceMgr) operationWorkspaces(op *Operation) ([]*Workspace, error) {
+	if op.Type == OPERATION_FINALIZE {
+		return wsmgr.Workspaces, nil
+	}
+	ret := []*Workspace{}
+	for _, uuid := range []string{op.SourceWorkspace, op.DestinationWorkspace} {
+		if uuid == "" {
+			continue
+		}
+		ws := wsmgr.GetWorkspaceByUuid(uuid)
+		if ws == nil {
+			return nil, fmt.Errorf("%v references untracked workspace %s", op, uuid)
+		}
+		ret = append(ret, ws)
+	}
+
+	return ret, nil
+}
+
+// Records an operation in the journal once it has been applied to disk. The tracked files of
+// every workspace it touched are refreshed and the before/after hashes of its file changes are filled in.
+// The journal is persisted immediately if this WorkspaceMgr is backed by a State.
+func (wsmgr *WorkspaceMgr) Record(op *Operation) error {
+	if op.Type == "" {
+		return errors.New("cannot record an operation without a type")
+	}
+	workspaces, err := wsmgr.operationWorkspaces(op)
+	if err != nil {
+		return err
+	}
+
+	if op.SourceFile != nil {
+		op.SourceFile.Md5Before = wsmgr.GetWorkspaceByUuid(op.SourceWorkspace).md5For(op.SourceFile.Name)
+	}
+	if op.DestinationFile != nil {
+		op.DestinationFile.Md5Before = wsmgr.GetWorkspaceByUuid(op.DestinationWorkspace).md5For(op.DestinationFile.Name)
+	}
+	for _, fc := range op.SourceOtherFiles {
+		fc.Md5Before = wsmgr.GetWorkspaceByUuid(op.SourceWorkspace).md5For(fc.Name)
+	}
+	for _, fc := range op.OtherFiles {
+		fc.Md5Before = wsmgr.GetWorkspaceByUuid(op.DestinationWorkspace).md5For(fc.Name)
+	}
+
+	for _, ws := range workspaces {
+		if err := ws.Refresh(); err != nil {
+			return fmt.Errorf("failed to refresh workspace %s: %w", ws.Uuid, err)
+		}
+	}
+
+	if op.SourceFile != nil {
+		op.SourceFile.Md5After = wsmgr.GetWorkspaceByUuid(op.SourceWorkspace).md5For(op.SourceFile.Name)
+	}
+	if op.DestinationFile != nil {
+		op.DestinationFile.Md5After = wsmgr.GetWorkspaceByUuid(op.DestinationWorkspace).md5For(op.DestinationFile.Name)
+	}
+	for _, fc := range op.SourceOtherFiles {
+		fc.Md5After = wsmgr.GetWorkspaceByUuid(op.SourceWorkspace).md5For(fc.Name)
+	}
+	for _, fc := range op.OtherFiles {
+		fc.Md5After = wsmgr.GetWorkspaceByUuid(op.DestinationWorkspace).md5For(fc.Name)
+	}
+
+	// an operation applied through a transaction already has its id, so that it is journaled once on recovery
+	if op.Id == "" {
+		op.Id = uuid.NewString()
+	}
+	op.Timestamp = time.Now().UTC()
+	if op.Type == OPERATION_FINALIZE {
+		wsmgr.Completed = true
+	}
+	if wsmgr.state == nil {
+		wsmgr.Journal = append(wsmgr.Journal, op)
+		return nil
+	}
+
+	return wsmgr.state.AppendJournal(wsmgr, op)
+}
+
+// the ids of every operation in the journal that has been undone
+func (wsmgr *WorkspaceMgr) Undone() map[string]bool {
+	undone := map[string]bool{}
+	for _, op := range wsmgr.Journal {
+		if op.Type == OPERATION_UNDO {
+			undone[op.Undoes] = true
+		}
+	}
+
+	return undone
+}
+
+// all operations of the given types in the journal that have not been undone, in the order they were recorded
+func (wsmgr *WorkspaceMgr) Operations(types ...OperationType) []*Operation {
+	undone := wsmgr.Undone()
+	ret := []*Operation{}
+	for _, op := range wsmgr.Journal {
+		if slices.Contains(types, op.Type) && !undone[op.Id] {
+			ret = append(ret, op)
+		}
+	}
+
+	return ret
+}
+
+// every move in the journal that has not been undone, as the moves of single blocks (see Operation.Moves)
+func (wsmgr *WorkspaceMgr) BlockMoves() []*Operation {
+	ret := []*Operation{}
+	for _, op := range wsmgr.Operations(OPERATION_MOVE) {
+		ret = append(ret, op.Moves()...)
+	}
+
+	return ret
+}
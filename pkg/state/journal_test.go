@@ -0,0 +1,110 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msarfaty/tuf/internal/testutils"
+)
+
+func TestWorkspaceMgr_Record(t *testing.T) {
+	type args struct {
+		op *Operation
+	}
+	tests := []struct {
+		name            string
+		args            args
+		wantSourceMd5s  [2]string
+		wantDestMd5s    [2]string
+		wantErr         bool
+		writeSource     string
+		writeDest       string
+		destWorkspaceId string
+	}{
+		{
+			name: "records hashes of the files changed by a move",
+			args: args{op: &Operation{
+				Type:            OPERATION_MOVE,
+				SourceFile:      &FileChange{Name: "main.tf"},
+				DestinationFile: &FileChange{Name: "resources.tuf.tf"},
+			}},
+			writeSource:    "",
+			writeDest:      "foo",
+			wantSourceMd5s: [2]string{"acbd18db4cc2f85cedef654fccc4a4d8", "d41d8cd98f00b204e9800998ecf8427e"},
+			wantDestMd5s:   [2]string{"", "acbd18db4cc2f85cedef654fccc4a4d8"},
+			wantErr:        false,
+		},
+		{
+			name:    "fails without an operation type",
+			args:    args{op: &Operation{}},
+			wantErr: true,
+		},
+		{
+			name: "fails when referencing an untracked workspace",
+			args: args{op: &Operation{
+				Type: OPERATION_MOVE,
+			}},
+			destWorkspaceId: "untracked",
+			wantErr:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := testutils.MakeDirectory(t, &testutils.TempDirOpts{
+				Contents: map[string]string{"main.tf": "foo"},
+			})
+			dst := testutils.MakeDirectory(t, nil)
+			wsmgr := NewWorkspaceMgr()
+			for _, ws := range []string{src, dst} {
+				if err := wsmgr.AddWorkspace(ws); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tt.args.op.SourceWorkspace = wsmgr.Workspaces[0].Uuid
+			tt.args.op.DestinationWorkspace = wsmgr.Workspaces[1].Uuid
+			if tt.destWorkspaceId != "" {
+				tt.args.op.DestinationWorkspace = tt.destWorkspaceId
+			}
+			if tt.args.op.SourceFile != nil {
+				if err := os.WriteFile(filepath.Join(src, tt.args.op.SourceFile.Name), []byte(tt.writeSource), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.args.op.DestinationFile != nil {
+				if err := os.WriteFile(filepath.Join(dst, tt.args.op.DestinationFile.Name), []byte(tt.writeDest), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := wsmgr.Record(tt.args.op)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WorkspaceMgr.Record() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				if len(wsmgr.Journal) != 0 {
+					t.Errorf("WorkspaceMgr.Record() journaled a failed operation: %v", wsmgr.Journal)
+				}
+				return
+			}
+
+			if tt.args.op.Id == "" || tt.args.op.Timestamp.IsZero() {
+				t.Errorf("WorkspaceMgr.Record() did not set an id and timestamp: %v", tt.args.op)
+			}
+			if got := [2]string{tt.args.op.SourceFile.Md5Before, tt.args.op.SourceFile.Md5After}; got != tt.wantSourceMd5s {
+				t.Errorf("WorkspaceMgr.Record() source md5s = %v, want %v", got, tt.wantSourceMd5s)
+			}
+			if got := [2]string{tt.args.op.DestinationFile.Md5Before, tt.args.op.DestinationFile.Md5After}; got != tt.wantDestMd5s {
+				t.Errorf("WorkspaceMgr.Record() destination md5s = %v, want %v", got, tt.wantDestMd5s)
+			}
+			if err := wsmgr.Validate(); err != nil {
+				t.Errorf("WorkspaceMgr.Record() did not refresh workspaces: %v", err)
+			}
+			if got := wsmgr.Operations(OPERATION_MOVE); len(got) != 1 || got[0] != tt.args.op {
+				t.Errorf("WorkspaceMgr.Operations() = %v, want [%v]", got, tt.args.op)
+			}
+		})
+	}
+}
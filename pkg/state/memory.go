@@ -0,0 +1,118 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MemoryState is a state implementation that keeps the migration in memory, for tests and
+// library users that persist migrations themselves. The migration is stored encoded, so
+// loading it always yields a copy, just as loading from disk would.
+type MemoryState struct {
+	mu        sync.Mutex
+	data      []byte
+	snapshots map[string][]byte
+	locked    bool
+}
+
+func NewMemoryState() *MemoryState {
+	return &MemoryState{snapshots: map[string][]byte{}}
+}
+
+func (ms *MemoryState) String() string {
+	return "memory"
+}
+
+// Persists a new migration, refusing to overwrite an existing one
+func (ms *MemoryState) Create(wsmgr *WorkspaceMgr) error {
+	ms.mu.Lock()
+	exists := ms.data != nil
+	ms.mu.Unlock()
+	if exists {
+		return errors.New("found existing tuf state in memory")
+	}
+
+	return ms.Save(wsmgr)
+}
+
+// Loads a copy of the migration
+func (ms *MemoryState) Load() (*WorkspaceMgr, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.data == nil {
+		return nil, errors.New("no tuf state found in memory")
+	}
+
+	return decode(ms.data)
+}
+
+// Saves the migration
+func (ms *MemoryState) Save(wsmgr *WorkspaceMgr) error {
+	data, err := encode(wsmgr)
+	if err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.data = data
+	return nil
+}
+
+// Appends an operation to the journal and saves the migration
+func (ms *MemoryState) AppendJournal(wsmgr *WorkspaceMgr, op *Operation) error {
+	wsmgr.Journal = append(wsmgr.Journal, op)
+	return ms.Save(wsmgr)
+}
+
+// Locks the migration; locking fails rather than waiting if it is already locked
+func (ms *MemoryState) Lock() (func() error, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.locked {
+		return nil, errors.New("tuf state in memory is already locked")
+	}
+	ms.locked = true
+
+	return func() error {
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		ms.locked = false
+		return nil
+	}, nil
+}
+
+// Stores a copy of a snapshot
+func (ms *MemoryState) WriteSnapshot(md5 string, contents []byte) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.snapshots[md5] = append([]byte{}, contents...)
+	return nil
+}
+
+// Reads a copy of a snapshot
+func (ms *MemoryState) ReadSnapshot(md5 string) ([]byte, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	contents, ok := ms.snapshots[md5]
+	if !ok {
+		return nil, fmt.Errorf("no snapshot found for md5 %s", md5)
+	}
+
+	return append([]byte{}, contents...), nil
+}
+
+// Transactions of a migration in memory are not journaled, since nothing is left to recover them from after a crash
+func (ms *MemoryState) TransactionJournal() string {
+	return ""
+}
+
+// Removes the migration and every snapshot
+func (ms *MemoryState) Remove() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.data = nil
+	ms.snapshots = map[string][]byte{}
+	return nil
+}
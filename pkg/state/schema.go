@@ -0,0 +1,176 @@
+package state
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// the schema version of tuf state files written by this version of tuf
+	TUF_STATE_VERSION = 4
+	// the key of the schema version in a tuf state file; files without it are version 0
+	TUF_STATE_VERSION_KEY = "version"
+)
+
+// an untyped tuf state document, as read from yaml
+type document = map[string]any
+
+// upgrades a document from one schema version to the next
+type upgrade func(doc document) error
+
+// upgrades registered by the version they upgrade from; upgrades[n] yields a version n+1 document
+var upgrades = map[int]upgrade{
+	0: upgradeV0,
+	1: upgradeV1,
+	2: upgradeV2,
+	3: upgradeV3,
+}
+
+// version 0 files predate the journal and initial files; the files tracked by a version 0 file
+// can only have been changed outside of tuf, so they are the best record of the initial files
+func upgradeV0(doc document) error {
+	if _, ok := doc["journal"]; !ok {
+		doc["journal"] = []any{}
+	}
+
+	workspaces, _ := doc["workspaces"].([]any)
+	for _, raw := range workspaces {
+		ws, ok := raw.(map[string]any)
+		if !ok {
+			return fmt.Errorf("unexpected workspace entry %v", raw)
+		}
+		if _, ok := ws["initialFiles"]; !ok {
+			ws["initialFiles"] = ws["files"]
+		}
+	}
+
+	return nil
+}
+
+// version 1 files predate tracked modules and the copy and rename operations. Their local modules depend on the
+// workspaces on disk, so they are tracked once the migration is opened rather than here
+func upgradeV1(doc document) error {
+	return nil
+}
+
+// version 2 files predate recording the terraform state file of each workspace at init. Their initial state is
+// left unknown, so aborting them leaves terraform state files alone rather than guessing whether tuf pulled them
+func upgradeV2(doc document) error {
+	return nil
+}
+
+// version 3 files predate operations that move several blocks at once, so every operation they journaled
+// already moves the single block its addresses name
+func upgradeV3(doc document) error {
+	return nil
+}
+
+// the schema version of a document
+func documentVersion(doc document) (int, error) {
+	raw, ok := doc[TUF_STATE_VERSION_KEY]
+	if !ok {
+		return 0, nil
+	}
+	version, ok := raw.(int)
+	if !ok || version < 0 {
+		return 0, fmt.Errorf("invalid schema version %v", raw)
+	}
+
+	return version, nil
+}
+
+// upgrades a tuf state document to the current schema version, returning the upgraded yaml
+func upgradeDocument(data []byte) ([]byte, error) {
+	doc := document{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("could not unmarshal tuf state from yaml: %w", err)
+	}
+	version, err := documentVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if version > TUF_STATE_VERSION {
+		return nil, fmt.Errorf("tuf state has schema version %d but this version of tuf only supports up to version %d; upgrade tuf to continue this migration", version, TUF_STATE_VERSION)
+	}
+	if version == TUF_STATE_VERSION {
+		return data, nil
+	}
+
+	for ; version < TUF_STATE_VERSION; version++ {
+		up, ok := upgrades[version]
+		if !ok {
+			return nil, fmt.Errorf("no upgrade registered for tuf state schema version %d", version)
+		}
+		if err = up(doc); err != nil {
+			return nil, fmt.Errorf("failed to upgrade tuf state from schema version %d: %w", version, err)
+		}
+		doc[TUF_STATE_VERSION_KEY] = version + 1
+	}
+
+	upgraded, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal upgraded tuf state to yaml: %w", err)
+	}
+	return upgraded, nil
+}
+
+// decodes a tuf state document of any supported schema version into a well formed WorkspaceMgr
+func decode(data []byte) (*WorkspaceMgr, error) {
+	doc := document{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("could not unmarshal tuf state from yaml: %w", err)
+	}
+	version, err := documentVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+	data, err = upgradeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	wsmgr := &WorkspaceMgr{}
+	if err = yaml.Unmarshal(data, wsmgr); err != nil {
+		return nil, fmt.Errorf("could not unmarshal tuf state from yaml: %w", err)
+	}
+	if err = wsmgr.check(); err != nil {
+		return nil, fmt.Errorf("malformed tuf state: %w", err)
+	}
+	wsmgr.untrackedModules = version < 2
+	wsmgr.unsnapshotted = version == 0
+
+	return wsmgr, nil
+}
+
+// finishes upgrading a migration loaded from an older schema version with the parts of the upgrade that depend on
+// the workspaces on disk, which cannot be made to the document alone. Initial files are only snapshotted if
+// snapshot is set, since that writes to the State
+func (wsmgr *WorkspaceMgr) upgradeWorkspaces(snapshot bool) error {
+	if wsmgr.untrackedModules {
+		for _, ws := range wsmgr.Workspaces {
+			if err := ws.trackModules(); err != nil {
+				return err
+			}
+		}
+	}
+	if wsmgr.unsnapshotted && snapshot {
+		if err := wsmgr.snapshotInitialFiles(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodes a WorkspaceMgr as a tuf state document of the current schema version
+func encode(wsmgr *WorkspaceMgr) ([]byte, error) {
+	wsmgr.Version = TUF_STATE_VERSION
+	data, err := yaml.Marshal(wsmgr)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal wsmgr to yaml: %v", err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,152 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/msarfaty/tuf/internal/testutils"
+	"gopkg.in/yaml.v3"
+)
+
+const v0State = `workspaces:
+    - guid: 5a75b6ff-599b-40c4-81fb-49f483fc7b3e
+      absolutePath: /tmp/a
+      files:
+        - name: main.tf
+          md5: acbd18db4cc2f85cedef654fccc4a4d8
+terraform:
+    statePullCommand: terraform state pull > terraform.tfstate
+    stateFileName: terraform.tfstate
+`
+
+func Test_upgradeDocument(t *testing.T) {
+	type args struct {
+		data string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *WorkspaceMgr
+		wantErr bool
+	}{
+		{
+			name: "upgrades a version 0 file",
+			args: args{data: v0State},
+			want: &WorkspaceMgr{
+				Version: TUF_STATE_VERSION,
+				Workspaces: []*Workspace{
+					{
+						Uuid:         "5a75b6ff-599b-40c4-81fb-49f483fc7b3e",
+						Abspath:      "/tmp/a",
+						Files:        []*WorkspaceFile{{Name: "main.tf", Md5: "acbd18db4cc2f85cedef654fccc4a4d8"}},
+						InitialFiles: []*WorkspaceFile{{Name: "main.tf", Md5: "acbd18db4cc2f85cedef654fccc4a4d8"}},
+					},
+				},
+				TerraformMetadata: &TerraformMetadata{
+					StatePullCommand: "terraform state pull > terraform.tfstate",
+					StateFileName:    "terraform.tfstate",
+				},
+				Journal: []*Operation{},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "leaves a current file untouched",
+			args:    args{data: "version: 4\nworkspaces: []\njournal: []\n"},
+			want:    &WorkspaceMgr{Version: 4, Workspaces: []*Workspace{}, Journal: []*Operation{}},
+			wantErr: false,
+		},
+		{
+			name:    "fails on a file from a newer version of tuf",
+			args:    args{data: "version: 1000\nworkspaces: []\n"},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "fails on an invalid version",
+			args:    args{data: "version: one\nworkspaces: []\n"},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := upgradeDocument([]byte(tt.args.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("upgradeDocument() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			got := &WorkspaceMgr{}
+			if err := yaml.Unmarshal(data, got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("upgradeDocument() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_upgrades(t *testing.T) {
+	for version := 0; version < TUF_STATE_VERSION; version++ {
+		if _, ok := upgrades[version]; !ok {
+			t.Errorf("no upgrade registered from schema version %d", version)
+		}
+	}
+}
+
+func TestOpen_Upgraded(t *testing.T) {
+	ws := testutils.MakeDirectory(t, &testutils.TempDirOpts{
+		Contents: map[string]string{"main.tf": "module \"vpc\" {\n  source = \"./vpc\"\n}\n"},
+	})
+	if err := os.Mkdir(filepath.Join(ws, "vpc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ws, "vpc", "main.tf"), []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewMemoryState()
+	s.data = []byte(fmt.Sprintf("version: 1\nworkspaces:\n  - guid: a\n    absolutePath: %s\n    files: []\n    initialFiles: []\nterraform:\n  statePullCommand: \"true\"\n  stateFileName: terraform.tfstate\njournal: []\n", ws))
+
+	wsmgr, err := Open(s)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	want := &Workspace{
+		Uuid:         "a",
+		Abspath:      ws,
+		Files:        []*WorkspaceFile{{Name: filepath.Join("vpc", "main.tf"), Md5: "acbd18db4cc2f85cedef654fccc4a4d8"}},
+		InitialFiles: []*WorkspaceFile{{Name: filepath.Join("vpc", "main.tf"), Md5: "acbd18db4cc2f85cedef654fccc4a4d8"}},
+		Modules:      []string{"vpc"},
+	}
+	if !reflect.DeepEqual(wsmgr.Workspaces, []*Workspace{want}) {
+		t.Errorf("Open() workspaces = %v, want the files of the vpc module tracked", wsmgr.Workspaces)
+	}
+}
+
+func TestRead_Unsnapshotted(t *testing.T) {
+	ws := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": "foo"}})
+	s := NewMemoryState()
+	s.data = []byte(fmt.Sprintf("workspaces:\n  - guid: a\n    absolutePath: %s\n    files:\n      - name: main.tf\n        md5: acbd18db4cc2f85cedef654fccc4a4d8\nterraform:\n  statePullCommand: \"true\"\n  stateFileName: terraform.tfstate\n", ws))
+
+	if _, err := Read(s); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(s.snapshots) != 0 {
+		t.Errorf("Read() wrote %d snapshot(s), want none", len(s.snapshots))
+	}
+
+	if _, err := Open(s); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, err := s.ReadSnapshot("acbd18db4cc2f85cedef654fccc4a4d8"); err != nil {
+		t.Errorf("Open() did not snapshot the initial files: %v", err)
+	}
+}
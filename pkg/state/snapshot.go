@@ -0,0 +1,115 @@
+package state
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/msarfaty/tuf/pkg/file"
+)
+
+// Snapshot stores the current contents of every terraform file in a workspace so that they
+// can be restored later. Snapshots are stored by md5, so unchanged files are only stored once.
+func (wsmgr *WorkspaceMgr) Snapshot(ws *Workspace) error {
+	if wsmgr.state == nil {
+		return errors.New("cannot snapshot a workspace before the tuf state is created")
+	}
+
+	for _, f := range ws.Files {
+		contents, err := os.ReadFile(filepath.Join(ws.Abspath, f.Name))
+		if err != nil {
+			return fmt.Errorf("failed to read %s for snapshot: %w", f.Name, err)
+		}
+		sum := md5.Sum(contents)
+		if err = wsmgr.state.WriteSnapshot(hex.EncodeToString(sum[:]), contents); err != nil {
+			return fmt.Errorf("failed to snapshot %s: %w", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// snapshots the initial files of every workspace that still have their initial contents. Migrations upgraded
+// from version 0 files were started before tuf kept snapshots; initial files that have since changed cannot be
+// snapshotted, so aborting reports them instead of restoring them
+func (wsmgr *WorkspaceMgr) snapshotInitialFiles() error {
+	for _, ws := range wsmgr.Workspaces {
+		for _, f := range ws.InitialFiles {
+			current, err := ws.CurrentMd5(f.Name)
+			if err != nil {
+				return fmt.Errorf("failed to hash %s in workspace %s: %w", f.Name, ws.Abspath, err)
+			}
+			if current != f.Md5 {
+				continue
+			}
+			contents, err := os.ReadFile(filepath.Join(ws.Abspath, f.Name))
+			if err != nil {
+				return fmt.Errorf("failed to read %s for snapshot: %w", f.Name, err)
+			}
+			if err = wsmgr.state.WriteSnapshot(f.Md5, contents); err != nil {
+				return fmt.Errorf("failed to snapshot %s: %w", f.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// records the terraform state file of a workspace as it is now, snapshotting it if it exists, so that the state
+// pulled for finalize can be removed or restored when the migration is aborted
+func (wsmgr *WorkspaceMgr) SnapshotStateFile(ws *Workspace) error {
+	if wsmgr.state == nil {
+		return errors.New("cannot snapshot a workspace before the tuf state is created")
+	}
+	if wsmgr.TerraformMetadata == nil || wsmgr.TerraformMetadata.StateFileName == "" {
+		return errors.New("no terraform state file name was configured")
+	}
+
+	name := wsmgr.TerraformMetadata.StateFileName
+	contents, err := os.ReadFile(filepath.Join(ws.Abspath, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		ws.InitialState = &WorkspaceFile{Name: name}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s for snapshot: %w", name, err)
+	}
+	sum := md5.Sum(contents)
+	ws.InitialState = &WorkspaceFile{Name: name, Md5: hex.EncodeToString(sum[:])}
+	if err = wsmgr.state.WriteSnapshot(ws.InitialState.Md5, contents); err != nil {
+		return fmt.Errorf("failed to snapshot %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// reads the snapshot of a file with the given md5
+func (wsmgr *WorkspaceMgr) ReadSnapshot(md5 string) ([]byte, error) {
+	if wsmgr.state == nil {
+		return nil, errors.New("cannot read a snapshot before the tuf state is created")
+	}
+
+	return wsmgr.state.ReadSnapshot(md5)
+}
+
+// Stages restoring a file in a workspace to the snapshot with the given md5 in a transaction. An empty md5
+// means the file did not exist when the snapshot was taken, so the file is removed.
+func (wsmgr *WorkspaceMgr) RestoreFile(tx *file.Transaction, ws *Workspace, name string, md5 string) error {
+	path := filepath.Join(ws.Abspath, name)
+	if md5 == "" {
+		tx.Remove(path)
+		return nil
+	}
+
+	contents, err := wsmgr.ReadSnapshot(md5)
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", path, err)
+	}
+	tx.Write(path, contents)
+
+	return nil
+}
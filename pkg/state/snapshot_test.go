@@ -0,0 +1,93 @@
+package state
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msarfaty/tuf/internal/testutils"
+)
+
+func TestWorkspaceMgr_RestoreFile(t *testing.T) {
+	type args struct {
+		name string
+		md5  string
+	}
+	tests := []struct {
+		name     string
+		args     args
+		want     string
+		wantGone bool
+		wantErr  bool
+	}{
+		{
+			name:    "restores a snapshotted file",
+			args:    args{name: "main.tf", md5: "acbd18db4cc2f85cedef654fccc4a4d8"},
+			want:    "foo",
+			wantErr: false,
+		},
+		{
+			name:     "removes a file that did not exist",
+			args:     args{name: "resources.tuf.tf", md5: ""},
+			wantGone: true,
+			wantErr:  false,
+		},
+		{
+			name:    "fails without a snapshot",
+			args:    args{name: "main.tf", md5: "d41d8cd98f00b204e9800998ecf8427e"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testutils.MakeDirectory(t, &testutils.TempDirOpts{
+				Contents: map[string]string{"main.tf": "foo"},
+			})
+			wsmgr := NewWorkspaceMgr()
+			if err := wsmgr.AddWorkspace(dir); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Create(NewMemoryState()); err != nil {
+				t.Fatal(err)
+			}
+			ws := wsmgr.Workspaces[0]
+			if err := wsmgr.Snapshot(ws); err != nil {
+				t.Fatalf("WorkspaceMgr.Snapshot() error = %v", err)
+			}
+			for _, name := range []string{"main.tf", "resources.tuf.tf"} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte("changed"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tx := wsmgr.Begin()
+			err := wsmgr.RestoreFile(tx, ws, tt.args.name, tt.args.md5)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WorkspaceMgr.RestoreFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if err = tx.Commit(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(filepath.Join(dir, tt.args.name))
+			if tt.wantGone {
+				if !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("WorkspaceMgr.RestoreFile() did not remove %s", tt.args.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("WorkspaceMgr.RestoreFile() contents = %s, want %s", string(got), tt.want)
+			}
+		})
+	}
+}
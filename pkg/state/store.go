@@ -1,32 +1,246 @@
 package state
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
 
-// A State is simply a way to track all the operations that happen during a tuf run.
-// This could be tracking how a block moves throughout workspaces, which modules exist in which directory, etc.
+	"github.com/msarfaty/tuf/pkg/file"
+)
+
+// A State is where a tuf migration is persisted between commands.
+// This covers the tracked workspaces, the journal of every operation and the file snapshots needed to reverse them.
 type State interface {
-	// Initialize a new State, which tracks the Terraform workspace(s) and how they are changed
-	Initialize() error
+	// Create persists a new migration, failing if one already exists
+	Create(wsmgr *WorkspaceMgr) error
+	// Load reads the persisted migration
+	Load() (*WorkspaceMgr, error)
+	// Save persists the migration, replacing what was persisted before
+	Save(wsmgr *WorkspaceMgr) error
+	// AppendJournal appends an operation to the journal of the migration and persists it
+	AppendJournal(wsmgr *WorkspaceMgr, op *Operation) error
+	// Lock takes exclusive use of the migration, returning a function that releases it
+	Lock() (func() error, error)
+	// WriteSnapshot stores the contents of a file by their md5
+	WriteSnapshot(md5 string, contents []byte) error
+	// ReadSnapshot reads the contents of a file stored by their md5
+	ReadSnapshot(md5 string) ([]byte, error)
+	// TransactionJournal is the file a transaction keeps its manifest in while it commits, so that one
+	// interrupted by a crash is recovered by the next command; empty if transactions cannot be recovered
+	TransactionJournal() string
+	// Remove deletes the migration and everything stored for it
+	Remove() error
+	// a description of where the migration is persisted, for messages
+	String() string
 }
 
-// DiskState is a state implementation where information is stored on disk
+const (
+	// directory next to the tuf state file that holds data tuf needs during a migration
+	TUF_DATA_DIR = ".tuf"
+	// directory within the data dir that holds file snapshots, named by their md5
+	SNAPSHOT_DIR = "snapshots"
+	// suffix of the file that marks a tuf state file as in use
+	LOCK_FILE_SUFFIX = ".lock"
+	// file within the data dir that holds the manifest of a transaction while it commits
+	TRANSACTION_FILE = "transaction.json"
+)
+
+// DiskState is a state implementation where the migration is stored in a tuf state file,
+// with any other data stored in a directory next to it
 type DiskState struct {
-	workspaces []string
-	State
+	path string
+}
+
+// Creates a DiskState backed by the tuf state file at the given path
+func NewDiskState(path string) (*DiskState, error) {
+	abspath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path for %s: %w", path, err)
+	}
+
+	return &DiskState{path: abspath}, nil
+}
+
+// Creates a DiskState backed by the tuf state file found by walking up from the given directory
+func DiscoverDiskState(dir string) (*DiskState, error) {
+	path, err := FindStateFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDiskState(path)
+}
+
+// finds the tuf state file by walking up from the given directory
+func FindStateFile(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path for %s: %w", dir, err)
+	}
+
+	for {
+		candidate := filepath.Join(dir, TUF_STATE_FILE)
+		_, err := os.Stat(candidate)
+		if err == nil {
+			return candidate, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("could not check for tuf state file %s: %w", candidate, err)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no %s found in the current directory or any parent directory; start a migration with tuf init", TUF_STATE_FILE)
+		}
+		dir = parent
+	}
+}
+
+func (ds *DiskState) String() string {
+	return ds.path
+}
+
+// the absolute path of the tuf state file
+func (ds *DiskState) Path() string {
+	return ds.path
+}
+
+// the directory that holds tuf data for this migration
+func (ds *DiskState) DataDir() string {
+	return filepath.Join(filepath.Dir(ds.path), TUF_DATA_DIR)
+}
+
+func (ds *DiskState) snapshotPath(md5 string) string {
+	return filepath.Join(ds.DataDir(), SNAPSHOT_DIR, md5)
+}
+
+func (ds *DiskState) lockPath() string {
+	return ds.path + LOCK_FILE_SUFFIX
+}
+
+// Persists a new migration, refusing to overwrite an existing tuf state file
+func (ds *DiskState) Create(wsmgr *WorkspaceMgr) error {
+	_, err := os.Stat(ds.path)
+	if err == nil {
+		return fmt.Errorf("found existing tuf state file at %s", ds.path)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not check for existing tuf state file (unexpectedly): %v", err)
+	}
+
+	return ds.Save(wsmgr)
+}
+
+// Reads the migration from the tuf state file, upgrading it to the current schema
+func (ds *DiskState) Load() (*WorkspaceMgr, error) {
+	data, err := os.ReadFile(ds.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tuf state file %s: %w", ds.path, err)
+	}
+
+	wsmgr, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tuf state file %s: %w", ds.path, err)
+	}
+
+	return wsmgr, nil
+}
+
+// Saves the migration in place
+func (ds *DiskState) Save(wsmgr *WorkspaceMgr) error {
+	data, err := encode(wsmgr)
+	if err != nil {
+		return err
+	}
+
+	// a failed write never leaves a truncated state file, and a crash after saving never loses the journal
+	if err = file.ReplaceFile(ds.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to replace tuf state file %s: %v", ds.path, err)
+	}
+
+	return nil
 }
 
-func NewDiskState(workspaces []string) *DiskState {
-	return &DiskState{workspaces: workspaces}
+// Appends an operation to the journal, saving the whole migration since it is a single file
+func (ds *DiskState) AppendJournal(wsmgr *WorkspaceMgr, op *Operation) error {
+	wsmgr.Journal = append(wsmgr.Journal, op)
+	return ds.Save(wsmgr)
 }
 
-// Initializes initial state
-func (ds *DiskState) Initialize() error {
-	seen := map[string]string{}
+// Locks the migration by creating a lock file next to the tuf state file
+func (ds *DiskState) Lock() (func() error, error) {
+	lock, err := os.OpenFile(ds.lockPath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		holder, _ := os.ReadFile(ds.lockPath())
+		return nil, fmt.Errorf("migration %s is locked by another tuf process (pid %s); remove %s if that process is no longer running", ds.path, string(holder), ds.lockPath())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock migration %s: %w", ds.path, err)
+	}
+	defer lock.Close()
 
-	for _, w := range ds.workspaces {
-		if _, ok := seen[w]; ok {
-			return fmt.Errorf("could not initialize state manager: workspace=[%s] was initialized multiple times", w)
+	if _, err = lock.WriteString(strconv.Itoa(os.Getpid())); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to lock migration %s: %w", ds.path, err), os.Remove(ds.lockPath()))
+	}
+
+	return func() error {
+		if err := os.Remove(ds.lockPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to unlock migration %s: %w", ds.path, err)
 		}
+		return nil
+	}, nil
+}
+
+// Stores a snapshot in the data dir; snapshots that already exist with the contents their md5 names are left alone.
+// Snapshots are replaced atomically, so one cut short by a crash is never left behind as if it were complete
+func (ds *DiskState) WriteSnapshot(md5 string, contents []byte) error {
+	path := ds.snapshotPath(md5)
+	existing, err := os.ReadFile(path)
+	if err == nil && file.Md5(existing) == md5 {
+		return nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not check for existing snapshot %s: %w", path, err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	if err = file.ReplaceFile(path, contents, 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Reads a snapshot from the data dir, failing if its contents do not have the md5 it is stored by
+func (ds *DiskState) ReadSnapshot(md5 string) ([]byte, error) {
+	contents, err := os.ReadFile(ds.snapshotPath(md5))
+	if err != nil {
+		return nil, fmt.Errorf("no snapshot found for md5 %s: %w", md5, err)
+	}
+	if actual := file.Md5(contents); actual != md5 {
+		return nil, fmt.Errorf("snapshot for md5 %s is corrupt; its contents have md5 %s", md5, actual)
+	}
+
+	return contents, nil
+}
+
+// Transactions are journaled in the data dir, which is removed along with the migration
+func (ds *DiskState) TransactionJournal() string {
+	return filepath.Join(ds.DataDir(), TRANSACTION_FILE)
+}
+
+// Removes the tuf state file and the data dir
+func (ds *DiskState) Remove() error {
+	if err := os.RemoveAll(ds.DataDir()); err != nil {
+		return fmt.Errorf("failed to remove tuf data directory %s: %w", ds.DataDir(), err)
+	}
+	if err := os.Remove(ds.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove tuf state file %s: %w", ds.path, err)
 	}
 
 	return nil
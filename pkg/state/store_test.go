@@ -0,0 +1,142 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/msarfaty/tuf/internal/testutils"
+)
+
+func TestState(t *testing.T) {
+	tests := []struct {
+		name     string
+		newState func(t *testing.T) State
+	}{
+		{
+			name: "disk",
+			newState: func(t *testing.T) State {
+				s, err := NewDiskState(filepath.Join(t.TempDir(), TUF_STATE_FILE))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return s
+			},
+		},
+		{
+			name: "memory",
+			newState: func(t *testing.T) State {
+				return NewMemoryState()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testutils.MakeDirectory(t, &testutils.TempDirOpts{
+				Contents: map[string]string{"main.tf": "foo"},
+			})
+			s := tt.newState(t)
+
+			if _, err := s.Load(); err == nil {
+				t.Fatal("State.Load() succeeded before a migration was created")
+			}
+
+			wsmgr := NewWorkspaceMgr()
+			if err := wsmgr.AddWorkspace(dir); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Create(s); err != nil {
+				t.Fatalf("WorkspaceMgr.Create() error = %v", err)
+			}
+			if err := NewWorkspaceMgr().Create(s); err == nil {
+				t.Error("WorkspaceMgr.Create() overwrote an existing migration")
+			}
+
+			op := &Operation{Id: "op", Type: OPERATION_INIT}
+			if err := s.AppendJournal(wsmgr, op); err != nil {
+				t.Fatalf("State.AppendJournal() error = %v", err)
+			}
+			got, err := Open(s)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, wsmgr) {
+				t.Errorf("Open() = %v, want %v", got, wsmgr)
+			}
+			if len(got.Journal) != 1 || got.Journal[0].Id != op.Id {
+				t.Errorf("Open() journal = %v, want [%v]", got.Journal, op)
+			}
+
+			unlock, err := s.Lock()
+			if err != nil {
+				t.Fatalf("State.Lock() error = %v", err)
+			}
+			if _, err = s.Lock(); err == nil {
+				t.Error("State.Lock() locked a migration twice")
+			}
+			if err = unlock(); err != nil {
+				t.Fatalf("unlock error = %v", err)
+			}
+			unlock, err = s.Lock()
+			if err != nil {
+				t.Fatalf("State.Lock() after unlocking error = %v", err)
+			}
+			if err = unlock(); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				if err = s.WriteSnapshot("acbd18db4cc2f85cedef654fccc4a4d8", []byte("foo")); err != nil {
+					t.Fatalf("State.WriteSnapshot() error = %v", err)
+				}
+			}
+			snapshot, err := s.ReadSnapshot("acbd18db4cc2f85cedef654fccc4a4d8")
+			if err != nil {
+				t.Fatalf("State.ReadSnapshot() error = %v", err)
+			}
+			if string(snapshot) != "foo" {
+				t.Errorf("State.ReadSnapshot() = %s, want foo", string(snapshot))
+			}
+
+			if err = s.Remove(); err != nil {
+				t.Fatalf("State.Remove() error = %v", err)
+			}
+			if _, err = s.Load(); err == nil {
+				t.Error("State.Load() succeeded after the migration was removed")
+			}
+			if _, err = s.ReadSnapshot("acbd18db4cc2f85cedef654fccc4a4d8"); err == nil {
+				t.Error("State.ReadSnapshot() succeeded after the migration was removed")
+			}
+		})
+	}
+}
+
+func TestDiskState_Snapshot(t *testing.T) {
+	s, err := NewDiskState(filepath.Join(t.TempDir(), TUF_STATE_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md5 := "acbd18db4cc2f85cedef654fccc4a4d8"
+	if err = os.MkdirAll(filepath.Dir(s.snapshotPath(md5)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// a snapshot cut short by a crash
+	if err = os.WriteFile(s.snapshotPath(md5), []byte("fo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.ReadSnapshot(md5); err == nil {
+		t.Error("DiskState.ReadSnapshot() read a snapshot whose contents do not match its md5")
+	}
+	if err = s.WriteSnapshot(md5, []byte("foo")); err != nil {
+		t.Fatalf("DiskState.WriteSnapshot() error = %v", err)
+	}
+	snapshot, err := s.ReadSnapshot(md5)
+	if err != nil {
+		t.Fatalf("DiskState.ReadSnapshot() error = %v", err)
+	}
+	if string(snapshot) != "foo" {
+		t.Errorf("DiskState.ReadSnapshot() = %s, want foo", string(snapshot))
+	}
+}
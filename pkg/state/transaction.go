@@ -0,0 +1,101 @@
+package state
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/msarfaty/tuf/pkg/file"
+	"gopkg.in/yaml.v3"
+)
+
+// Begins a transaction to stage the file changes of an operation in, journaled in the State of this
+// WorkspaceMgr so that it can be recovered if tuf dies while committing it
+func (wsmgr *WorkspaceMgr) Begin() *file.Transaction {
+	if wsmgr.state == nil {
+		return file.NewTransaction("")
+	}
+	return file.NewTransaction(wsmgr.state.TransactionJournal())
+}
+
+// Applies an operation whose file changes are staged in the transaction: every change is written at once and
+// then the operation is recorded. The operation is kept in the transaction journal until it is recorded, so
+// that an operation interrupted after its changes were written is recorded by Recover
+func (wsmgr *WorkspaceMgr) Apply(tx *file.Transaction, op *Operation) error {
+	if op.Id == "" {
+		op.Id = uuid.NewString()
+	}
+	data, err := yaml.Marshal(op)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %v: %w", op, err)
+	}
+	if err = tx.Commit(data); err != nil {
+		return err
+	}
+	if err = wsmgr.Record(op); err != nil {
+		return err
+	}
+
+	return tx.Close()
+}
+
+// a transaction left in the journal, either interrupted by a crash or still being committed by another tuf process
+type PendingTransaction struct {
+	// whether every change was staged, so that recovering the transaction finishes it rather than discarding it
+	Committed bool
+	// the operation the transaction applies; nil if it records none
+	Operation *Operation
+}
+
+// Finds a transaction left in the journal without recovering it, for commands that only read the migration and
+// so do not take its lock. Returns nil if there is none
+func Pending(s State) (*PendingTransaction, error) {
+	tx, err := file.ReadTransaction(s.TransactionJournal())
+	if err != nil || tx == nil {
+		return nil, err
+	}
+
+	ret := &PendingTransaction{Committed: tx.Committed}
+	if tx.Data != "" {
+		ret.Operation = &Operation{}
+		if err = yaml.Unmarshal([]byte(tx.Data), ret.Operation); err != nil {
+			return nil, fmt.Errorf("failed to read pending operation: %w", err)
+		}
+	}
+
+	return ret, nil
+}
+
+// Recovers a transaction interrupted by a crash, which must be done before the migration is loaded.
+// Changes that were not all staged are discarded; changes that were committed are finished and their operation
+// is recorded in the journal if it is not there yet. Returns the recovered operation, or nil if nothing was
+// committed
+func Recover(s State) (*Operation, error) {
+	tx, err := file.RecoverTransaction(s.TransactionJournal())
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover interrupted transaction: %w", err)
+	}
+	if tx == nil {
+		return nil, nil
+	}
+	if tx.Data == "" {
+		return nil, tx.Close()
+	}
+
+	op := &Operation{}
+	if err = yaml.Unmarshal([]byte(tx.Data), op); err != nil {
+		return nil, fmt.Errorf("failed to read interrupted operation: %w", err)
+	}
+	wsmgr, err := Open(s)
+	if err != nil {
+		return nil, err
+	}
+	recorded := slices.ContainsFunc(wsmgr.Journal, func(o *Operation) bool { return o.Id == op.Id })
+	if !recorded {
+		if err = wsmgr.Record(op); err != nil {
+			return nil, fmt.Errorf("failed to record interrupted %v: %w", op, err)
+		}
+	}
+
+	return op, tx.Close()
+}
@@ -0,0 +1,90 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msarfaty/tuf/internal/testutils"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name string
+		// whether the operation was recorded before tuf died
+		recorded bool
+	}{
+		{
+			name:     "records an operation whose changes were committed",
+			recorded: false,
+		},
+		{
+			name:     "does not record an operation twice",
+			recorded: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := testutils.MakeDirectory(t, &testutils.TempDirOpts{Contents: map[string]string{"main.tf": "foo"}})
+			s, err := NewDiskState(filepath.Join(root, TUF_STATE_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wsmgr := NewWorkspaceMgr()
+			if err = wsmgr.AddWorkspace(dir); err != nil {
+				t.Fatal(err)
+			}
+			if err = wsmgr.Create(s); err != nil {
+				t.Fatal(err)
+			}
+
+			// apply an operation, dying before the transaction is closed
+			op := &Operation{
+				Id:                   "interrupted",
+				Type:                 OPERATION_MOVE,
+				SourceWorkspace:      wsmgr.Workspaces[0].Uuid,
+				SourceFile:           &FileChange{Name: "main.tf"},
+				DestinationWorkspace: wsmgr.Workspaces[0].Uuid,
+			}
+			data, err := yaml.Marshal(op)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx := wsmgr.Begin()
+			tx.Write(filepath.Join(dir, "main.tf"), []byte("bar"))
+			if err = tx.Commit(data); err != nil {
+				t.Fatal(err)
+			}
+			if tt.recorded {
+				if err = wsmgr.Record(op); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := Recover(s)
+			if err != nil {
+				t.Fatalf("Recover() error = %v", err)
+			}
+			if got == nil || got.Id != op.Id {
+				t.Fatalf("Recover() = %v, want %v", got, op)
+			}
+			if _, err = os.Stat(s.TransactionJournal()); !os.IsNotExist(err) {
+				t.Errorf("Recover() did not remove the transaction journal")
+			}
+
+			recovered, err := Load(s)
+			if err != nil {
+				t.Fatalf("Recover() left workspaces that do not match the journal: %v", err)
+			}
+			if len(recovered.Journal) != 1 || recovered.Journal[0].Id != op.Id {
+				t.Fatalf("Recover() journal = %v, want only %v", recovered.Journal, op)
+			}
+			change := recovered.Journal[0].SourceFile
+			if change.Md5Before != "acbd18db4cc2f85cedef654fccc4a4d8" || change.Md5After != "37b51d194a7513e45b56f6524f2d51f2" {
+				t.Errorf("Recover() recorded md5s %s -> %s", change.Md5Before, change.Md5After)
+			}
+		})
+	}
+}
@@ -3,11 +3,17 @@ package state
 import (
 	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
+	"os"
 	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/msarfaty/tuf/pkg/file"
+	"github.com/msarfaty/tuf/pkg/parser"
 )
 
 type WorkspaceFile struct {
@@ -19,6 +25,13 @@ type Workspace struct {
 	Uuid    string           `yaml:"guid"`
 	Abspath string           `yaml:"absolutePath"`
 	Files   []*WorkspaceFile `yaml:"files"`
+	// the files of the workspace as they were when the migration was initialized
+	InitialFiles []*WorkspaceFile `yaml:"initialFiles"`
+	// local module directories, relative to the workspace, whose files are tracked along with the workspace's own
+	Modules []string `yaml:"modules,omitempty"`
+	// the terraform state file of the workspace as it was when the migration was initialized, with an empty md5 if
+	// it did not exist; nil for migrations initialized before state files were recorded
+	InitialState *WorkspaceFile `yaml:"initialState,omitempty"`
 }
 
 func (ws *Workspace) String() string {
@@ -38,29 +51,200 @@ func (wsf *WorkspaceFile) String() string {
 	return fmt.Sprintf("name=%s md5=%s", wsf.Name, wsf.Md5)
 }
 
+// how the terraform files of a workspace on disk compare to the files tuf tracked, by file name
+type Drift struct {
+	Unchanged []string
+	// tracked files whose contents changed
+	Modified []string
+	// files that exist on disk but are not tracked
+	Added []string
+	// tracked files that no longer exist on disk
+	Removed []string
+}
+
+// whether any file differs from what tuf tracked
+func (d *Drift) HasDrift() bool {
+	return len(d.Modified)+len(d.Added)+len(d.Removed) > 0
+}
+
+// compares the tracked files of a workspace to its current contents on disk
+func (ws *Workspace) Drift() (*Drift, error) {
+	actualMd5s, err := ws.terraformFileMd5s()
+	if err != nil {
+		return nil, fmt.Errorf("generating md5 for terraform files in %s: %w", ws.Abspath, err)
+	}
+
+	drift := &Drift{}
+	tracked := map[string]bool{}
+	for _, wsFile := range ws.Files {
+		tracked[wsFile.Name] = true
+		actual, ok := actualMd5s[path.Join(ws.Abspath, wsFile.Name)]
+		switch {
+		case !ok:
+			drift.Removed = append(drift.Removed, wsFile.Name)
+		case actual != wsFile.Md5:
+			drift.Modified = append(drift.Modified, wsFile.Name)
+		default:
+			drift.Unchanged = append(drift.Unchanged, wsFile.Name)
+		}
+	}
+	for actualPath := range actualMd5s {
+		if name := ws.fileName(actualPath); !tracked[name] {
+			drift.Added = append(drift.Added, name)
+		}
+	}
+	for _, names := range [][]string{drift.Unchanged, drift.Modified, drift.Added, drift.Removed} {
+		sort.Strings(names)
+	}
+
+	return drift, nil
+}
+
 // validates a workspace to ensure that the stored state of the workspace matches the current working state of the workspace
 func (ws *Workspace) Validate() error {
-	actualMd5s, err := md5ForTerraformFiles(ws.Abspath)
+	drift, err := ws.Drift()
 	if err != nil {
-		return fmt.Errorf("generating md5 for terraform files in %s: %w", ws.Abspath, err)
+		return err
 	}
 	errs := []error{}
 
-	for _, wsFile := range ws.Files {
-		if actualMd5s[path.Join(ws.Abspath, wsFile.Name)] != wsFile.Md5 {
-			errs = append(errs, fmt.Errorf("validation failed for %s (stored md5 %s does not match actual md5 %s)",
-				wsFile.Name,
-				wsFile.Md5,
-				actualMd5s[path.Join(ws.Abspath, wsFile.Name)]))
-		}
+	for _, name := range drift.Modified {
+		errs = append(errs, fmt.Errorf("validation failed for %s (stored md5 %s does not match actual md5)", name, ws.md5For(name)))
+	}
+	for _, name := range drift.Added {
+		errs = append(errs, fmt.Errorf("validation failed for %s (file is not tracked)", name))
 	}
-	if len(ws.Files) != len(actualMd5s) {
-		errs = append(errs, fmt.Errorf(": expected %d files but found %d", len(ws.Files), len(actualMd5s)))
+	for _, name := range drift.Removed {
+		errs = append(errs, fmt.Errorf("validation failed for %s (tracked file no longer exists)", name))
 	}
 
 	return errors.Join(errs...)
 }
 
+// the md5 of a file in the workspace as it currently exists on disk, or empty if it does not exist
+func (ws *Workspace) CurrentMd5(name string) (string, error) {
+	path := filepath.Join(ws.Abspath, name)
+	_, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+
+	md5s, err := file.GenerateMd5ForFiles([]string{path})
+	if err != nil {
+		return "", err
+	}
+	return md5s[path], nil
+}
+
+// refreshes the tracked files of a workspace from its current contents on disk
+func (ws *Workspace) Refresh() error {
+	md5s, err := ws.terraformFileMd5s()
+	if err != nil {
+		return fmt.Errorf("generating md5 for terraform files: %w", err)
+	}
+
+	ws.Files = []*WorkspaceFile{}
+	for terraformFilePath, md5 := range md5s {
+		ws.Files = append(ws.Files, &WorkspaceFile{
+			Name: ws.fileName(terraformFilePath),
+			Md5:  md5,
+		})
+	}
+	sort.Slice(ws.Files, func(i, j int) bool {
+		return ws.Files[i].Name < ws.Files[j].Name
+	})
+
+	return nil
+}
+
+// the name of a tracked file, relative to the workspace
+func (ws *Workspace) fileName(abspath string) string {
+	name, err := filepath.Rel(ws.Abspath, abspath)
+	if err != nil {
+		return filepath.Base(abspath)
+	}
+	return name
+}
+
+// whether the terraform files of a directory are tracked with this workspace
+func (ws *Workspace) TracksDirectory(dir string) bool {
+	abspath, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	if abspath == ws.Abspath {
+		return true
+	}
+	for _, module := range ws.Modules {
+		if filepath.Join(ws.Abspath, module) == abspath {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tracks the local modules of a workspace loaded from a file that predates tracked modules. Their files are
+// tracked as they are now, since tuf could not have changed them; files that were already tracked keep their
+// md5s so that drift is still reported
+func (ws *Workspace) trackModules() error {
+	if err := ws.discoverModules(); err != nil {
+		return err
+	}
+
+	for _, module := range ws.Modules {
+		md5s, err := md5ForTerraformFiles(filepath.Join(ws.Abspath, module))
+		if err != nil {
+			return fmt.Errorf("tracked module %s: %w", module, err)
+		}
+		paths := slices.Sorted(maps.Keys(md5s))
+		for _, path := range paths {
+			ws.Files = append(ws.Files, &WorkspaceFile{Name: ws.fileName(path), Md5: md5s[path]})
+			ws.InitialFiles = append(ws.InitialFiles, &WorkspaceFile{Name: ws.fileName(path), Md5: md5s[path]})
+		}
+	}
+
+	return nil
+}
+
+// finds the local modules of the workspace that can be tracked along with it; modules outside of
+// the workspace are left to the workspace that contains them
+func (ws *Workspace) discoverModules() error {
+	dirs, err := parser.LocalModuleDirectories(ws.Abspath)
+	if err != nil {
+		return fmt.Errorf("failed to find local modules of %s: %w", ws.Abspath, err)
+	}
+
+	ws.Modules = nil
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(ws.Abspath, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		ws.Modules = append(ws.Modules, rel)
+	}
+	sort.Strings(ws.Modules)
+
+	return nil
+}
+
+// generates the md5s of the terraform files of the workspace and its tracked modules, returning the mapping from abspath:md5
+func (ws *Workspace) terraformFileMd5s() (map[string]string, error) {
+	ret, err := md5ForTerraformFiles(ws.Abspath)
+	if err != nil {
+		return nil, err
+	}
+	for _, module := range ws.Modules {
+		md5s, err := md5ForTerraformFiles(filepath.Join(ws.Abspath, module))
+		if err != nil {
+			return nil, fmt.Errorf("tracked module %s: %w", module, err)
+		}
+		maps.Copy(ret, md5s)
+	}
+
+	return ret, nil
+}
+
 // finds all terraform files in a directory and generates their md5s, returning the mapping from abspath:md5
 func md5ForTerraformFiles(dir string) (map[string]string, error) {
 	absPath, err := filepath.Abs(dir)
@@ -3,21 +3,32 @@ package state
 import (
 	"errors"
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/google/uuid"
-	"gopkg.in/yaml.v3"
 )
 
 const TUF_STATE_FILE = "tuf.state"
 
 // A WorkspaceMgr keeps track of the tuf migration
 type WorkspaceMgr struct {
+	// the schema version of the tuf state file
+	Version           int                `yaml:"version"`
 	Workspaces        []*Workspace       `yaml:"workspaces"`
 	TerraformMetadata *TerraformMetadata `yaml:"terraform"`
+	// every operation that has happened during the migration, in the order it happened
+	Journal []*Operation `yaml:"journal"`
+	// whether or not the migration has been finalized
+	Completed bool `yaml:"completed"`
+
+	// where this migration is persisted
+	state State
+	// whether the migration was loaded from a file that predates tracked modules (version 1 or older)
+	untrackedModules bool
+	// whether the migration was loaded from a file that predates snapshots (version 0), so its initial files have none
+	unsnapshotted bool
 }
 
 // represents this workspacemgr as a string
@@ -47,16 +58,14 @@ func (wsmgr *WorkspaceMgr) AddWorkspace(path string) error {
 	}
 	ws.Abspath = abspath
 
-	md5s, err := md5ForTerraformFiles(ws.Abspath)
-	if err != nil {
-		return fmt.Errorf("generating md5 for terraform files: %w", err)
+	if err = ws.discoverModules(); err != nil {
+		return err
+	}
+	if err = ws.Refresh(); err != nil {
+		return err
 	}
-	ws.Files = []*WorkspaceFile{}
-	for terraformFilePath, md5 := range md5s {
-		ws.Files = append(ws.Files, &WorkspaceFile{
-			Name: filepath.Base(terraformFilePath),
-			Md5:  md5,
-		})
+	for _, f := range ws.Files {
+		ws.InitialFiles = append(ws.InitialFiles, &WorkspaceFile{Name: f.Name, Md5: f.Md5})
 	}
 
 	ws.Uuid = uuid.NewString()
@@ -78,33 +87,156 @@ func (wss *WorkspaceMgr) Validate() error {
 	return errors.Join(errs...)
 }
 
+// finds the tracked workspace with the given uuid, returning nil if there is no such workspace
+func (wsmgr *WorkspaceMgr) GetWorkspaceByUuid(uuid string) *Workspace {
+	for _, ws := range wsmgr.Workspaces {
+		if ws.Uuid == uuid {
+			return ws
+		}
+	}
+
+	return nil
+}
+
+// finds the tracked workspace at the given path, returning nil if the path is not tracked
+func (wsmgr *WorkspaceMgr) GetWorkspaceByPath(path string) (*Workspace, error) {
+	abspath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path for %s: %w", path, err)
+	}
+
+	for _, ws := range wsmgr.Workspaces {
+		if ws.Abspath == abspath {
+			return ws, nil
+		}
+	}
+
+	return nil, nil
+}
+
 // yields a new workspaces object with no workspaces
 func NewWorkspaceMgr() *WorkspaceMgr {
 	return &WorkspaceMgr{
+		Version:           TUF_STATE_VERSION,
 		Workspaces:        []*Workspace{},
 		TerraformMetadata: NewTerraformMetadata(),
+		Journal:           []*Operation{},
+	}
+}
+
+// Persist this WorkspaceMgr as a new migration in the given State, refusing to overwrite an existing migration
+func (wsmgr *WorkspaceMgr) Create(s State) error {
+	if err := s.Create(wsmgr); err != nil {
+		return err
+	}
+	wsmgr.state = s
+
+	return nil
+}
+
+// Save this WorkspaceMgr in place, updating the State it was loaded from or created in
+func (wsmgr *WorkspaceMgr) Save() error {
+	if wsmgr.state == nil {
+		return errors.New("cannot save a tuf state that was neither loaded nor created")
+	}
+
+	return wsmgr.state.Save(wsmgr)
+}
+
+// the State backing this WorkspaceMgr; nil if it was neither loaded nor created
+func (wsmgr *WorkspaceMgr) State() State {
+	return wsmgr.state
+}
+
+// checks that a loaded WorkspaceMgr is well formed
+func (wsmgr *WorkspaceMgr) check() error {
+	if len(wsmgr.Workspaces) == 0 {
+		return errors.New("no workspaces are tracked")
+	}
+	if wsmgr.TerraformMetadata == nil {
+		return errors.New("missing terraform metadata")
+	}
+
+	errs := []error{}
+	uuids := map[string]bool{}
+	abspaths := map[string]bool{}
+	for _, ws := range wsmgr.Workspaces {
+		if ws.Uuid == "" {
+			errs = append(errs, fmt.Errorf("workspace %s is missing a uuid", ws.Abspath))
+		}
+		if !filepath.IsAbs(ws.Abspath) {
+			errs = append(errs, fmt.Errorf("workspace %s does not have an absolute path", ws.Uuid))
+		}
+		if uuids[ws.Uuid] {
+			errs = append(errs, fmt.Errorf("workspace uuid %s is tracked multiple times", ws.Uuid))
+		}
+		if abspaths[ws.Abspath] {
+			errs = append(errs, fmt.Errorf("workspace %s is tracked multiple times", ws.Abspath))
+		}
+		uuids[ws.Uuid] = true
+		abspaths[ws.Abspath] = true
+	}
+
+	for _, op := range wsmgr.Journal {
+		if _, err := wsmgr.operationWorkspaces(op); err != nil {
+			errs = append(errs, err)
+		}
 	}
+
+	return errors.Join(errs...)
+}
+
+// Discover the State of the in-flight migration by finding the tuf state file from the current directory
+func Discover() (State, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	return DiscoverDiskState(cwd)
 }
 
-// Write the state of this WorkspaceMgr to disk
-func (wsmgr *WorkspaceMgr) WriteToDisk() error {
-	_, err := os.Stat(TUF_STATE_FILE)
-	if err == nil {
-		return fmt.Errorf("found existing tuf state file at %s", TUF_STATE_FILE)
+// Open the migration persisted in the given State, without checking that the tracked
+// workspaces still match what was recorded
+func Open(s State) (*WorkspaceMgr, error) {
+	wsmgr, err := s.Load()
+	if err != nil {
+		return nil, err
 	}
-	if !errors.Is(err, fs.ErrNotExist) {
-		return fmt.Errorf("could not check for existing tuf state file (unexpectedly): %v", err)
+	wsmgr.state = s
+	if err = wsmgr.upgradeWorkspaces(true); err != nil {
+		return nil, fmt.Errorf("failed to upgrade tuf state: %w", err)
 	}
 
-	data, err := yaml.Marshal(wsmgr)
+	return wsmgr, nil
+}
+
+// Read the migration persisted in the given State without writing anything, for commands that only show it. A
+// migration from an older schema version is upgraded in memory, but its initial files are left to be snapshotted
+// by the next command that opens it
+func Read(s State) (*WorkspaceMgr, error) {
+	wsmgr, err := s.Load()
 	if err != nil {
-		return fmt.Errorf("could not marshal wsmgr to yaml: %v", err)
+		return nil, err
+	}
+	wsmgr.state = s
+	if err = wsmgr.upgradeWorkspaces(false); err != nil {
+		return nil, fmt.Errorf("failed to upgrade tuf state: %w", err)
 	}
 
-	err = os.WriteFile(TUF_STATE_FILE, data, 0644)
+	return wsmgr, nil
+}
+
+// Load the migration persisted in the given State, ensuring that every tracked workspace
+// still matches what was recorded
+func Load(s State) (*WorkspaceMgr, error) {
+	wsmgr, err := Open(s)
 	if err != nil {
-		return fmt.Errorf("failed to write tuf state to file: %v", err)
+		return nil, err
+	}
+	if err = wsmgr.Validate(); err != nil {
+		return nil, fmt.Errorf("tracked workspaces have changed outside of tuf: %w", err)
 	}
 
-	return nil
+	return wsmgr, nil
 }
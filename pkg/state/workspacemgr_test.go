@@ -1,6 +1,8 @@
 package state
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"testing"
@@ -89,6 +91,11 @@ func TestWorkspaceMgr_AddWorkspace(t *testing.T) {
 				sort.Slice(gotWs.Files, func(i, j int) bool {
 					return gotWs.Files[i].Name < gotWs.Files[j].Name
 				})
+				// the initial files are exactly the files found when the workspace was added
+				if !reflect.DeepEqual(gotWs.InitialFiles, gotWs.Files) {
+					t.Errorf("WorkspaceMgr.AddWorkspace() initial files = %v; want %v", gotWs.InitialFiles, gotWs.Files)
+				}
+				gotWs.InitialFiles = nil
 
 				if !reflect.DeepEqual(wantWs, gotWs) {
 					t.Errorf("WorkspaceMgr.AddWorkspace() want = %v; got = %v", wantWs, gotWs)
@@ -97,3 +104,133 @@ func TestWorkspaceMgr_AddWorkspace(t *testing.T) {
 		})
 	}
 }
+
+func TestFindStateFile(t *testing.T) {
+	root := testutils.MakeDirectory(t, &testutils.TempDirOpts{
+		Contents: map[string]string{TUF_STATE_FILE: ""},
+	})
+	nested := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "finds the state file in the given directory",
+			dir:     root,
+			want:    filepath.Join(root, TUF_STATE_FILE),
+			wantErr: false,
+		},
+		{
+			name:    "finds the state file in a parent directory",
+			dir:     nested,
+			want:    filepath.Join(root, TUF_STATE_FILE),
+			wantErr: false,
+		},
+		{
+			name:    "fails when no state file exists",
+			dir:     t.TempDir(),
+			want:    "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FindStateFile(tt.dir)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FindStateFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("FindStateFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutator func(t *testing.T, wsmgr *WorkspaceMgr)
+		wantErr bool
+	}{
+		{
+			name:    "loads an unchanged migration",
+			mutator: func(t *testing.T, wsmgr *WorkspaceMgr) {},
+			wantErr: false,
+		},
+		{
+			name: "loads a migration after saving in place",
+			mutator: func(t *testing.T, wsmgr *WorkspaceMgr) {
+				ws := wsmgr.Workspaces[0]
+				if err := os.WriteFile(filepath.Join(ws.Abspath, "main.tf"), []byte("changed"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := ws.Refresh(); err != nil {
+					t.Fatal(err)
+				}
+				if err := wsmgr.Save(); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: false,
+		},
+		{
+			name: "fails when a workspace drifts",
+			mutator: func(t *testing.T, wsmgr *WorkspaceMgr) {
+				ws := wsmgr.Workspaces[0]
+				if err := os.WriteFile(filepath.Join(ws.Abspath, "main.tf"), []byte("changed"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "fails when the state file is malformed",
+			mutator: func(t *testing.T, wsmgr *WorkspaceMgr) {
+				wsmgr.Workspaces = append(wsmgr.Workspaces, wsmgr.Workspaces[0])
+				if err := wsmgr.Save(); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := testutils.MakeDirectory(t, &testutils.TempDirOpts{
+				Contents: map[string]string{"main.tf": "foo"},
+			})
+			s, err := NewDiskState(filepath.Join(t.TempDir(), TUF_STATE_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wsmgr := NewWorkspaceMgr()
+			if err := wsmgr.AddWorkspace(ws); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Create(s); err != nil {
+				t.Fatal(err)
+			}
+			if err := wsmgr.Create(s); err == nil {
+				t.Fatal("WorkspaceMgr.Create() overwrote an existing migration")
+			}
+			tt.mutator(t, wsmgr)
+
+			got, err := Load(s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(got, wsmgr) {
+				t.Errorf("Load() = %v, want %v", got, wsmgr)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package tfstate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// builds the import id of an instance from its attributes, returning false if the attributes it needs are missing
+type importId func(attributes map[string]any) (string, bool)
+
+// resource types whose import id is not their id attribute, by how the import id is built. Every other type is
+// imported by its id attribute, which is right for most resource types but not all of them
+var importIds = map[string]importId{
+	"aws_autoscaling_schedule":        joinAttributes("/", "autoscaling_group_name", "scheduled_action_name"),
+	"aws_iam_group_policy_attachment": joinAttributes("/", "group", "policy_arn"),
+	"aws_iam_role_policy_attachment":  joinAttributes("/", "role", "policy_arn"),
+	"aws_iam_user_policy_attachment":  joinAttributes("/", "user", "policy_arn"),
+	"aws_network_acl_rule":            joinAttributes(":", "network_acl_id", "rule_number", "protocol", "egress"),
+	"aws_route":                       joinAttributes("_", "route_table_id", "destination_cidr_block|destination_ipv6_cidr_block|destination_prefix_list_id"),
+	"aws_route_table_association":     joinAttributes("/", "subnet_id|gateway_id", "route_table_id"),
+	"aws_security_group_rule":         securityGroupRuleId,
+}
+
+// the value of an attribute as it is written in an import id; empty if it is unset
+func attributeString(attributes map[string]any, name string) string {
+	switch v := attributes[name].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
+
+// an import id made of attributes joined by a separator. Attributes separated by | are alternatives, of which the
+// first that is set is used (ie subnet_id|gateway_id)
+func joinAttributes(separator string, names ...string) importId {
+	return func(attributes map[string]any) (string, bool) {
+		parts := []string{}
+		for _, name := range names {
+			part := ""
+			for _, alternative := range strings.Split(name, "|") {
+				if part = attributeString(attributes, alternative); part != "" {
+					break
+				}
+			}
+			if part == "" {
+				return "", false
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, separator), true
+	}
+}
+
+// security group rules are imported by the group, type, protocol and ports of the rule followed by each of its
+// sources (ie sg-123_ingress_tcp_443_443_10.0.0.0/16_sg-456)
+func securityGroupRuleId(attributes map[string]any) (string, bool) {
+	id, ok := joinAttributes("_", "security_group_id", "type", "protocol", "from_port", "to_port")(attributes)
+	if !ok {
+		return "", false
+	}
+	sources := []string{}
+	for _, name := range []string{"cidr_blocks", "ipv6_cidr_blocks", "prefix_list_ids"} {
+		values, _ := attributes[name].([]any)
+		for _, value := range values {
+			sources = append(sources, fmt.Sprint(value))
+		}
+	}
+	if self, _ := attributes["self"].(bool); self {
+		sources = append(sources, "self")
+	}
+	if group := attributeString(attributes, "source_security_group_id"); group != "" {
+		sources = append(sources, group)
+	}
+	if len(sources) == 0 {
+		return "", false
+	}
+
+	return id + "_" + strings.Join(sources, "_"), true
+}
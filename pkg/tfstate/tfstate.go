@@ -0,0 +1,480 @@
+package tfstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/msarfaty/tuf/pkg/parser"
+)
+
+const (
+	MODE_MANAGED = "managed"
+	MODE_DATA    = "data"
+
+	MODULE_PREFIX = "module."
+	// the start of the provider configuration in the provider address of a resource (ie provider["registry.terraform.io/hashicorp/aws"])
+	PROVIDER_PREFIX = "provider["
+)
+
+// A terraform state file, as produced by `terraform state pull`
+// fields that tuf does not need to understand are carried through untouched
+type State struct {
+	Version          int             `json:"version"`
+	TerraformVersion string          `json:"terraform_version"`
+	Serial           int64           `json:"serial"`
+	Lineage          string          `json:"lineage"`
+	Outputs          json.RawMessage `json:"outputs,omitempty"`
+	Resources        []*Resource     `json:"resources"`
+	CheckResults     json.RawMessage `json:"check_results,omitempty"`
+}
+
+// A resource in a terraform state file; each resource may have many instances (count/for_each)
+type Resource struct {
+	Module    string          `json:"module,omitempty"`
+	Mode      string          `json:"mode"`
+	Type      string          `json:"type"`
+	Name      string          `json:"name"`
+	Each      string          `json:"each,omitempty"`
+	Provider  string          `json:"provider"`
+	Instances json.RawMessage `json:"instances"`
+}
+
+// the address of the resource without any instance keys (ie module.foo.aws_iam_role.bar)
+func (r *Resource) Address() string {
+	var sb strings.Builder
+	if r.Module != "" {
+		sb.WriteString(r.Module)
+		sb.WriteString(".")
+	}
+	if r.Mode == MODE_DATA {
+		sb.WriteString("data.")
+	}
+	sb.WriteString(fmt.Sprintf("%s.%s", r.Type, r.Name))
+	return sb.String()
+}
+
+// Reads a terraform state file from disk
+func Read(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terraform state %s: %w", path, err)
+	}
+
+	s := &State{}
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal terraform state %s: %w", path, err)
+	}
+	if s.Version != 4 {
+		return nil, fmt.Errorf("unsupported terraform state version %d in %s (only version 4 is supported)", s.Version, path)
+	}
+
+	return s, nil
+}
+
+// the contents of this terraform state as a state file
+func (s *State) Bytes() ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal terraform state: %w", err)
+	}
+
+	return append(data, '\n'), nil
+}
+
+// the module prefix of a module address that the resources of the module (and its children) are under
+// ie module.foo matches resources in module.foo, module.foo[0] and module.foo.module.bar
+func moduleMatches(module string, address string) bool {
+	if module == address {
+		return true
+	}
+	rest, ok := strings.CutPrefix(module, address)
+	return ok && (strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "["))
+}
+
+// splits the instance key (ie [0] or ["blue"]) off the end of an address; invalid addresses
+// are returned whole so that they never match a resource
+func splitInstanceKey(address string) (string, string) {
+	base, key, err := parser.SplitInstanceKey(address)
+	if err != nil {
+		return address, ""
+	}
+	return base, key
+}
+
+// whether an address is a module call (ie module.foo or module.foo.module.bar["blue"]) rather than a resource
+func isModuleAddress(address string) bool {
+	_, rest, err := parser.SplitModulePath(address)
+	return err == nil && strings.HasPrefix(rest, MODULE_PREFIX)
+}
+
+// the value of an instance key as it is stored in the index_key of a resource instance
+func indexKey(key string) (any, error) {
+	var ret any
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(strings.TrimPrefix(key, "["), "]")), &ret); err != nil {
+		return nil, fmt.Errorf("invalid instance key %s: %w", key, err)
+	}
+	return ret, nil
+}
+
+// the instances of a resource, with the fields tuf does not need to understand left untouched
+func (r *Resource) instances() ([]map[string]json.RawMessage, error) {
+	ret := []map[string]json.RawMessage{}
+	if len(r.Instances) == 0 {
+		return ret, nil
+	}
+	if err := json.Unmarshal(r.Instances, &ret); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal instances of %s: %w", r.Address(), err)
+	}
+	return ret, nil
+}
+
+// the index key of a resource instance; nil if the resource has neither count nor for_each
+func instanceIndexKey(instance map[string]json.RawMessage) (any, error) {
+	raw, ok := instance["index_key"]
+	if !ok {
+		return nil, nil
+	}
+	var ret any
+	if err := json.Unmarshal(raw, &ret); err != nil {
+		return nil, fmt.Errorf("invalid index_key %s: %w", string(raw), err)
+	}
+	return ret, nil
+}
+
+// determines if a resource in state is described by a tuf address, ignoring any resource instance key
+func resourceMatches(r *Resource, address string) bool {
+	if isModuleAddress(address) {
+		return moduleMatches(r.Module, address)
+	}
+	base, _ := splitInstanceKey(address)
+	return r.Address() == base
+}
+
+// rewrites the resource so that it lives at the new address
+func renameResource(r *Resource, from string, to string) error {
+	if from == to {
+		return nil
+	}
+
+	if isModuleAddress(from) {
+		r.Module = to + strings.TrimPrefix(r.Module, from)
+		// provider configurations of the module move with it
+		if strings.HasPrefix(r.Provider, from+".") {
+			r.Provider = to + strings.TrimPrefix(r.Provider, from)
+		}
+		return nil
+	}
+
+	path, rest, err := parser.SplitModulePath(to)
+	if err != nil {
+		return fmt.Errorf("cannot rename resource %s to invalid address %s: %w", from, to, err)
+	}
+	base, toKey := splitInstanceKey(rest)
+	if _, fromKey := splitInstanceKey(from); fromKey != toKey {
+		return fmt.Errorf("cannot move %s to %s; changing instance keys is not supported", from, to)
+	}
+
+	parts := strings.Split(base, ".")
+	mode := MODE_MANAGED
+	if parts[0] == MODE_DATA {
+		mode = MODE_DATA
+		parts = parts[1:]
+	}
+	if len(parts) != 2 || mode != r.Mode {
+		return fmt.Errorf("cannot rename resource %s to unsupported address %s", from, to)
+	}
+	// the module path of the destination replaces that of the source, so resources can move between modules
+	r.Module = parser.ModulePathString(path)
+	r.Type = parts[0]
+	r.Name = parts[1]
+	r.Provider = rebasedProvider(r.Provider, path)
+
+	return nil
+}
+
+// the provider configuration of a resource moved into a module. A configuration of one of the modules around the
+// destination may still be passed into it and is kept; any other is replaced by the configuration of the same provider
+// and alias in the destination module, which the moved block uses instead
+func rebasedProvider(provider string, path []*parser.ModuleCall) string {
+	i := strings.Index(provider, PROVIDER_PREFIX)
+	if i < 0 {
+		return provider
+	}
+	// provider configurations are addressed by module path without instance keys
+	calls := []*parser.ModuleCall{}
+	for _, mc := range path {
+		calls = append(calls, &parser.ModuleCall{Name: mc.Name})
+	}
+	module := parser.ModulePathString(calls)
+	providerModule := strings.TrimSuffix(provider[:i], ".")
+	if providerModule == "" || providerModule == module || strings.HasPrefix(module, providerModule+".") {
+		return provider
+	}
+	if module == "" {
+		return provider[i:]
+	}
+	return module + "." + provider[i:]
+}
+
+// splits the instance with the given key out of a resource, returning a copy of the resource that
+// holds only that instance; the original resource keeps the rest. nil is returned if there is no such instance
+func (r *Resource) removeInstance(key string) (*Resource, error) {
+	want, err := indexKey(key)
+	if err != nil {
+		return nil, err
+	}
+	instances, err := r.instances()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []map[string]json.RawMessage{}
+	kept := []map[string]json.RawMessage{}
+	for _, instance := range instances {
+		got, err := instanceIndexKey(instance)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read instance of %s: %w", r.Address(), err)
+		}
+		if reflect.DeepEqual(got, want) {
+			matched = append(matched, instance)
+		} else {
+			kept = append(kept, instance)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil
+	}
+
+	removed := *r
+	if removed.Instances, err = json.Marshal(matched); err != nil {
+		return nil, fmt.Errorf("failed to marshal instances of %s: %w", r.Address(), err)
+	}
+	if r.Instances, err = json.Marshal(kept); err != nil {
+		return nil, fmt.Errorf("failed to marshal instances of %s: %w", r.Address(), err)
+	}
+	return &removed, nil
+}
+
+// Removes all of the resources described by an address from this state and returns them.
+// An address with a resource instance key (ie aws_iam_role.this[0]) removes only that instance,
+// returned as a resource holding just the one instance.
+func (s *State) Remove(address string) ([]*Resource, error) {
+	_, key := splitInstanceKey(address)
+	removed := []*Resource{}
+	kept := []*Resource{}
+	for _, r := range s.Resources {
+		switch {
+		case !resourceMatches(r, address):
+			kept = append(kept, r)
+		case key == "" || isModuleAddress(address):
+			removed = append(removed, r)
+		default:
+			instance, err := r.removeInstance(key)
+			if err != nil {
+				return nil, err
+			}
+			if instance != nil {
+				removed = append(removed, instance)
+			}
+			if instances, err := r.instances(); err != nil || len(instances) > 0 {
+				kept = append(kept, r)
+			}
+		}
+	}
+	s.Resources = kept
+
+	return removed, nil
+}
+
+// Adds resources to this state, failing if any of them already exist
+func (s *State) Add(resources []*Resource) error {
+	existing := map[string]bool{}
+	for _, r := range s.Resources {
+		existing[r.Address()] = true
+	}
+
+	for _, r := range resources {
+		if existing[r.Address()] {
+			return fmt.Errorf("resource %s already exists in state", r.Address())
+		}
+	}
+	s.Resources = append(s.Resources, resources...)
+
+	return nil
+}
+
+// Adds resource instances to this state, merging them into resources that already exist.
+// Fails if any of the instances already exist.
+func (s *State) AddInstances(resources []*Resource) error {
+	existing := map[string]*Resource{}
+	for _, r := range s.Resources {
+		existing[r.Address()] = r
+	}
+
+	// check every instance before changing anything so that a failure leaves the state untouched
+	merged := map[*Resource]json.RawMessage{}
+	for _, r := range resources {
+		into, ok := existing[r.Address()]
+		if !ok {
+			continue
+		}
+		current, err := into.instances()
+		if err != nil {
+			return err
+		}
+		added, err := r.instances()
+		if err != nil {
+			return err
+		}
+		for _, instance := range added {
+			key, err := instanceIndexKey(instance)
+			if err != nil {
+				return err
+			}
+			for _, c := range current {
+				if other, err := instanceIndexKey(c); err != nil || reflect.DeepEqual(key, other) {
+					return fmt.Errorf("instance %v of resource %s already exists in state", key, r.Address())
+				}
+			}
+			current = append(current, instance)
+		}
+		if merged[into], err = json.Marshal(current); err != nil {
+			return fmt.Errorf("failed to marshal instances of %s: %w", r.Address(), err)
+		}
+	}
+
+	for _, r := range resources {
+		if _, ok := existing[r.Address()]; !ok {
+			s.Resources = append(s.Resources, r)
+		}
+	}
+	for r, instances := range merged {
+		r.Instances = instances
+	}
+
+	return nil
+}
+
+// an instance of a managed resource and the id terraform can import it by
+type ImportTarget struct {
+	// the address of the instance, including its instance key (ie aws_iam_role.this["blue"])
+	Address string
+	// the id to import the instance by
+	Id string
+	// whether the id is built the way the resource type is known to be imported; otherwise it is the id attribute
+	// of the instance, which is how most but not all resource types are imported
+	Known bool
+}
+
+// the instance key of an index key as it is written in an address (ie [0] or ["blue"])
+func instanceKey(key any) (string, error) {
+	switch k := key.(type) {
+	case nil:
+		return "", nil
+	case float64:
+		return fmt.Sprintf("[%d]", int64(k)), nil
+	case string:
+		quoted, err := json.Marshal(k)
+		return fmt.Sprintf("[%s]", quoted), err
+	default:
+		return "", fmt.Errorf("unsupported index key %v", key)
+	}
+}
+
+// the import target of every instance of a managed resource, addressed as the resource is now. The id of each
+// instance is built as its resource type is known to be imported (see importIds), or else read from its id attribute
+func (r *Resource) ImportTargets() ([]*ImportTarget, error) {
+	if r.Mode != MODE_MANAGED {
+		return nil, fmt.Errorf("cannot import %s; only managed resources can be imported", r.Address())
+	}
+	instances, err := r.instances()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*ImportTarget{}
+	for _, instance := range instances {
+		index, err := instanceIndexKey(instance)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read instance of %s: %w", r.Address(), err)
+		}
+		key, err := instanceKey(index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read instance of %s: %w", r.Address(), err)
+		}
+		attributes := map[string]any{}
+		if raw, ok := instance["attributes"]; ok {
+			if err := json.Unmarshal(raw, &attributes); err != nil {
+				return nil, fmt.Errorf("failed to read attributes of %s%s: %w", r.Address(), key, err)
+			}
+		}
+		if build, ok := importIds[r.Type]; ok {
+			if id, ok := build(attributes); ok {
+				ret = append(ret, &ImportTarget{Address: r.Address() + key, Id: id, Known: true})
+				continue
+			}
+		}
+		id, _ := attributes["id"].(string)
+		if id == "" {
+			return nil, fmt.Errorf("instance %s%s has no id to import it by", r.Address(), key)
+		}
+		ret = append(ret, &ImportTarget{Address: r.Address() + key, Id: id})
+	}
+
+	return ret, nil
+}
+
+// Moves the resources described by an address from one state to another, returning the
+// moved resources as they exist in the destination state
+func MoveResources(from *State, fromAddress string, to *State, toAddress string) ([]*Resource, error) {
+	resources, err := from.Remove(fromAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move %s: %w", fromAddress, err)
+	}
+	for _, r := range resources {
+		if err := renameResource(r, fromAddress, toAddress); err != nil {
+			return nil, err
+		}
+	}
+
+	add := to.Add
+	if isInstanceMove(toAddress) {
+		// other instances of the resource may already have been moved to the destination
+		add = to.AddInstances
+	}
+	if err := add(resources); err != nil {
+		return nil, fmt.Errorf("failed to move %s: %w", fromAddress, err)
+	}
+
+	return resources, nil
+}
+
+// whether an address moves a single instance of a resource rather than the whole resource or module
+func isInstanceMove(address string) bool {
+	_, key := splitInstanceKey(address)
+	return key != "" && !isModuleAddress(address)
+}
+
+// Moves the resources described by an address from one state to another, returning the
+// addresses of all moved resources as they exist in the destination state
+func Move(from *State, fromAddress string, to *State, toAddress string) ([]string, error) {
+	resources, err := MoveResources(from, fromAddress, to, toAddress)
+	if err != nil {
+		return nil, err
+	}
+	_, key := splitInstanceKey(toAddress)
+
+	moved := []string{}
+	for _, r := range resources {
+		if isInstanceMove(toAddress) {
+			moved = append(moved, r.Address()+key)
+		} else {
+			moved = append(moved, r.Address())
+		}
+	}
+
+	return moved, nil
+}
@@ -0,0 +1,429 @@
+package tfstate
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testResources() []*Resource {
+	return []*Resource{
+		{Mode: MODE_MANAGED, Type: "aws_iam_role", Name: "foo", Instances: json.RawMessage("[]")},
+		{Mode: MODE_DATA, Type: "aws_iam_role", Name: "foo", Instances: json.RawMessage("[]")},
+		{Module: "module.eks", Mode: MODE_MANAGED, Type: "aws_eks_cluster", Name: "this", Instances: json.RawMessage("[]")},
+		{Module: "module.eks.module.karpenter", Mode: MODE_MANAGED, Type: "aws_iam_role", Name: "this", Instances: json.RawMessage("[]")},
+		{Module: "module.eks_extra", Mode: MODE_MANAGED, Type: "aws_iam_role", Name: "this", Instances: json.RawMessage("[]")},
+		{Module: "module.node[\"blue\"]", Mode: MODE_MANAGED, Type: "aws_iam_role", Name: "this", Instances: json.RawMessage("[]")},
+		{Mode: MODE_MANAGED, Type: "aws_iam_role", Name: "counted", Each: "list", Instances: json.RawMessage(`[{"index_key":0},{"index_key":1}]`)},
+		{Mode: MODE_MANAGED, Type: "aws_iam_role", Name: "each", Each: "map", Instances: json.RawMessage(`[{"index_key":"blue"}]`)},
+	}
+}
+
+// the index keys of every instance of a resource
+func indexKeys(t *testing.T, r *Resource) []any {
+	instances, err := r.instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := []any{}
+	for _, instance := range instances {
+		key, err := instanceIndexKey(instance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret = append(ret, key)
+	}
+	return ret
+}
+
+func addresses(resources []*Resource) []string {
+	ret := []string{}
+	for _, r := range resources {
+		ret = append(ret, r.Address())
+	}
+	return ret
+}
+
+func TestState_Remove(t *testing.T) {
+	type args struct {
+		address string
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			name: "removes a single managed resource",
+			args: args{address: "aws_iam_role.foo"},
+			want: []string{"aws_iam_role.foo"},
+		},
+		{
+			name: "removes a module and its children",
+			args: args{address: "module.eks"},
+			want: []string{"module.eks.aws_eks_cluster.this", "module.eks.module.karpenter.aws_iam_role.this"},
+		},
+		{
+			name: "removes every instance of a module",
+			args: args{address: "module.node"},
+			want: []string{"module.node[\"blue\"].aws_iam_role.this"},
+		},
+		{
+			name: "removes a single instance of a module",
+			args: args{address: "module.node[\"blue\"]"},
+			want: []string{"module.node[\"blue\"].aws_iam_role.this"},
+		},
+		{
+			name: "removes every instance of a counted resource",
+			args: args{address: "aws_iam_role.counted"},
+			want: []string{"aws_iam_role.counted"},
+		},
+		{
+			name: "removes nothing when nothing matches",
+			args: args{address: "aws_iam_role.bar"},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &State{Version: 4, Resources: testResources()}
+			removed, err := s.Remove(tt.args.address)
+			if err != nil {
+				t.Fatalf("State.Remove() error = %v", err)
+			}
+			got := addresses(removed)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("State.Remove() = %v, want %v", got, tt.want)
+			}
+			if len(s.Resources)+len(got) != len(testResources()) {
+				t.Errorf("State.Remove() left %d resources behind after removing %d", len(s.Resources), len(got))
+			}
+		})
+	}
+}
+
+func TestMove(t *testing.T) {
+	type args struct {
+		fromAddress string
+		toAddress   string
+		to          []*Resource
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "moves a resource",
+			args:    args{fromAddress: "aws_iam_role.foo", toAddress: "aws_iam_role.foo", to: []*Resource{}},
+			want:    []string{"aws_iam_role.foo"},
+			wantErr: false,
+		},
+		{
+			name:    "moves and renames a module",
+			args:    args{fromAddress: "module.eks", toAddress: "module.cluster", to: []*Resource{}},
+			want:    []string{"module.cluster.aws_eks_cluster.this", "module.cluster.module.karpenter.aws_iam_role.this"},
+			wantErr: false,
+		},
+		{
+			name:    "moves a nested module to the root module",
+			args:    args{fromAddress: "module.eks.module.karpenter", toAddress: "module.karpenter", to: []*Resource{}},
+			want:    []string{"module.karpenter.aws_iam_role.this"},
+			wantErr: false,
+		},
+		{
+			name:    "moves a resource out of a module instance into the root module",
+			args:    args{fromAddress: "module.node[\"blue\"].aws_iam_role.this", toAddress: "aws_iam_role.this", to: []*Resource{}},
+			want:    []string{"aws_iam_role.this"},
+			wantErr: false,
+		},
+		{
+			name:    "moves a resource into a nested module",
+			args:    args{fromAddress: "aws_iam_role.foo", toAddress: "module.eks.module.karpenter.aws_iam_role.foo", to: []*Resource{}},
+			want:    []string{"module.eks.module.karpenter.aws_iam_role.foo"},
+			wantErr: false,
+		},
+		{
+			name: "fails when the resource already exists in the destination",
+			args: args{
+				fromAddress: "aws_iam_role.foo",
+				toAddress:   "aws_iam_role.foo",
+				to:          []*Resource{{Mode: MODE_MANAGED, Type: "aws_iam_role", Name: "foo"}},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := &State{Version: 4, Resources: testResources()}
+			to := &State{Version: 4, Resources: tt.args.to}
+			got, err := Move(from, tt.args.fromAddress, to, tt.args.toAddress)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Move() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Move() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(addresses(to.Resources), tt.want) {
+				t.Errorf("Move() destination resources = %v, want %v", addresses(to.Resources), tt.want)
+			}
+		})
+	}
+}
+
+func TestMove_Providers(t *testing.T) {
+	aws := `provider["registry.terraform.io/hashicorp/aws"]`
+	tests := []struct {
+		name         string
+		module       string
+		provider     string
+		fromAddress  string
+		toAddress    string
+		wantProvider string
+	}{
+		{
+			name:         "uses the configuration of the destination for a resource moved out of the module configuring it",
+			module:       "module.child",
+			provider:     "module.child." + aws + ".east",
+			fromAddress:  "module.child.aws_iam_role.this",
+			toAddress:    "aws_iam_role.this",
+			wantProvider: aws + ".east",
+		},
+		{
+			name:         "keeps a configuration passed in from the root module",
+			module:       "module.child",
+			provider:     aws + ".east",
+			fromAddress:  "module.child.aws_iam_role.this",
+			toAddress:    "aws_iam_role.this",
+			wantProvider: aws + ".east",
+		},
+		{
+			name:         "keeps a configuration of a module around the destination",
+			module:       "module.child.module.grandchild",
+			provider:     "module.child." + aws,
+			fromAddress:  "module.child.module.grandchild.aws_iam_role.this",
+			toAddress:    "module.child.aws_iam_role.this",
+			wantProvider: "module.child." + aws,
+		},
+		{
+			name:         "addresses the configuration of a keyed destination module without its key",
+			module:       "module.child",
+			provider:     "module.child." + aws,
+			fromAddress:  "module.child.aws_iam_role.this",
+			toAddress:    `module.node["blue"].aws_iam_role.this`,
+			wantProvider: "module.node." + aws,
+		},
+		{
+			name:         "moves the configurations of a renamed module with it",
+			module:       "module.child",
+			provider:     "module.child." + aws,
+			fromAddress:  "module.child",
+			toAddress:    "module.renamed",
+			wantProvider: "module.renamed." + aws,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := &State{Version: 4, Resources: []*Resource{
+				{Module: tt.module, Mode: MODE_MANAGED, Type: "aws_iam_role", Name: "this", Provider: tt.provider, Instances: json.RawMessage("[]")},
+			}}
+			to := &State{Version: 4, Resources: []*Resource{}}
+			if _, err := Move(from, tt.fromAddress, to, tt.toAddress); err != nil {
+				t.Fatalf("Move() error = %v", err)
+			}
+			if len(to.Resources) != 1 || to.Resources[0].Provider != tt.wantProvider {
+				t.Errorf("Move() destination resources = %v, want one with provider %s", to.Resources, tt.wantProvider)
+			}
+		})
+	}
+}
+
+func TestMove_Instances(t *testing.T) {
+	type args struct {
+		address string
+	}
+	tests := []struct {
+		name     string
+		args     args
+		want     []string
+		wantFrom []any
+		wantTo   []any
+		wantErr  bool
+	}{
+		{
+			name:     "moves a single count instance",
+			args:     args{address: "aws_iam_role.counted[1]"},
+			want:     []string{"aws_iam_role.counted[1]"},
+			wantFrom: []any{float64(0)},
+			wantTo:   []any{float64(1)},
+			wantErr:  false,
+		},
+		{
+			name:     "moves the last for_each instance and drops the empty resource",
+			args:     args{address: "aws_iam_role.each[\"blue\"]"},
+			want:     []string{"aws_iam_role.each[\"blue\"]"},
+			wantFrom: nil,
+			wantTo:   []any{"blue"},
+			wantErr:  false,
+		},
+		{
+			name:     "moves nothing when the instance does not exist",
+			args:     args{address: "aws_iam_role.counted[5]"},
+			want:     []string{},
+			wantFrom: []any{float64(0), float64(1)},
+			wantTo:   nil,
+			wantErr:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := &State{Version: 4, Resources: testResources()}
+			to := &State{Version: 4, Resources: []*Resource{}}
+			got, err := Move(from, tt.args.address, to, tt.args.address)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Move() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Move() = %v, want %v", got, tt.want)
+			}
+
+			base, _ := splitInstanceKey(tt.args.address)
+			for _, check := range []struct {
+				s    *State
+				want []any
+			}{{from, tt.wantFrom}, {to, tt.wantTo}} {
+				var gotKeys []any
+				for _, r := range check.s.Resources {
+					if r.Address() == base {
+						gotKeys = indexKeys(t, r)
+					}
+				}
+				if !reflect.DeepEqual(gotKeys, check.want) {
+					t.Errorf("Move() left instances %v at %s, want %v", gotKeys, base, check.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMove_MergesInstances(t *testing.T) {
+	from := &State{Version: 4, Resources: testResources()}
+	to := &State{Version: 4, Resources: []*Resource{}}
+	for _, address := range []string{"aws_iam_role.counted[0]", "aws_iam_role.counted[1]"} {
+		if _, err := Move(from, address, to, address); err != nil {
+			t.Fatalf("Move() error = %v", err)
+		}
+	}
+	if len(to.Resources) != 1 || !reflect.DeepEqual(indexKeys(t, to.Resources[0]), []any{float64(0), float64(1)}) {
+		t.Errorf("Move() did not merge instances into one resource: %v", addresses(to.Resources))
+	}
+
+	// moving an instance that already exists in the destination fails without changing it
+	again := &State{Version: 4, Resources: testResources()}
+	if _, err := Move(again, "aws_iam_role.counted[0]", to, "aws_iam_role.counted[0]"); err == nil {
+		t.Error("Move() moved an instance that already exists in the destination")
+	}
+	if !reflect.DeepEqual(indexKeys(t, to.Resources[0]), []any{float64(0), float64(1)}) {
+		t.Errorf("Move() changed the destination after failing")
+	}
+}
+
+func TestReadBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "terraform.tfstate")
+	want := &State{
+		Version:          4,
+		TerraformVersion: "1.9.0",
+		Serial:           3,
+		Lineage:          "abc",
+		Outputs:          json.RawMessage(`{}`),
+		Resources:        testResources(),
+	}
+	data, err := want.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !reflect.DeepEqual(addresses(got.Resources), addresses(want.Resources)) || got.Serial != want.Serial || got.Lineage != want.Lineage {
+		t.Errorf("Read() = %v, want %v", got, want)
+	}
+}
+
+func TestResource_ImportTargets(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource *Resource
+		want     []*ImportTarget
+		wantErr  bool
+	}{
+		{
+			name:     "imports a resource without instance keys",
+			resource: &Resource{Mode: MODE_MANAGED, Type: "aws_iam_role", Name: "foo", Instances: json.RawMessage(`[{"attributes":{"id":"foo"}}]`)},
+			want:     []*ImportTarget{{Address: "aws_iam_role.foo", Id: "foo"}},
+			wantErr:  false,
+		},
+		{
+			name:     "imports every instance by its key",
+			resource: &Resource{Module: "module.node[\"blue\"]", Mode: MODE_MANAGED, Type: "aws_iam_role", Name: "this", Instances: json.RawMessage(`[{"index_key":0,"attributes":{"id":"a"}},{"index_key":"b","attributes":{"id":"b"}}]`)},
+			want:     []*ImportTarget{{Address: "module.node[\"blue\"].aws_iam_role.this[0]", Id: "a"}, {Address: "module.node[\"blue\"].aws_iam_role.this[\"b\"]", Id: "b"}},
+			wantErr:  false,
+		},
+		{
+			name:     "imports resource types that are not imported by their id attribute",
+			resource: &Resource{Mode: MODE_MANAGED, Type: "aws_iam_role_policy_attachment", Name: "this", Instances: json.RawMessage(`[{"attributes":{"id":"foo-20250101","role":"foo","policy_arn":"arn:aws:iam::aws:policy/ReadOnlyAccess"}}]`)},
+			want:     []*ImportTarget{{Address: "aws_iam_role_policy_attachment.this", Id: "foo/arn:aws:iam::aws:policy/ReadOnlyAccess", Known: true}},
+			wantErr:  false,
+		},
+		{
+			name:     "imports security group rules by their sources",
+			resource: &Resource{Mode: MODE_MANAGED, Type: "aws_security_group_rule", Name: "this", Instances: json.RawMessage(`[{"attributes":{"id":"sgrule-1","security_group_id":"sg-1","type":"ingress","protocol":"tcp","from_port":443,"to_port":443,"cidr_blocks":["10.0.0.0/16"],"self":true}}]`)},
+			want:     []*ImportTarget{{Address: "aws_security_group_rule.this", Id: "sg-1_ingress_tcp_443_443_10.0.0.0/16_self", Known: true}},
+			wantErr:  false,
+		},
+		{
+			name:     "falls back to the id attribute when the import id cannot be built",
+			resource: &Resource{Mode: MODE_MANAGED, Type: "aws_route_table_association", Name: "this", Instances: json.RawMessage(`[{"attributes":{"id":"rtbassoc-1","route_table_id":"rtb-1"}}]`)},
+			want:     []*ImportTarget{{Address: "aws_route_table_association.this", Id: "rtbassoc-1"}},
+			wantErr:  false,
+		},
+		{
+			name:     "fails when an instance has no id",
+			resource: &Resource{Mode: MODE_MANAGED, Type: "aws_iam_role", Name: "foo", Instances: json.RawMessage(`[{"attributes":{}}]`)},
+			want:     nil,
+			wantErr:  true,
+		},
+		{
+			name:     "fails for data sources",
+			resource: &Resource{Mode: MODE_DATA, Type: "aws_iam_role", Name: "foo", Instances: json.RawMessage(`[{"attributes":{"id":"foo"}}]`)},
+			want:     nil,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.resource.ImportTargets()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ImportTargets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ImportTargets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}